@@ -3,7 +3,7 @@ import React, { createContext, useContext, useState, useEffect, type ReactNode }
 interface AuthContextType {
   token: string | null;
   isAuthenticated: boolean;
-  login: (token: string) => void;
+  login: (token: string, refreshToken?: string) => void;
   logout: () => void;
 }
 
@@ -14,13 +14,15 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     localStorage.getItem("auth_token")
   );
 
-  const login = (newToken: string) => {
+  const login = (newToken: string, refreshToken?: string) => {
     localStorage.setItem("auth_token", newToken);
+    if (refreshToken) localStorage.setItem("refresh_token", refreshToken);
     setToken(newToken);
   };
 
   const logout = () => {
     localStorage.removeItem("auth_token");
+    localStorage.removeItem("refresh_token");
     setToken(null);
   };
 
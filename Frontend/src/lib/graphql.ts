@@ -49,7 +49,7 @@ export const REQUEST_LOGIN = `
 
 export const VERIFY_LOGIN = `
   mutation VerifyLogin($email: String!, $code: String!) {
-    verifyLogin(email: $email, code: $code)
+    verifyLogin(email: $email, code: $code) { accessToken refreshToken }
   }
 `;
 
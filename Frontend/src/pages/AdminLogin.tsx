@@ -33,7 +33,7 @@ const AdminLogin = () => {
         setLoading(true);
         try {
             const data = await graphqlRequest(VERIFY_LOGIN, { email, code: otp });
-            login(data.verifyLogin);
+            login(data.verifyLogin.accessToken, data.verifyLogin.refreshToken);
             toast.success("Welcome back, Admin!");
             navigate("/dashboard");
         } catch (error) {
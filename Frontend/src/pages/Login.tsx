@@ -39,8 +39,8 @@ export default function Login() {
     if (code.length !== 6) return;
     setLoading(true);
     try {
-      const data = await graphqlRequest<{ verifyLogin: string }>(VERIFY_LOGIN, { email, code });
-      login(data.verifyLogin);
+      const data = await graphqlRequest<{ verifyLogin: { accessToken: string; refreshToken: string } }>(VERIFY_LOGIN, { email, code });
+      login(data.verifyLogin.accessToken, data.verifyLogin.refreshToken);
       toast.success("Welcome back!");
       navigate("/dashboard");
     } catch (err: any) {
@@ -0,0 +1,228 @@
+package booking
+
+import (
+	"car-service/config"
+	"car-service/models"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrOutsideOpeningHours is returned for slots that do not fit in one opening interval
+	ErrOutsideOpeningHours = errors.New("test drives must start and end within opening hours")
+	// ErrCarNotBookable is returned for cars that are not on sale
+	ErrCarNotBookable = errors.New("only available cars can be test-driven")
+	// ErrInvalidSlot is returned for durations or start times outside the configured limits
+	ErrInvalidSlot = errors.New("invalid test drive slot")
+)
+
+// feedHistory is how far back the iCalendar feed goes
+const feedHistory = 30 * 24 * time.Hour
+
+// Service books, confirms and cancels test drives and notifies the customer by email.
+// Both the GraphQL resolvers and the calendar feed go through it.
+type Service struct {
+	Bookings repository.TestDriveRepository
+	Cars     repository.CarRepository
+	// Mailer sends the confirmations; nil disables them
+	Mailer *utils.Mailer
+	Hours  OpeningHours
+
+	cfg     config.BookingsConfig
+	feedKey []byte
+	now     func() time.Time
+}
+
+// NewService creates a Service from the booking configuration. feedSecret signs the calendar
+// feed URLs; changing it invalidates every URL handed out.
+func NewService(bookings repository.TestDriveRepository, cars repository.CarRepository, mailer *utils.Mailer, cfg config.BookingsConfig, feedSecret string) (*Service, error) {
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid booking time zone: %v", err)
+	}
+	hours, err := ParseOpeningHours(cfg.OpeningHours, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid booking opening hours: %v", err)
+	}
+	key := hmac.New(sha256.New, []byte(feedSecret))
+	key.Write([]byte("test-drive-feed"))
+	return &Service{
+		Bookings: bookings,
+		Cars:     cars,
+		Mailer:   mailer,
+		Hours:    hours,
+		cfg:      cfg,
+		feedKey:  key.Sum(nil),
+		now:      time.Now,
+	}, nil
+}
+
+// Book reserves a car for a customer from start for the given duration. The booking is
+// pending until an admin confirms it.
+func (s *Service) Book(ctx context.Context, userID, carID int, start time.Time, duration time.Duration) (models.TestDrive, error) {
+	// 1. The slot must respect the configured limits and opening hours
+	if duration < s.cfg.MinDuration || duration > s.cfg.MaxDuration {
+		return models.TestDrive{}, fmt.Errorf("%w: duration must be between %d and %d minutes",
+			ErrInvalidSlot, int(s.cfg.MinDuration.Minutes()), int(s.cfg.MaxDuration.Minutes()))
+	}
+	now := s.now()
+	if start.Before(now.Add(s.cfg.MinNotice)) {
+		return models.TestDrive{}, fmt.Errorf("%w: test drives must be booked at least %s ahead", ErrInvalidSlot, s.cfg.MinNotice)
+	}
+	if start.After(now.Add(s.cfg.MaxAdvance)) {
+		return models.TestDrive{}, fmt.Errorf("%w: test drives can be booked at most %d days ahead",
+			ErrInvalidSlot, int(s.cfg.MaxAdvance.Hours()/24))
+	}
+	end := start.Add(duration)
+	if !s.Hours.Contains(start, end) {
+		return models.TestDrive{}, fmt.Errorf("%w (%s, %s)", ErrOutsideOpeningHours, s.Hours, s.Hours.Location())
+	}
+
+	// 2. Only cars on sale can be driven
+	car, err := s.Cars.Get(ctx, carID)
+	if err != nil {
+		return models.TestDrive{}, err
+	}
+	if car.Status != models.StatusAvailable {
+		return models.TestDrive{}, ErrCarNotBookable
+	}
+
+	// 3. The store rejects overlaps atomically
+	td, err := s.Bookings.Create(ctx, models.TestDrive{CarID: carID, UserID: userID, Start: start, End: end})
+	if err != nil {
+		return models.TestDrive{}, err
+	}
+	s.notify(td, carTitle(car), "Test drive requested",
+		"We have received your test drive request and will confirm it shortly.")
+	return td, nil
+}
+
+// Confirm accepts a pending booking
+func (s *Service) Confirm(ctx context.Context, id int) (models.TestDrive, error) {
+	td, err := s.Bookings.SetStatus(ctx, id, models.TestDriveConfirmed)
+	if err != nil {
+		return models.TestDrive{}, err
+	}
+	s.notify(td, s.title(ctx, td.CarID), "Test drive confirmed", "Your test drive is confirmed. See you then!")
+	return td, nil
+}
+
+// Cancel cancels a booking on behalf of an admin or of the customer who made it. Other
+// customers' bookings are reported as not found.
+func (s *Service) Cancel(ctx context.Context, id, userID int, admin bool) (models.TestDrive, error) {
+	if !admin {
+		td, err := s.Bookings.Get(ctx, id)
+		if err != nil {
+			return models.TestDrive{}, err
+		}
+		if td.UserID != userID {
+			return models.TestDrive{}, repository.ErrTestDriveNotFound
+		}
+	}
+	td, err := s.Bookings.SetStatus(ctx, id, models.TestDriveCancelled)
+	if err != nil {
+		return models.TestDrive{}, err
+	}
+	s.notify(td, s.title(ctx, td.CarID), "Test drive cancelled", "Your test drive has been cancelled.")
+	return td, nil
+}
+
+// notify emails the customer; failures are logged, the booking change stands
+func (s *Service) notify(td models.TestDrive, title, subject, message string) {
+	if s.Mailer == nil || td.UserEmail == "" {
+		return
+	}
+	local := td.Start.In(s.Hours.Location())
+	body := fmt.Sprintf("%s\n\nCar: %s\nWhen: %s - %s\nBooking: #%d (%s)\n",
+		message, title, local.Format("Mon 2 Jan 2006 15:04"), td.End.In(s.Hours.Location()).Format("15:04 MST"), td.ID, td.Status)
+	if err := s.Mailer.Send(td.UserEmail, subject+": "+title, body); err != nil {
+		log.Printf("Failed to email test drive %d confirmation: %v", td.ID, err)
+	}
+}
+
+func carTitle(car models.Car) string {
+	return fmt.Sprintf("%d %s %s", car.Year, car.Make, car.Model)
+}
+
+// title names a car for emails and calendar events, even if it has been deleted since
+func (s *Service) title(ctx context.Context, carID int) string {
+	car, err := s.Cars.Get(ctx, carID)
+	if err != nil {
+		return fmt.Sprintf("car #%d", carID)
+	}
+	return carTitle(car)
+}
+
+// FeedToken returns the token of a customer's calendar feed
+func (s *Service) FeedToken(userID int) string {
+	id := strconv.Itoa(userID)
+	return id + "." + s.feedSignature(id)
+}
+
+func (s *Service) feedSignature(id string) string {
+	mac := hmac.New(sha256.New, s.feedKey)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
+
+// FeedUser returns the customer a feed token belongs to
+func (s *Service) FeedUser(token string) (int, bool) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.feedSignature(id))) {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	return userID, err == nil
+}
+
+// FeedURL is the address calendar apps subscribe to for a customer's test drives
+func (s *Service) FeedURL(userID int) string {
+	sep := "?"
+	if strings.Contains(s.cfg.FeedURL, "?") {
+		sep = "&"
+	}
+	return s.cfg.FeedURL + sep + "token=" + url.QueryEscape(s.FeedToken(userID))
+}
+
+// WriteFeed writes a customer's test drives of the last 30 days and the future as an iCalendar file
+func (s *Service) WriteFeed(ctx context.Context, w io.Writer, userID int) error {
+	from := s.now().Add(-feedHistory)
+	drives, err := s.Bookings.List(ctx, repository.TestDriveFilter{UserID: &userID, From: &from})
+	if err != nil {
+		return err
+	}
+
+	carIDs := make([]int, len(drives))
+	for i, td := range drives {
+		carIDs[i] = td.CarID
+	}
+	cars, err := s.Cars.GetMany(ctx, carIDs)
+	if err != nil {
+		return err
+	}
+	byID := map[int]models.Car{}
+	for _, c := range cars {
+		byID[c.ID] = c
+	}
+	titles := map[int]string{}
+	for _, td := range drives {
+		title := fmt.Sprintf("car #%d", td.CarID)
+		if car, ok := byID[td.CarID]; ok {
+			title = carTitle(car)
+		}
+		titles[td.ID] = "Test drive: " + title
+	}
+	return WriteCalendar(w, "Test drives", drives, titles)
+}
@@ -0,0 +1,212 @@
+package booking
+
+import (
+	"bytes"
+	"car-service/config"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// monday is the fixed "now" of the tests: Monday 19 October 2026, 08:00 UTC
+var monday = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+func newTestService(t *testing.T) (*Service, *repository.MemoryTestDriveRepository) {
+	t.Helper()
+	cars := repository.NewMemoryCarRepository()
+	ctx := context.Background()
+	cars.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"})
+	cars.Create(ctx, models.Car{Make: "BMW", Model: "M3", Year: 2023, Price: 70000, Color: "Black"})
+	cars.Create(ctx, models.Car{Make: "Toyota", Model: "Corolla", Year: 2021, Price: 19000, Color: "Red"})
+	cars.SetStatus(ctx, 2, models.StatusSold, 0)
+
+	bookings := repository.NewMemoryTestDriveRepository()
+	svc, err := NewService(bookings, cars, nil, config.Default().Bookings, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	svc.now = func() time.Time { return monday }
+	return svc, bookings
+}
+
+func TestParseOpeningHours(t *testing.T) {
+	h, err := ParseOpeningHours("mon-fri 09:00-12:00, mon-fri 13:00-18:00; sat-sun 10:00-24:00", time.UTC)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC) }
+	cases := []struct {
+		start, end time.Time
+		want       bool
+	}{
+		{at(19, 9, 0), at(19, 10, 0), true},
+		{at(19, 11, 30), at(19, 12, 30), false}, // Across the lunch break
+		{at(19, 17, 30), at(19, 18, 0), true},
+		{at(19, 8, 45), at(19, 9, 15), false},
+		{at(24, 23, 0), at(25, 0, 0), true}, // Saturday until midnight
+		{at(25, 23, 30), at(26, 0, 30), false},
+	}
+	for _, c := range cases {
+		if got := h.Contains(c.start, c.end); got != c.want {
+			t.Errorf("Contains(%s, %s) = %v, want %v", c.start, c.end, got, c.want)
+		}
+	}
+
+	for _, spec := range []string{"", "mon 9-17", "funday 09:00-17:00", "mon 18:00-09:00", "mon 09:00-25:00"} {
+		if _, err := ParseOpeningHours(spec, time.UTC); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestOpeningHoursAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	h, err := ParseOpeningHours("daily 09:00-18:00", loc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Clocks go forward on 8 March 2026 and back on 1 November 2026
+	for _, day := range []time.Time{time.Date(2026, 3, 8, 0, 0, 0, 0, loc), time.Date(2026, 11, 1, 0, 0, 0, 0, loc)} {
+		at := func(hour, minute int) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		}
+		if !h.Contains(at(9, 0), at(10, 0)) {
+			t.Errorf("Expected 09:00-10:00 on %s to be open", day.Format("2006-01-02"))
+		}
+		if !h.Contains(at(17, 0), at(18, 0)) {
+			t.Errorf("Expected 17:00-18:00 on %s to be open", day.Format("2006-01-02"))
+		}
+		if h.Contains(at(18, 30), at(19, 0)) {
+			t.Errorf("Expected 18:30-19:00 on %s to be closed", day.Format("2006-01-02"))
+		}
+		if h.Contains(at(8, 30), at(9, 30)) {
+			t.Errorf("Expected 08:30-09:30 on %s to be closed", day.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestBookTestDrive(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	tuesday := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+
+	td, err := svc.Book(ctx, 7, 1, tuesday, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if td.Status != models.TestDrivePending || !td.End.Equal(tuesday.Add(30*time.Minute)) {
+		t.Errorf("Unexpected booking %+v", td)
+	}
+
+	cases := []struct {
+		name     string
+		userID   int
+		carID    int
+		start    time.Time
+		duration time.Duration
+		want     error
+	}{
+		{"overlapping slot", 8, 1, tuesday.Add(15 * time.Minute), 30 * time.Minute, repository.ErrSlotTaken},
+		{"customer busy", 7, 3, tuesday.Add(-30 * time.Minute), time.Hour, repository.ErrDoubleBooked},
+		{"sold car", 8, 2, tuesday, 30 * time.Minute, ErrCarNotBookable},
+		{"too short", 8, 1, tuesday.Add(2 * time.Hour), 5 * time.Minute, ErrInvalidSlot},
+		{"too soon", 8, 1, monday.Add(30 * time.Minute), 30 * time.Minute, ErrInvalidSlot},
+		{"too far ahead", 8, 1, monday.Add(90 * 24 * time.Hour), 30 * time.Minute, ErrInvalidSlot},
+		{"after hours", 8, 1, time.Date(2026, 10, 20, 17, 30, 0, 0, time.UTC), time.Hour, ErrOutsideOpeningHours},
+		{"missing car", 8, 99, tuesday, 30 * time.Minute, repository.ErrNotFound},
+	}
+	for _, c := range cases {
+		if _, err := svc.Book(ctx, c.userID, c.carID, c.start, c.duration); !errors.Is(err, c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	// Back-to-back bookings do not overlap
+	if _, err := svc.Book(ctx, 8, 1, tuesday.Add(30*time.Minute), 30*time.Minute); err != nil {
+		t.Errorf("Expected the following slot to be free, got %v", err)
+	}
+}
+
+func TestConfirmAndCancel(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	tuesday := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	td, _ := svc.Book(ctx, 7, 1, tuesday, time.Hour)
+
+	if _, err := svc.Cancel(ctx, td.ID, 8, false); !errors.Is(err, repository.ErrTestDriveNotFound) {
+		t.Errorf("Expected another customer's cancel to fail as not found, got %v", err)
+	}
+	if td, err := svc.Confirm(ctx, td.ID); err != nil || td.Status != models.TestDriveConfirmed {
+		t.Fatalf("Expected confirmed booking, got %+v %v", td, err)
+	}
+	if td, err := svc.Cancel(ctx, td.ID, 7, false); err != nil || td.Status != models.TestDriveCancelled {
+		t.Fatalf("Expected the customer to cancel, got %+v %v", td, err)
+	}
+	if _, err := svc.Confirm(ctx, td.ID); !errors.Is(err, repository.ErrTestDriveStatus) {
+		t.Errorf("Expected a cancelled booking to stay cancelled, got %v", err)
+	}
+
+	// The cancelled slot is free again
+	if _, err := svc.Book(ctx, 8, 1, tuesday, time.Hour); err != nil {
+		t.Errorf("Expected the cancelled slot to be free, got %v", err)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t)
+	svc.Book(ctx, 7, 1, time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC), time.Hour)
+	svc.Book(ctx, 8, 1, time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC), time.Hour)
+
+	feedURL, err := url.Parse(svc.FeedURL(7))
+	if err != nil {
+		t.Fatalf("Invalid feed URL: %v", err)
+	}
+	token := feedURL.Query().Get("token")
+	if userID, ok := svc.FeedUser(token); !ok || userID != 7 {
+		t.Errorf("Expected the token to identify user 7, got %d %v", userID, ok)
+	}
+	if _, ok := svc.FeedUser("8" + token[1:]); ok {
+		t.Error("Expected a token with a swapped user ID to be rejected")
+	}
+
+	var buf bytes.Buffer
+	if err := svc.WriteFeed(ctx, &buf, 7); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ics := buf.String()
+	for _, want := range []string{"BEGIN:VCALENDAR\r\n", "UID:test-drive-1@car-service\r\n",
+		"DTSTART:20261020T100000Z\r\n", "DTEND:20261020T110000Z\r\n", "SUMMARY:Test drive: 2018 Honda Civic\r\n",
+		"STATUS:TENTATIVE\r\n", "END:VCALENDAR\r\n"} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in feed:\n%s", want, ics)
+		}
+	}
+	if strings.Contains(ics, "test-drive-2@") {
+		t.Error("Expected only the customer's own bookings in the feed")
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 60)
+	folded := foldLine(line)
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("Line of %d octets: %q", len(part), part)
+		}
+	}
+	if strings.ReplaceAll(folded, "\r\n ", "") != line {
+		t.Error("Unfolding did not restore the line")
+	}
+	if got := escapeText("a,b;c\\d\ne"); got != `a\,b\;c\\d\ne` {
+		t.Errorf("Unexpected escaping %q", got)
+	}
+}
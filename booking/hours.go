@@ -0,0 +1,145 @@
+package booking
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// span is an opening interval in minutes after midnight, [from, to)
+type span struct {
+	from, to int
+}
+
+// OpeningHours is a weekly schedule in a fixed time zone
+type OpeningHours struct {
+	spec string
+	loc  *time.Location
+	days [7][]span
+}
+
+// ParseOpeningHours parses a comma- or semicolon-separated list of "<days> HH:MM-HH:MM"
+// entries, where days is a weekday ("sat"), a range ("mon-fri") or "daily". A day may be
+// listed more than once, e.g. for a lunch break; "24:00" closes at midnight.
+func ParseOpeningHours(spec string, loc *time.Location) (OpeningHours, error) {
+	h := OpeningHours{spec: strings.TrimSpace(spec), loc: loc}
+	entries := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ';' })
+	for _, entry := range entries {
+		fields := strings.Fields(strings.ToLower(entry))
+		if len(fields) != 2 {
+			return OpeningHours{}, fmt.Errorf("opening hours entry %q must look like \"mon-fri 09:00-18:00\"", strings.TrimSpace(entry))
+		}
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return OpeningHours{}, err
+		}
+		s, err := parseSpan(fields[1])
+		if err != nil {
+			return OpeningHours{}, err
+		}
+		for _, d := range days {
+			h.days[d] = append(h.days[d], s)
+		}
+	}
+	if len(entries) == 0 {
+		return OpeningHours{}, fmt.Errorf("opening hours must list at least one day")
+	}
+	return h, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	if s == "daily" {
+		s = "sun-sat"
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	first, ok := weekdays[from]
+	if !ok {
+		return nil, fmt.Errorf("unknown weekday %q, use mon, tue, wed, thu, fri, sat or sun", from)
+	}
+	if !isRange {
+		return []time.Weekday{first}, nil
+	}
+	last, ok := weekdays[to]
+	if !ok {
+		return nil, fmt.Errorf("unknown weekday %q, use mon, tue, wed, thu, fri, sat or sun", to)
+	}
+	// Ranges may wrap around the week, e.g. "sat-mon"
+	days := []time.Weekday{first}
+	for d := first; d != last; {
+		d = (d + 1) % 7
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func parseSpan(s string) (span, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return span{}, fmt.Errorf("opening time %q must look like 09:00-18:00", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return span{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return span{}, err
+	}
+	if end <= start {
+		return span{}, fmt.Errorf("opening time %q must end after it starts", s)
+	}
+	return span{from: start, to: end}, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("time %q must be HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("time %q is out of range", s)
+	}
+	return h*60 + m, nil
+}
+
+// Location is the time zone of the schedule
+func (h OpeningHours) Location() *time.Location {
+	return h.loc
+}
+
+// String returns the schedule as it was configured
+func (h OpeningHours) String() string {
+	return h.spec
+}
+
+// Contains reports whether [start, end) lies within a single opening interval. Times are
+// compared on the local wall clock, so the schedule holds on days the clocks change.
+func (h OpeningHours) Contains(start, end time.Time) bool {
+	local, localEnd := start.In(h.loc), end.In(h.loc)
+	from, to := clock(local), clock(localEnd)
+	y, m, d := local.Date()
+	if ey, em, ed := localEnd.Date(); ey != y || em != m || ed != d {
+		// Only an interval closing at "24:00" may end on the next day, exactly at midnight
+		if to != 0 || !localEnd.Equal(time.Date(y, m, d+1, 0, 0, 0, 0, h.loc)) {
+			return false
+		}
+		to = 24 * 60 * 60
+	}
+	for _, s := range h.days[local.Weekday()] {
+		if s.from*60 <= from && to <= s.to*60 {
+			return true
+		}
+	}
+	return false
+}
+
+// clock returns the wall-clock time of t in seconds after midnight
+func clock(t time.Time) int {
+	return t.Hour()*3600 + t.Minute()*60 + t.Second()
+}
@@ -0,0 +1,81 @@
+package booking
+
+import (
+	"bufio"
+	"car-service/models"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icsStatus maps booking statuses to iCalendar event statuses; cancelled events stay in the
+// feed so that calendar apps remove them
+var icsStatus = map[string]string{
+	models.TestDrivePending:   "TENTATIVE",
+	models.TestDriveConfirmed: "CONFIRMED",
+	models.TestDriveCancelled: "CANCELLED",
+}
+
+// WriteCalendar writes the bookings as an RFC 5545 calendar. titles holds the event summary
+// of each booking ID.
+func WriteCalendar(w io.Writer, name string, drives []models.TestDrive, titles map[int]string) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		bw.WriteString(foldLine(s))
+		bw.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Car Service//Test Drives//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeText(name))
+	for _, td := range drives {
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:test-drive-%d@car-service", td.ID))
+		line("DTSTAMP:" + icsTime(td.UpdatedAt))
+		line("LAST-MODIFIED:" + icsTime(td.UpdatedAt))
+		line("DTSTART:" + icsTime(td.Start))
+		line("DTEND:" + icsTime(td.End))
+		line("SUMMARY:" + escapeText(titles[td.ID]))
+		line("STATUS:" + icsStatus[td.Status])
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldLine splits content lines longer than 75 octets, without breaking UTF-8 sequences
+func foldLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	width := limit
+	for len(s) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		width = limit - 1
+	}
+	b.WriteString(s)
+	return b.String()
+}
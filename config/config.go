@@ -0,0 +1,480 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DevJWTSecret is only accepted outside production
+const DevJWTSecret = "default-secret-key-change-me"
+
+// DevOTPPepper is the one-time code HMAC key used when OTP_PEPPER is unset; only accepted outside production
+const DevOTPPepper = "default-otp-pepper-change-me"
+
+// Config is the complete, validated application configuration
+type Config struct {
+	Env       string          `yaml:"env" toml:"env"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	DB        DBConfig        `yaml:"db" toml:"db"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Login     LoginConfig     `yaml:"login" toml:"login"`
+	SMTP      SMTPConfig      `yaml:"smtp" toml:"smtp"`
+	Trash     TrashConfig     `yaml:"trash" toml:"trash"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Documents DocumentsConfig `yaml:"documents" toml:"documents"`
+	Bookings  BookingsConfig  `yaml:"bookings" toml:"bookings"`
+	Holds     HoldsConfig     `yaml:"holds" toml:"holds"`
+	Sales     SalesConfig     `yaml:"sales" toml:"sales"`
+}
+
+// ServerConfig holds the listen addresses
+type ServerConfig struct {
+	Addr      string `yaml:"addr" toml:"addr"`
+	PprofAddr string `yaml:"pprof_addr" toml:"pprof_addr"`
+	// TrustProxy takes the client IP from X-Forwarded-For; only enable behind a trusted proxy
+	TrustProxy bool `yaml:"trust_proxy" toml:"trust_proxy"`
+}
+
+// DBConfig holds the Postgres DSN parts and pool sizes
+type DBConfig struct {
+	Host            string        `yaml:"host" toml:"host"`
+	Port            int           `yaml:"port" toml:"port"`
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	Name            string        `yaml:"name" toml:"name"`
+	SSLMode         string        `yaml:"sslmode" toml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+// AuthConfig holds the JWT signing secret and token lifetimes
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret" toml:"jwt_secret"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+}
+
+// LoginConfig holds the brute-force limits of requestLogin and verifyLogin
+type LoginConfig struct {
+	CodeLength          int           `yaml:"code_length" toml:"code_length"`
+	CodeTTL             time.Duration `yaml:"code_ttl" toml:"code_ttl"`
+	CodePepper          string        `yaml:"code_pepper" toml:"code_pepper"`
+	CodeMaxAttempts     int           `yaml:"code_max_attempts" toml:"code_max_attempts"`
+	MaxOutstandingCodes int           `yaml:"max_outstanding_codes" toml:"max_outstanding_codes"`
+	ResendCooldown      time.Duration `yaml:"resend_cooldown" toml:"resend_cooldown"`
+	MaxFailures         int           `yaml:"max_failures" toml:"max_failures"`
+	MaxRequestsPerIP    int           `yaml:"max_requests_per_ip" toml:"max_requests_per_ip"`
+	LockoutBase         time.Duration `yaml:"lockout_base" toml:"lockout_base"`
+	LockoutMax          time.Duration `yaml:"lockout_max" toml:"lockout_max"`
+	AttemptWindow       time.Duration `yaml:"attempt_window" toml:"attempt_window"`
+}
+
+// TrashConfig controls how long soft-deleted cars are kept before the scheduled purge removes them
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention" toml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval" toml:"purge_interval"`
+}
+
+// StorageConfig locates uploaded car photos and limits their size
+type StorageConfig struct {
+	UploadDir     string `yaml:"upload_dir" toml:"upload_dir"`
+	MediaBaseURL  string `yaml:"media_base_url" toml:"media_base_url"`
+	MaxImageBytes int    `yaml:"max_image_bytes" toml:"max_image_bytes"`
+}
+
+// DocumentsConfig fills in the printed window stickers and listing sheets
+type DocumentsConfig struct {
+	// ListingURL is the public page of a car, encoded in the QR code; {id} is replaced by the car ID
+	ListingURL string `yaml:"listing_url" toml:"listing_url"`
+	DealerName string `yaml:"dealer_name" toml:"dealer_name"`
+}
+
+// BookingsConfig controls when test drives can be booked
+type BookingsConfig struct {
+	// OpeningHours lists the weekly slots test drives must fit in, e.g. "mon-fri 09:00-18:00, sat 10:00-14:00"
+	OpeningHours string `yaml:"opening_hours" toml:"opening_hours"`
+	// TimeZone is the IANA zone the opening hours are in
+	TimeZone    string        `yaml:"time_zone" toml:"time_zone"`
+	MinDuration time.Duration `yaml:"min_duration" toml:"min_duration"`
+	MaxDuration time.Duration `yaml:"max_duration" toml:"max_duration"`
+	// MinNotice is how far ahead a test drive must be booked, MaxAdvance how far ahead it may be
+	MinNotice  time.Duration `yaml:"min_notice" toml:"min_notice"`
+	MaxAdvance time.Duration `yaml:"max_advance" toml:"max_advance"`
+	// FeedURL is the public address of the per-user iCalendar feed; the token is appended as ?token=
+	FeedURL string `yaml:"feed_url" toml:"feed_url"`
+}
+
+// HoldsConfig limits the reservations customers place with reserveCar
+type HoldsConfig struct {
+	MaxDuration time.Duration `yaml:"max_duration" toml:"max_duration"`
+	// MaxPerUser is how many cars one customer may hold at a time
+	MaxPerUser int `yaml:"max_per_user" toml:"max_per_user"`
+	// SweepInterval is how often expired holds are released
+	SweepInterval time.Duration `yaml:"sweep_interval" toml:"sweep_interval"`
+}
+
+// SalesConfig numbers and dates the invoices of sales orders
+type SalesConfig struct {
+	// InvoicePrefix is put before the invoice sequence number, e.g. INV-000042
+	InvoicePrefix string `yaml:"invoice_prefix" toml:"invoice_prefix"`
+	// PaymentTermsDays is how long after the sale an invoice is due
+	PaymentTermsDays int `yaml:"payment_terms_days" toml:"payment_terms_days"`
+}
+
+// SMTPConfig holds the mail server credentials. Leaving them empty enables console (dev) mode.
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	Email    string `yaml:"email" toml:"email"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// DSN builds the lib/pq connection string
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+}
+
+// Enabled reports whether real emails can be sent
+func (c SMTPConfig) Enabled() bool {
+	return c.Host != "" && c.Port != "" && c.Email != "" && c.Password != ""
+}
+
+// IsProduction reports whether the stricter production checks apply
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Default returns the development defaults
+func Default() *Config {
+	return &Config{
+		Env: "development",
+		Server: ServerConfig{
+			Addr:      ":8000",
+			PprofAddr: "0.0.0.0:6060",
+		},
+		DB: DBConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "postgres",
+			Name:            "Cars",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			JWTSecret:       DevJWTSecret,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Login: LoginConfig{
+			CodeLength:          6,
+			CodeTTL:             15 * time.Minute,
+			CodePepper:          DevOTPPepper,
+			CodeMaxAttempts:     5,
+			MaxOutstandingCodes: 3,
+			ResendCooldown:      time.Minute,
+			MaxFailures:         5,
+			MaxRequestsPerIP:    20,
+			LockoutBase:         time.Minute,
+			LockoutMax:          time.Hour,
+			AttemptWindow:       time.Hour,
+		},
+		Trash: TrashConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Storage: StorageConfig{
+			UploadDir:     "uploads",
+			MediaBaseURL:  "/media",
+			MaxImageBytes: 10 << 20,
+		},
+		Documents: DocumentsConfig{
+			ListingURL: "http://localhost:8000/cars/{id}",
+			DealerName: "Car Service",
+		},
+		Bookings: BookingsConfig{
+			OpeningHours: "mon-fri 09:00-18:00, sat 10:00-16:00",
+			TimeZone:     "UTC",
+			MinDuration:  15 * time.Minute,
+			MaxDuration:  2 * time.Hour,
+			MinNotice:    time.Hour,
+			MaxAdvance:   60 * 24 * time.Hour,
+			FeedURL:      "http://localhost:8000/test-drives/feed.ics",
+		},
+		Holds: HoldsConfig{
+			MaxDuration:   72 * time.Hour,
+			MaxPerUser:    2,
+			SweepInterval: time.Minute,
+		},
+		Sales: SalesConfig{
+			InvoicePrefix:    "INV-",
+			PaymentTermsDays: 14,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional YAML/TOML file (CONFIG_FILE),
+// the .env file and the process environment, in increasing order of precedence.
+func Load() (*Config, error) {
+	// .env never overrides variables that are already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env: %v", err)
+	}
+
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Auth.JWTSecret == DevJWTSecret {
+		log.Println("Warning: JWT_SECRET is not set, using the insecure development secret")
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file type: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(getenv func(string) string) error {
+	strs := map[string]*string{
+		"APP_ENV":               &c.Env,
+		"HTTP_ADDR":             &c.Server.Addr,
+		"PPROF_ADDR":            &c.Server.PprofAddr,
+		"DB_HOST":               &c.DB.Host,
+		"DB_USER":               &c.DB.User,
+		"DB_PASSWORD":           &c.DB.Password,
+		"DB_NAME":               &c.DB.Name,
+		"DB_SSLMODE":            &c.DB.SSLMode,
+		"JWT_SECRET":            &c.Auth.JWTSecret,
+		"OTP_PEPPER":            &c.Login.CodePepper,
+		"SMTP_HOST":             &c.SMTP.Host,
+		"SMTP_PORT":             &c.SMTP.Port,
+		"SMTP_EMAIL":            &c.SMTP.Email,
+		"SMTP_PASSWORD":         &c.SMTP.Password,
+		"UPLOAD_DIR":            &c.Storage.UploadDir,
+		"MEDIA_BASE_URL":        &c.Storage.MediaBaseURL,
+		"LISTING_URL":           &c.Documents.ListingURL,
+		"DEALER_NAME":           &c.Documents.DealerName,
+		"BOOKING_OPENING_HOURS": &c.Bookings.OpeningHours,
+		"BOOKING_TIMEZONE":      &c.Bookings.TimeZone,
+		"BOOKING_FEED_URL":      &c.Bookings.FeedURL,
+		"INVOICE_PREFIX":        &c.Sales.InvoicePrefix,
+	}
+	for key, dst := range strs {
+		if val := strings.TrimSpace(getenv(key)); val != "" {
+			*dst = val
+		}
+	}
+
+	ints := map[string]*int{
+		"DB_PORT":                     &c.DB.Port,
+		"DB_MAX_OPEN_CONNS":           &c.DB.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":           &c.DB.MaxIdleConns,
+		"LOGIN_CODE_LENGTH":           &c.Login.CodeLength,
+		"LOGIN_CODE_MAX_ATTEMPTS":     &c.Login.CodeMaxAttempts,
+		"LOGIN_MAX_OUTSTANDING_CODES": &c.Login.MaxOutstandingCodes,
+		"LOGIN_MAX_FAILURES":          &c.Login.MaxFailures,
+		"LOGIN_MAX_REQUESTS_PER_IP":   &c.Login.MaxRequestsPerIP,
+		"MAX_IMAGE_BYTES":             &c.Storage.MaxImageBytes,
+		"HOLD_MAX_PER_USER":           &c.Holds.MaxPerUser,
+		"PAYMENT_TERMS_DAYS":          &c.Sales.PaymentTermsDays,
+	}
+	for key, dst := range ints {
+		if val := strings.TrimSpace(getenv(key)); val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("%s must be an integer, got %q", key, val)
+			}
+			*dst = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":  &c.DB.ConnMaxLifetime,
+		"ACCESS_TOKEN_TTL":      &c.Auth.AccessTokenTTL,
+		"REFRESH_TOKEN_TTL":     &c.Auth.RefreshTokenTTL,
+		"LOGIN_CODE_TTL":        &c.Login.CodeTTL,
+		"LOGIN_RESEND_COOLDOWN": &c.Login.ResendCooldown,
+		"LOGIN_LOCKOUT_BASE":    &c.Login.LockoutBase,
+		"LOGIN_LOCKOUT_MAX":     &c.Login.LockoutMax,
+		"LOGIN_ATTEMPT_WINDOW":  &c.Login.AttemptWindow,
+		"TRASH_RETENTION":       &c.Trash.Retention,
+		"TRASH_PURGE_INTERVAL":  &c.Trash.PurgeInterval,
+		"BOOKING_MIN_DURATION":  &c.Bookings.MinDuration,
+		"BOOKING_MAX_DURATION":  &c.Bookings.MaxDuration,
+		"BOOKING_MIN_NOTICE":    &c.Bookings.MinNotice,
+		"BOOKING_MAX_ADVANCE":   &c.Bookings.MaxAdvance,
+		"HOLD_MAX_DURATION":     &c.Holds.MaxDuration,
+		"HOLD_SWEEP_INTERVAL":   &c.Holds.SweepInterval,
+	}
+	for key, dst := range durations {
+		if val := strings.TrimSpace(getenv(key)); val != "" {
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return fmt.Errorf("%s must be a duration like 15m, got %q", key, val)
+			}
+			*dst = d
+		}
+	}
+
+	if val := strings.TrimSpace(getenv("TRUST_PROXY")); val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("TRUST_PROXY must be true or false, got %q", val)
+		}
+		c.Server.TrustProxy = b
+	}
+	return nil
+}
+
+// Validate checks ranges and, in production, rejects insecure defaults
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Env != "development" && c.Env != "production" && c.Env != "test" {
+		problems = append(problems, "APP_ENV must be development, production or test")
+	}
+	if c.Server.Addr == "" {
+		problems = append(problems, "HTTP_ADDR must not be empty")
+	}
+	if c.DB.Host == "" || c.DB.User == "" || c.DB.Name == "" {
+		problems = append(problems, "DB_HOST, DB_USER and DB_NAME must not be empty")
+	}
+	if c.DB.Port <= 0 || c.DB.Port > 65535 {
+		problems = append(problems, "DB_PORT must be between 1 and 65535")
+	}
+	if c.DB.MaxOpenConns <= 0 {
+		problems = append(problems, "DB_MAX_OPEN_CONNS must be greater than 0")
+	}
+	if c.DB.MaxIdleConns < 0 || c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		problems = append(problems, "DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	}
+	if c.DB.ConnMaxLifetime < 0 {
+		problems = append(problems, "DB_CONN_MAX_LIFETIME must not be negative")
+	}
+	if c.Auth.JWTSecret == "" {
+		problems = append(problems, "JWT_SECRET must not be empty")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		problems = append(problems, "ACCESS_TOKEN_TTL must be greater than 0")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		problems = append(problems, "REFRESH_TOKEN_TTL must be longer than ACCESS_TOKEN_TTL")
+	}
+	if c.Login.CodeLength < 6 || c.Login.CodeLength > 10 {
+		problems = append(problems, "LOGIN_CODE_LENGTH must be between 6 and 10")
+	}
+	if c.Login.CodeTTL <= 0 {
+		problems = append(problems, "LOGIN_CODE_TTL must be greater than 0")
+	}
+	if c.Login.CodePepper == "" {
+		problems = append(problems, "OTP_PEPPER must not be empty")
+	}
+	if c.Login.CodeMaxAttempts <= 0 || c.Login.MaxOutstandingCodes <= 0 || c.Login.MaxFailures <= 0 || c.Login.MaxRequestsPerIP <= 0 {
+		problems = append(problems, "LOGIN_* attempt limits must be greater than 0")
+	}
+	if c.Login.ResendCooldown < 0 {
+		problems = append(problems, "LOGIN_RESEND_COOLDOWN must not be negative")
+	}
+	if c.Login.LockoutBase <= 0 || c.Login.LockoutMax < c.Login.LockoutBase || c.Login.AttemptWindow <= 0 {
+		problems = append(problems, "LOGIN_LOCKOUT_BASE, LOGIN_LOCKOUT_MAX and LOGIN_ATTEMPT_WINDOW must be positive with base <= max")
+	}
+	if c.Trash.Retention <= 0 || c.Trash.PurgeInterval <= 0 {
+		problems = append(problems, "TRASH_RETENTION and TRASH_PURGE_INTERVAL must be greater than 0")
+	}
+	if c.Storage.UploadDir == "" || c.Storage.MediaBaseURL == "" {
+		problems = append(problems, "UPLOAD_DIR and MEDIA_BASE_URL must not be empty")
+	}
+	if c.Storage.MaxImageBytes <= 0 {
+		problems = append(problems, "MAX_IMAGE_BYTES must be greater than 0")
+	}
+	if u := c.Documents.ListingURL; !strings.Contains(u, "{id}") || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+		problems = append(problems, "LISTING_URL must be an http(s) URL containing {id}")
+	}
+	if strings.TrimSpace(c.Bookings.OpeningHours) == "" {
+		problems = append(problems, "BOOKING_OPENING_HOURS must not be empty")
+	}
+	if _, err := time.LoadLocation(c.Bookings.TimeZone); err != nil {
+		problems = append(problems, fmt.Sprintf("BOOKING_TIMEZONE is not a known time zone: %q", c.Bookings.TimeZone))
+	}
+	if c.Bookings.MinDuration <= 0 || c.Bookings.MaxDuration < c.Bookings.MinDuration {
+		problems = append(problems, "BOOKING_MIN_DURATION and BOOKING_MAX_DURATION must be positive with min <= max")
+	}
+	if c.Bookings.MinNotice < 0 || c.Bookings.MaxAdvance <= c.Bookings.MinNotice {
+		problems = append(problems, "BOOKING_MIN_NOTICE must not be negative and BOOKING_MAX_ADVANCE must be longer")
+	}
+	if u := c.Bookings.FeedURL; !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+		problems = append(problems, "BOOKING_FEED_URL must be an http(s) URL")
+	}
+	if c.Holds.MaxDuration < time.Hour || c.Holds.SweepInterval <= 0 {
+		problems = append(problems, "HOLD_MAX_DURATION must be at least 1h and HOLD_SWEEP_INTERVAL greater than 0")
+	}
+	if c.Holds.MaxPerUser <= 0 {
+		problems = append(problems, "HOLD_MAX_PER_USER must be greater than 0")
+	}
+	if p := c.Sales.InvoicePrefix; p == "" || len(p) > 16 || strings.ContainsAny(p, " \t\r\n") {
+		problems = append(problems, "INVOICE_PREFIX must be 1 to 16 characters without spaces")
+	}
+	if c.Sales.PaymentTermsDays < 0 || c.Sales.PaymentTermsDays > 365 {
+		problems = append(problems, "PAYMENT_TERMS_DAYS must be between 0 and 365")
+	}
+
+	if c.IsProduction() {
+		if c.Auth.JWTSecret == DevJWTSecret || len(c.Auth.JWTSecret) < 32 {
+			problems = append(problems, "JWT_SECRET must be set to at least 32 characters in production")
+		}
+		if c.Login.CodePepper == DevOTPPepper || len(c.Login.CodePepper) < 32 {
+			problems = append(problems, "OTP_PEPPER must be set to at least 32 characters in production")
+		}
+		if c.DB.Password == "" || c.DB.Password == "postgres" {
+			problems = append(problems, "DB_PASSWORD must not use the default in production")
+		}
+		if c.DB.SSLMode == "disable" {
+			problems = append(problems, "DB_SSLMODE must not be disable in production")
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
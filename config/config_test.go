@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadEnvOverrides(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{
+		"DB_PORT":          "6543",
+		"ACCESS_TOKEN_TTL": "30m",
+		"HTTP_ADDR":        ":9000",
+	}
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.DB.Port != 6543 || cfg.Auth.AccessTokenTTL != 30*time.Minute || cfg.Server.Addr != ":9000" {
+		t.Errorf("Env overrides not applied: %+v", cfg)
+	}
+
+	// Test Invalid Integer
+	env["DB_PORT"] = "abc"
+	if err := cfg.loadEnv(func(k string) string { return env[k] }); err == nil {
+		t.Error("Expected error for non-numeric DB_PORT, got nil")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(yamlPath, []byte("db:\n  name: Inventory\n  conn_max_lifetime: 2m\n"), 0o600)
+	tomlPath := filepath.Join(dir, "config.toml")
+	os.WriteFile(tomlPath, []byte("[server]\naddr = \":8080\"\n"), 0o600)
+
+	cfg := Default()
+	if err := cfg.loadFile(yamlPath); err != nil {
+		t.Fatalf("Unexpected YAML error: %v", err)
+	}
+	if err := cfg.loadFile(tomlPath); err != nil {
+		t.Fatalf("Unexpected TOML error: %v", err)
+	}
+	if cfg.DB.Name != "Inventory" || cfg.DB.ConnMaxLifetime != 2*time.Minute || cfg.Server.Addr != ":8080" {
+		t.Errorf("File values not applied: %+v", cfg)
+	}
+	if cfg.DB.Host != "localhost" {
+		t.Errorf("Expected defaults to survive partial files, got host %q", cfg.DB.Host)
+	}
+}
+
+func TestValidateProduction(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected development defaults to be valid, got: %v", err)
+	}
+
+	cfg.Env = "production"
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected production with insecure defaults to fail, got nil")
+	}
+	for _, key := range []string{"JWT_SECRET", "OTP_PEPPER", "DB_PASSWORD", "DB_SSLMODE"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error to mention %s, got: %v", key, err)
+		}
+	}
+
+	cfg.Auth.JWTSecret = strings.Repeat("s", 32)
+	cfg.Login.CodePepper = strings.Repeat("p", 32)
+	cfg.DB.Password = "a-real-password"
+	cfg.DB.SSLMode = "require"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected secure production config to be valid, got: %v", err)
+	}
+}
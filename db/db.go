@@ -4,46 +4,25 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
-	"time"
 
-	"github.com/joho/godotenv"
+	"car-service/config"
+
 	_ "github.com/lib/pq"
 )
 
 var DB *sql.DB
 
-func InitDB() (*sql.DB, error) {
-	// Load environment variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Error loading .env file")
-	}
-
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "postgres" // Fallback
-	}
-
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
-	// Connection string
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		host, 5432, "postgres", password, "Cars")
-
-	DB, err = sql.Open("postgres", psqlInfo)
+func InitDB(cfg config.DBConfig) (*sql.DB, error) {
+	var err error
+	DB, err = sql.Open("postgres", cfg.DSN())
 	if err != nil {
 		log.Fatalf("Failed to open database connection: %v", err)
 	}
 
 	// Optimize: Connection Pooling
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(25)
-	DB.SetConnMaxLifetime(5 * time.Minute)
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxIdleConns)
+	DB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	err = DB.Ping()
 	if err != nil {
@@ -52,19 +31,6 @@ func InitDB() (*sql.DB, error) {
 
 	fmt.Println("Successfully connected to database with pooling enabled!")
 
-	// Run Migrations
-	migration, err := os.ReadFile("db/migrations.sql")
-	if err != nil {
-		log.Printf("Warning: Could not read migrations.sql: %v", err)
-	} else {
-		_, err = DB.Exec(string(migration))
-		if err != nil {
-			log.Printf("Warning: Failed to execute migrations: %v", err)
-		} else {
-			fmt.Println("Migrations executed successfully!")
-		}
-	}
-
 	return DB, nil
 }
 
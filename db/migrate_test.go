@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_vin.up.sql":   {Data: []byte("ALTER TABLE cars ADD COLUMN vin TEXT;")},
+		"m/0002_add_vin.down.sql": {Data: []byte("ALTER TABLE cars DROP COLUMN vin;")},
+		"m/0001_init.up.sql":      {Data: []byte("CREATE TABLE cars (id SERIAL);")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("Expected migrations ordered 1, 2, got %+v", migrations)
+	}
+	if migrations[1].Down == "" || migrations[0].Down != "" {
+		t.Error("Expected down SQL only for migration 2")
+	}
+	if len(migrations[0].Checksum) != 64 {
+		t.Errorf("Expected sha256 hex checksum, got %q", migrations[0].Checksum)
+	}
+
+	// Test Missing Up File
+	fsys["m/0003_orphan.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err := LoadMigrations(fsys, "m"); err == nil {
+		t.Error("Expected error for migration without up file, got nil")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("Embedded migrations are invalid: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected contiguous versions, got %d at position %d", m.Version, i)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS cars;
+DROP TABLE IF EXISTS verification_codes;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS login_throttles;
+DROP INDEX IF EXISTS idx_verification_codes_user;
+ALTER TABLE verification_codes DROP COLUMN IF EXISTS failed_attempts;
@@ -0,0 +1,14 @@
+-- Failed guesses against a code; the code is invalidated once this reaches the configured maximum
+ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS failed_attempts INT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_verification_codes_user ON verification_codes (user_id, created_at);
+
+-- Attempt counters with exponential lockout, keyed by scope (verify_email, verify_ip, request_ip)
+CREATE TABLE IF NOT EXISTS login_throttles (
+    scope VARCHAR(20) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
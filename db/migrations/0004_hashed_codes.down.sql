@@ -0,0 +1,5 @@
+DELETE FROM verification_codes;
+
+ALTER TABLE verification_codes DROP COLUMN IF EXISTS consumed_at;
+ALTER TABLE verification_codes ALTER COLUMN code_hash TYPE VARCHAR(6);
+ALTER TABLE verification_codes RENAME COLUMN code_hash TO code;
@@ -0,0 +1,6 @@
+-- Codes are now stored as an HMAC of the code; plaintext codes already issued are discarded
+DELETE FROM verification_codes;
+
+ALTER TABLE verification_codes RENAME COLUMN code TO code_hash;
+ALTER TABLE verification_codes ALTER COLUMN code_hash TYPE CHAR(64);
+ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS consumed_at TIMESTAMP WITH TIME ZONE;
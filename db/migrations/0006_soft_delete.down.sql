@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS cars_deleted_at_idx;
+DELETE FROM cars WHERE deleted_at IS NOT NULL;
+ALTER TABLE cars DROP COLUMN IF EXISTS deleted_at;
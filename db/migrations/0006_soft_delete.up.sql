@@ -0,0 +1,4 @@
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Only trashed rows are indexed: the trash listing and the scheduled purge scan them by age
+CREATE INDEX IF NOT EXISTS cars_deleted_at_idx ON cars (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Incremented on every update; used for ETags and optimistic concurrency checks
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS car_images (
+    id SERIAL PRIMARY KEY,
+    -- Purging a car detaches its photos; the trash purger then deletes the rows and their files
+    car_id INT REFERENCES cars(id) ON DELETE SET NULL,
+    blob_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    position INT NOT NULL,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS car_images_car_idx ON car_images (car_id, position);
+-- At most one primary photo per car
+CREATE UNIQUE INDEX IF NOT EXISTS car_images_primary_idx ON car_images (car_id) WHERE is_primary;
@@ -0,0 +1,8 @@
+-- Admin overrides of the built-in window sticker / listing sheet templates
+CREATE TABLE IF NOT EXISTS document_templates (
+    name VARCHAR(50) PRIMARY KEY,
+    html TEXT NOT NULL,
+    pdf TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_by INT REFERENCES users(id) ON DELETE SET NULL
+);
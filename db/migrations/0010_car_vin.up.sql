@@ -0,0 +1,6 @@
+-- Optional for existing inventory; the check digit is validated by the application
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS vin CHAR(17)
+    CONSTRAINT cars_vin_charset CHECK (vin ~ '^[A-HJ-NPR-Z0-9]{17}$');
+
+-- Unique among live cars, so a trashed car's VIN can be entered again
+CREATE UNIQUE INDEX IF NOT EXISTS cars_vin_key ON cars (vin) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS cars_search_text_trgm_idx;
+DROP INDEX IF EXISTS cars_search_vector_idx;
+ALTER TABLE cars DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE cars DROP COLUMN IF EXISTS search_text;
+-- pg_trgm is left installed; other objects may depend on it
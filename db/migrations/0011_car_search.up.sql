@@ -0,0 +1,10 @@
+-- Full-text search over the descriptive fields, plus trigrams for typo tolerance
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS search_text TEXT
+    GENERATED ALWAYS AS (lower(make || ' ' || model || ' ' || color || ' ' || year::text || ' ' || coalesce(vin, ''))) STORED;
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', make || ' ' || model || ' ' || color || ' ' || year::text || ' ' || coalesce(vin, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS cars_search_vector_idx ON cars USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS cars_search_text_trgm_idx ON cars USING GIN (search_text gin_trgm_ops);
@@ -0,0 +1,16 @@
+-- One row per price a car was given, written with the change itself
+CREATE TABLE IF NOT EXISTS car_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    car_id INT NOT NULL REFERENCES cars(id) ON DELETE CASCADE,
+    old_price DECIMAL(10, 2),
+    new_price DECIMAL(10, 2) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    changed_by INT REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS car_price_history_car_idx ON car_price_history (car_id, changed_at);
+CREATE INDEX IF NOT EXISTS car_price_history_changed_at_idx ON car_price_history (changed_at);
+
+-- Existing cars start their history at the current price
+INSERT INTO car_price_history (car_id, new_price, changed_at)
+SELECT id, price, NOW() FROM cars;
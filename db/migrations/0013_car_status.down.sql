@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS cars_status_idx;
+ALTER TABLE cars DROP COLUMN IF EXISTS status_changed_by;
+ALTER TABLE cars DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE cars DROP COLUMN IF EXISTS status;
@@ -0,0 +1,7 @@
+-- Inventory lifecycle; transitions are enforced by the application. Existing cars are on sale.
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'available'
+    CONSTRAINT cars_status_check CHECK (status IN ('draft', 'available', 'reserved', 'sold'));
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE cars ADD COLUMN IF NOT EXISTS status_changed_by INT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS cars_status_idx ON cars (status) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS test_drive_bookings;
+-- btree_gist is left installed; other objects may depend on it
@@ -0,0 +1,17 @@
+-- Test drives. The exclusion constraints make Postgres reject a booking that overlaps another
+-- live booking of the same car, or of the same customer; cancelled bookings free their slot.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS test_drive_bookings (
+    id SERIAL PRIMARY KEY,
+    car_id INT NOT NULL REFERENCES cars(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    slot TSTZRANGE NOT NULL CHECK (NOT isempty(slot) AND NOT lower_inf(slot) AND NOT upper_inf(slot)),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'cancelled')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT test_drive_bookings_car_overlap
+        EXCLUDE USING gist (car_id WITH =, slot WITH &&) WHERE (status <> 'cancelled'),
+    CONSTRAINT test_drive_bookings_user_overlap
+        EXCLUDE USING gist (user_id WITH =, slot WITH &&) WHERE (status <> 'cancelled')
+);
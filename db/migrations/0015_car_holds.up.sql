@@ -0,0 +1,16 @@
+-- Customer holds on cars. A car has at most one active (unreleased) hold, during which its
+-- status is reserved; expired holds are released by a background sweeper.
+CREATE TABLE IF NOT EXISTS car_holds (
+    id SERIAL PRIMARY KEY,
+    car_id INT NOT NULL REFERENCES cars(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    released_at TIMESTAMP WITH TIME ZONE,
+    release_reason TEXT CHECK (release_reason IN ('expired', 'released', 'status_changed')),
+    CHECK ((released_at IS NULL) = (release_reason IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS car_holds_active_car_idx ON car_holds (car_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS car_holds_active_user_idx ON car_holds (user_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS car_holds_active_expiry_idx ON car_holds (expires_at) WHERE released_at IS NULL;
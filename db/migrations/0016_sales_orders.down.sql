@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS order_payments;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS invoice_counter;
@@ -0,0 +1,48 @@
+-- Sales orders. Invoice numbers come from a single counter row that is incremented in the
+-- transaction creating the order, so a rolled back sale gives its number back and issued
+-- numbers have no gaps. Cancelled orders keep their number.
+CREATE TABLE IF NOT EXISTS invoice_counter (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    last_number INT NOT NULL
+);
+INSERT INTO invoice_counter (id, last_number) VALUES (TRUE, 0) ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    invoice_seq INT NOT NULL UNIQUE,
+    invoice_number TEXT NOT NULL UNIQUE,
+    car_id INT REFERENCES cars(id) ON DELETE SET NULL,
+    vehicle TEXT NOT NULL,
+    vin VARCHAR(17) NOT NULL DEFAULT '',
+    mileage INT NOT NULL,
+    buyer_id INT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    price DECIMAL(12, 2) NOT NULL CHECK (price > 0),
+    line_items JSONB NOT NULL DEFAULT '[]',
+    total DECIMAL(12, 2) NOT NULL,
+    amount_paid DECIMAL(12, 2) NOT NULL DEFAULT 0 CHECK (amount_paid >= 0 AND amount_paid <= total),
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'cancelled')),
+    payment_status TEXT NOT NULL DEFAULT 'unpaid'
+        CHECK (payment_status IN ('unpaid', 'partially_paid', 'paid', 'refunded')),
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    cancelled_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A car is sold at most once at a time
+CREATE UNIQUE INDEX IF NOT EXISTS orders_open_car_idx ON orders (car_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS orders_buyer_idx ON orders (buyer_id);
+
+-- Payments are recorded by hand; refunds have a negative amount
+CREATE TABLE IF NOT EXISTS order_payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount DECIMAL(12, 2) NOT NULL CHECK (amount <> 0),
+    method TEXT NOT NULL CHECK (method IN ('cash', 'card', 'bank_transfer', 'financing', 'check')),
+    reference TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    recorded_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS order_payments_order_idx ON order_payments (order_id, id);
@@ -0,0 +1,304 @@
+// Package documents renders printable documents, such as window stickers, listing sheets
+// and sales invoices, as HTML or PDF. Each document has a built-in template that admins can
+// override; overrides are stored through a repository.DocumentTemplateRepository.
+package documents
+
+import (
+	"bytes"
+	"car-service/config"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Built-in document names
+const (
+	WindowSticker = "window_sticker"
+	ListingSheet  = "listing_sheet"
+	Invoice       = "invoice"
+)
+
+// Names lists the car documents that Render accepts, in display order
+var Names = []string{WindowSticker, ListingSheet}
+
+// TemplateNames lists every document with an editable template, in display order
+var TemplateNames = []string{WindowSticker, ListingSheet, Invoice}
+
+// Format is an output format of a document
+type Format string
+
+const (
+	FormatHTML Format = "html"
+	FormatPDF  Format = "pdf"
+)
+
+// ContentType is the HTTP Content-Type of the format
+func (f Format) ContentType() string {
+	if f == FormatPDF {
+		return "application/pdf"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// ParseFormat parses a format query parameter; empty means HTML
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FormatHTML:
+		return FormatHTML, nil
+	case FormatPDF:
+		return FormatPDF, nil
+	}
+	return "", fmt.Errorf("format must be html or pdf, got %q", s)
+}
+
+var (
+	// ErrUnknownTemplate is returned for document names outside Names
+	ErrUnknownTemplate = errors.New("unknown document template")
+	// ErrInvalidTemplate is returned when a template does not parse or fails on a sample car
+	ErrInvalidTemplate = errors.New("invalid document template")
+)
+
+//go:embed templates
+var builtinFS embed.FS
+
+// Document is the data passed to every template. Both the HTML and the PDF template render
+// all pages at once, so one document can hold the stickers of many cars.
+type Document struct {
+	Dealer    string
+	PrintedAt time.Time
+	Pages     []Page
+}
+
+// Page is one car of a document
+type Page struct {
+	Car        models.Car
+	ListingURL string
+}
+
+// InvoiceDocument is the data passed to the invoice templates
+type InvoiceDocument struct {
+	Dealer    string
+	PrintedAt time.Time
+	Order     models.Order
+}
+
+// Renderer renders documents from the built-in templates or their stored overrides
+type Renderer struct {
+	Templates  repository.DocumentTemplateRepository
+	ListingURL string
+	Dealer     string
+	Now        func() time.Time
+}
+
+// NewRenderer creates a Renderer linking QR codes to cfg.ListingURL
+func NewRenderer(templates repository.DocumentTemplateRepository, cfg config.DocumentsConfig) *Renderer {
+	return &Renderer{Templates: templates, ListingURL: cfg.ListingURL, Dealer: cfg.DealerName, Now: time.Now}
+}
+
+// Builtin returns the template shipped with the service
+func Builtin(name string) (models.DocumentTemplate, error) {
+	if !known(name) {
+		return models.DocumentTemplate{}, ErrUnknownTemplate
+	}
+	html, err := builtinFS.ReadFile("templates/" + name + ".html")
+	if err != nil {
+		return models.DocumentTemplate{}, err
+	}
+	pdf, err := builtinFS.ReadFile("templates/" + name + ".pdf.txt")
+	if err != nil {
+		return models.DocumentTemplate{}, err
+	}
+	return models.DocumentTemplate{Name: name, HTML: string(html), PDF: string(pdf), Builtin: true}, nil
+}
+
+// Template returns the stored override of a document, or the built-in template
+func (r *Renderer) Template(ctx context.Context, name string) (models.DocumentTemplate, error) {
+	if !known(name) {
+		return models.DocumentTemplate{}, ErrUnknownTemplate
+	}
+	tpl, err := r.Templates.Get(ctx, name)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		return Builtin(name)
+	}
+	return tpl, err
+}
+
+// List returns the current template of every document
+func (r *Renderer) List(ctx context.Context) ([]models.DocumentTemplate, error) {
+	templates := make([]models.DocumentTemplate, 0, len(TemplateNames))
+	for _, name := range TemplateNames {
+		tpl, err := r.Template(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tpl)
+	}
+	return templates, nil
+}
+
+// Save validates and stores an override. Both templates are rendered against a sample
+// document first, so a broken template never reaches the printers.
+func (r *Renderer) Save(ctx context.Context, tpl models.DocumentTemplate) (models.DocumentTemplate, error) {
+	if !known(tpl.Name) {
+		return tpl, ErrUnknownTemplate
+	}
+	sample := r.sample(tpl.Name)
+	if err := renderHTML(io.Discard, tpl.HTML, sample); err != nil {
+		return tpl, fmt.Errorf("%w: html: %v", ErrInvalidTemplate, err)
+	}
+	if err := renderPDF(io.Discard, tpl.PDF, sample); err != nil {
+		return tpl, fmt.Errorf("%w: pdf: %v", ErrInvalidTemplate, err)
+	}
+
+	tpl.Builtin = false
+	return r.Templates.Save(ctx, tpl)
+}
+
+// Reset deletes the override of a document so the built-in template applies again
+func (r *Renderer) Reset(ctx context.Context, name string) error {
+	if !known(name) {
+		return ErrUnknownTemplate
+	}
+	err := r.Templates.Delete(ctx, name)
+	if errors.Is(err, repository.ErrTemplateNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Render writes the named car document for cars, one page per car, in the given format
+func (r *Renderer) Render(ctx context.Context, w io.Writer, name string, format Format, cars []models.Car) error {
+	if name == Invoice {
+		return fmt.Errorf("%w: invoices are rendered per order", ErrUnknownTemplate)
+	}
+	return r.render(ctx, w, name, format, r.document(cars))
+}
+
+// RenderInvoice writes the invoice of an order in the given format
+func (r *Renderer) RenderInvoice(ctx context.Context, w io.Writer, format Format, order models.Order) error {
+	return r.render(ctx, w, Invoice, format, InvoiceDocument{Dealer: r.Dealer, PrintedAt: r.Now(), Order: order})
+}
+
+func (r *Renderer) render(ctx context.Context, w io.Writer, name string, format Format, data interface{}) error {
+	tpl, err := r.Template(ctx, name)
+	if err != nil {
+		return err
+	}
+	if format == FormatPDF {
+		return renderPDF(w, tpl.PDF, data)
+	}
+	return renderHTML(w, tpl.HTML, data)
+}
+
+// sample is the data templates are checked against before they are saved
+func (r *Renderer) sample(name string) interface{} {
+	if name == Invoice {
+		rate := 8.25
+		paidAt := r.Now()
+		return InvoiceDocument{Dealer: r.Dealer, PrintedAt: r.Now(), Order: models.Order{
+			ID: 1, InvoiceNumber: "INV-000001", CarID: 1, Vehicle: "2021 Toyota Corolla", VIN: "1HGCM82633A004352", Mileage: 24500,
+			BuyerID: 2, BuyerEmail: "buyer@example.com", Price: 18500,
+			LineItems: []models.LineItem{
+				{Kind: models.LineItemFee, Description: "Documentation fee", Amount: 199},
+				{Kind: models.LineItemTax, Description: "Sales tax", Rate: &rate, Amount: 1542.67},
+			},
+			Total: 20241.67, AmountPaid: 5000, Status: models.OrderOpen, PaymentStatus: models.PaymentPartial,
+			DueAt: paidAt.AddDate(0, 0, 14), CreatedAt: paidAt,
+			Payments: []models.Payment{{ID: 1, OrderID: 1, Amount: 5000, Method: models.PaymentCard, ReceivedAt: paidAt}},
+		}}
+	}
+	return r.document([]models.Car{
+		{ID: 1, Make: "Toyota", Model: "Corolla", Year: 2021, Price: 18999.99, Color: "Silver", Mileage: 24500, VIN: "1HGCM82633A004352", Version: 1},
+		{ID: 2, Make: "Ford", Model: "F-150", Year: 2019, Price: 31250, Color: "Blue", Mileage: 61000, Version: 1},
+	})
+}
+
+func (r *Renderer) document(cars []models.Car) Document {
+	doc := Document{Dealer: r.Dealer, PrintedAt: r.Now(), Pages: make([]Page, len(cars))}
+	for i, car := range cars {
+		doc.Pages[i] = Page{Car: car, ListingURL: strings.ReplaceAll(r.ListingURL, "{id}", strconv.Itoa(car.ID))}
+	}
+	return doc
+}
+
+func known(name string) bool {
+	for _, n := range TemplateNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// funcs are available to both HTML and PDF templates
+var funcs = map[string]interface{}{
+	"money":   money,
+	"number":  number,
+	"date":    func(t time.Time) string { return t.Format("Jan 2, 2006") },
+	"upper":   strings.ToUpper,
+	"percent": func(rate float64) string { return strconv.FormatFloat(rate, 'f', -1, 64) + "%" },
+}
+
+func renderHTML(w io.Writer, src string, data interface{}) error {
+	t, err := htmltemplate.New("html").Funcs(funcs).Funcs(htmltemplate.FuncMap{"qr": qrDataURL}).Parse(src)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+func renderPDF(w io.Writer, src string, data interface{}) error {
+	t, err := texttemplate.New("pdf").Funcs(funcs).Parse(src)
+	if err != nil {
+		return err
+	}
+	var layout bytes.Buffer
+	if err := t.Execute(&layout, data); err != nil {
+		return err
+	}
+	return writePDF(w, layout.String())
+}
+
+// qrDataURL encodes url as a PNG QR code inlined as a data: URL, for <img src>
+func qrDataURL(url string) (htmltemplate.URL, error) {
+	png, err := qrcode.Encode(url, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return htmltemplate.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// money formats a price as $12,345.67
+func money(price float64) string {
+	cents := int64(math.Round(price * 100))
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s$%s.%02d", sign, number(int(cents/100)), cents%100)
+}
+
+// number formats an integer with thousands separators
+func number(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + number(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package documents
+
+import (
+	"bytes"
+	"car-service/config"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRenderer() *Renderer {
+	r := NewRenderer(repository.NewMemoryDocumentTemplateRepository(), config.DocumentsConfig{
+		ListingURL: "https://cars.example.com/listing/{id}",
+		DealerName: "Test Motors",
+	})
+	r.Now = func() time.Time { return time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) }
+	return r
+}
+
+var testCars = []models.Car{
+	{ID: 7, Make: "Honda", Model: "Civic", Year: 2020, Price: 21450.5, Color: "Red", Mileage: 32100, VIN: "JH4KA7561PC008269"},
+	{ID: 8, Make: "Mazda", Model: "CX-5", Year: 2022, Price: 28999, Color: "Grey", Mileage: 9000},
+}
+
+func TestRenderHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestRenderer().Render(context.Background(), &buf, WindowSticker, FormatHTML, testCars); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{"2020 Honda Civic", "$21,450.50", "32,100 mi", "JH4KA7561PC008269", "2022 Mazda CX-5", "data:image/png;base64,", "Test Motors", "Mar 1, 2024"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML does not contain %q", want)
+		}
+	}
+	if n := strings.Count(html, `class="sheet"`); n != 2 {
+		t.Errorf("Expected 2 sheets, got %d", n)
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	for _, name := range Names {
+		var buf bytes.Buffer
+		if err := newTestRenderer().Render(context.Background(), &buf, name, FormatPDF, testCars); err != nil {
+			t.Fatalf("Render %s failed: %v", name, err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+			t.Fatalf("%s: output is not a PDF", name)
+		}
+		if n := bytes.Count(buf.Bytes(), []byte("/Type /Page\n")); n != 2 {
+			t.Errorf("%s: expected 2 pages, got %d", name, n)
+		}
+	}
+}
+
+func TestSaveTemplate(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRenderer()
+
+	tpl, _ := Builtin(WindowSticker)
+	tpl.HTML = "<p>{{range .Pages}}{{.Car.Make}} {{money .Car.Price}};{{end}}</p>"
+	if _, err := r.Save(ctx, tpl); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Render(ctx, &buf, WindowSticker, FormatHTML, testCars[:1]); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if got := buf.String(); got != "<p>Honda $21,450.50;</p>" {
+		t.Errorf("Expected the override to be used, got %q", got)
+	}
+
+	if err := r.Reset(ctx, WindowSticker); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if tpl, _ := r.Template(ctx, WindowSticker); !tpl.Builtin {
+		t.Error("Expected the built-in template after reset")
+	}
+}
+
+func TestSaveTemplateRejectsBrokenTemplates(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRenderer()
+	tpl, _ := Builtin(ListingSheet)
+
+	broken := []models.DocumentTemplate{
+		{Name: ListingSheet, HTML: "{{range .Pages}}", PDF: tpl.PDF},
+		{Name: ListingSheet, HTML: tpl.HTML, PDF: "{{.Car.Make}}"}, // .Car is on pages, not the document
+	}
+	for _, b := range broken {
+		if _, err := r.Save(ctx, b); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("Expected ErrInvalidTemplate, got %v", err)
+		}
+	}
+	if _, err := r.Save(ctx, models.DocumentTemplate{Name: "brochure"}); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Expected ErrUnknownTemplate, got %v", err)
+	}
+	if tpl, _ := r.Template(ctx, ListingSheet); !tpl.Builtin {
+		t.Error("A rejected template must not be stored")
+	}
+}
+
+func TestRenderInvoice(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRenderer()
+	rate := 6.5
+	order := models.Order{
+		InvoiceNumber: "INV-000042", Vehicle: "2020 Honda Civic", VIN: "JH4KA7561PC008269", Mileage: 32100,
+		BuyerEmail: "buyer@example.com", Price: 20000, Status: models.OrderOpen,
+		LineItems: []models.LineItem{
+			{Kind: models.LineItemFee, Description: "Documentation fee", Amount: 150},
+			{Kind: models.LineItemTax, Description: "Sales tax", Rate: &rate},
+		},
+		Payments:  []models.Payment{{Amount: 5000, Method: models.PaymentCard, ReceivedAt: r.Now()}},
+		CreatedAt: r.Now(), DueAt: r.Now().AddDate(0, 0, 14),
+	}
+	order.PriceItems()
+	order.AmountPaid = 5000
+
+	var buf bytes.Buffer
+	if err := r.RenderInvoice(ctx, &buf, FormatHTML, order); err != nil {
+		t.Fatalf("RenderInvoice failed: %v", err)
+	}
+	for _, want := range []string{"Invoice INV-000042", "buyer@example.com", "$20,150.00", "Sales tax (6.5%)", "$1,309.75", "$21,459.75", "$16,459.75", "Mar 15, 2024"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Invoice does not contain %q", want)
+		}
+	}
+
+	buf.Reset()
+	if err := r.RenderInvoice(ctx, &buf, FormatPDF, order); err != nil || !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("Expected a PDF, got %v", err)
+	}
+	if err := r.Render(ctx, &buf, Invoice, FormatHTML, testCars); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Expected Render to refuse the invoice template, got %v", err)
+	}
+}
+
+func TestMoney(t *testing.T) {
+	cases := map[float64]string{0: "$0.00", 999.999: "$1,000.00", 1234567.8: "$1,234,567.80", -12.5: "-$12.50"}
+	for in, want := range cases {
+		if got := money(in); got != want {
+			t.Errorf("money(%v) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// PDF templates produce a small line-based layout rather than HTML, which keeps the
+// rendering pure Go. Each line of the executed template is one of:
+//
+//	# Title              large bold line
+//	## Heading           medium bold line
+//	Label | Value        two-column row, label in bold
+//	---                  horizontal rule
+//	[qr https://...]     QR code of the URL, 40 mm wide
+//	[page]               start a new page
+//	(empty line)         vertical space
+//	anything else        a paragraph, wrapped to the page width
+const (
+	pdfMargin    = 18.0
+	pdfLabelWide = 55.0
+	pdfQRSize    = 40.0
+)
+
+func writePDF(w io.Writer, layout string) error {
+	pdf := gofpdf.New("P", "mm", "Letter", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	// The core fonts are cp1252; translate the UTF-8 template output
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	textWidth := pageWidth - 2*pdfMargin
+	qrCount := 0
+
+	pdf.AddPage()
+	for _, line := range strings.Split(layout, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			pdf.Ln(4)
+		case trimmed == "[page]":
+			pdf.AddPage()
+		case trimmed == "---":
+			y := pdf.GetY() + 2
+			pdf.Line(pdfMargin, y, pageWidth-pdfMargin, y)
+			pdf.SetY(y + 2)
+		case strings.HasPrefix(trimmed, "[qr ") && strings.HasSuffix(trimmed, "]"):
+			url := strings.TrimSpace(trimmed[4 : len(trimmed)-1])
+			png, err := qrcode.Encode(url, qrcode.Medium, 512)
+			if err != nil {
+				return fmt.Errorf("qr code for %q: %v", url, err)
+			}
+			qrCount++
+			name := fmt.Sprintf("qr%d", qrCount)
+			pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+			pdf.ImageOptions(name, pdfMargin, -1, pdfQRSize, pdfQRSize, true, gofpdf.ImageOptions{ImageType: "PNG"}, 0, url)
+		case strings.HasPrefix(trimmed, "## "):
+			pdf.SetFont("Helvetica", "B", 16)
+			pdf.MultiCell(textWidth, 8, tr(trimmed[3:]), "", "L", false)
+		case strings.HasPrefix(trimmed, "# "):
+			pdf.SetFont("Helvetica", "B", 24)
+			pdf.MultiCell(textWidth, 11, tr(trimmed[2:]), "", "L", false)
+		case strings.Contains(trimmed, " | "):
+			parts := strings.SplitN(trimmed, " | ", 2)
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.CellFormat(pdfLabelWide, 7, tr(parts[0]), "", 0, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "", 12)
+			pdf.MultiCell(textWidth-pdfLabelWide, 7, tr(parts[1]), "", "L", false)
+		default:
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(textWidth, 6, tr(trimmed), "", "L", false)
+		}
+		if err := pdf.Error(); err != nil {
+			return err
+		}
+	}
+	return pdf.Output(w)
+}
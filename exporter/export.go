@@ -0,0 +1,257 @@
+package exporter
+
+import (
+	"bufio"
+	"car-service/models"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Columns are the car fields an export can contain, in their default order. They match the
+// importer's field names, so an export can be loaded back with POST /cars/import; status is
+// reported as an ignored column there, since it only changes through transitions.
+var Columns = []string{"id", "make", "model", "year", "price", "color", "mileage", "vin", "status"}
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+// ContentType is the HTTP Content-Type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// ParseFormat parses a format query parameter; empty means CSV
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("format must be csv, ndjson or xlsx, got %q", s)
+}
+
+// ParseColumns parses "make,model,price" into a column list; empty means every column
+func ParseColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return Columns, nil
+	}
+	var columns []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		col := strings.ToLower(strings.TrimSpace(part))
+		if col == "" {
+			continue
+		}
+		if !isColumn(col) {
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", part, strings.Join(Columns, ", "))
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("column %q is listed twice", col)
+		}
+		seen[col] = true
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		return Columns, nil
+	}
+	return columns, nil
+}
+
+func isColumn(name string) bool {
+	for _, c := range Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns a column of a car with its natural type
+func value(car models.Car, column string) interface{} {
+	switch column {
+	case "id":
+		return car.ID
+	case "make":
+		return car.Make
+	case "model":
+		return car.Model
+	case "year":
+		return car.Year
+	case "price":
+		return car.Price
+	case "color":
+		return car.Color
+	case "mileage":
+		return car.Mileage
+	case "vin":
+		return car.VIN
+	case "status":
+		return car.Status
+	}
+	return nil
+}
+
+// Writer encodes cars one at a time. Close must be called to finish the file.
+type Writer interface {
+	Write(car models.Car) error
+	Close() error
+}
+
+// NewWriter starts an export of the given columns to w. CSV and NDJSON rows reach w as they
+// are written; XLSX rows are spooled to a temporary file by the stream writer and the
+// workbook is written to w on Close.
+func NewWriter(w io.Writer, format Format, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := &csvWriter{w: csv.NewWriter(w), columns: columns}
+		return cw, cw.header()
+	case FormatNDJSON:
+		return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvWriter) header() error {
+	return c.w.Write(c.columns)
+}
+
+func (c *csvWriter) Write(car models.Car) error {
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		switch v := value(car, col).(type) {
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			record[i] = strconv.Itoa(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ndjsonWriter writes one object per line with the keys in column order
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (n *ndjsonWriter) Write(car models.Car) error {
+	n.w.WriteByte('{')
+	for i, col := range n.columns {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		val, err := json.Marshal(value(car, col))
+		if err != nil {
+			return err
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		n.w.Write(val)
+	}
+	n.w.WriteString("}\n")
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+const xlsxSheet = "Cars"
+
+type xlsxWriter struct {
+	out     io.Writer
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	columns []string
+	row     int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", xlsxSheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	stream, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	x := &xlsxWriter{out: w, file: f, stream: stream, columns: columns, row: 1}
+
+	header := make([]interface{}, len(columns))
+	for i, col := range columns {
+		header[i] = col
+	}
+	if err := stream.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := x.setRow(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter) setRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	x.row++
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) Write(car models.Car) error {
+	values := make([]interface{}, len(x.columns))
+	for i, col := range x.columns {
+		values[i] = value(car, col)
+	}
+	return x.setRow(values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := x.file.WriteTo(x.out)
+	return err
+}
@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"bytes"
+	"car-service/models"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var testCars = []models.Car{
+	{ID: 1, Make: "Honda", Model: "Accord", Year: 2003, Price: 4000.5, Color: "Black, metallic", Mileage: 150000, VIN: "1HGCM82633A004352", Status: "available"},
+	{ID: 2, Make: "BMW", Model: "M3", Year: 2023, Price: 70000, Color: "Blue", Status: "sold"},
+}
+
+func export(t *testing.T, format Format, columns []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, columns)
+	if err != nil {
+		t.Fatalf("Failed to start export: %v", err)
+	}
+	for _, car := range testCars {
+		if err := w.Write(car); err != nil {
+			t.Fatalf("Failed to write car: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to finish export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportCSV(t *testing.T) {
+	got := string(export(t, FormatCSV, Columns))
+	want := "id,make,model,year,price,color,mileage,vin,status\n" +
+		"1,Honda,Accord,2003,4000.5,\"Black, metallic\",150000,1HGCM82633A004352,available\n" +
+		"2,BMW,M3,2023,70000,Blue,0,,sold\n"
+	if got != want {
+		t.Errorf("Unexpected CSV:\n%s", got)
+	}
+}
+
+func TestExportNDJSONKeepsColumnOrder(t *testing.T) {
+	columns, err := ParseColumns("price, make")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := string(export(t, FormatNDJSON, columns))
+	want := "{\"price\":4000.5,\"make\":\"Honda\"}\n{\"price\":70000,\"make\":\"BMW\"}\n"
+	if got != want {
+		t.Errorf("Unexpected NDJSON:\n%s", got)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	data := export(t, FormatXLSX, []string{"model", "price"})
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Cars")
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != "model,price" || strings.Join(rows[1], ",") != "Accord,4000.5" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+}
+
+func TestParseColumnsRejectsUnknownAndDuplicates(t *testing.T) {
+	for _, s := range []string{"make,owner", "make,Make"} {
+		if _, err := ParseColumns(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+	if columns, _ := ParseColumns(" "); len(columns) != len(Columns) {
+		t.Errorf("Expected every column by default, got %v", columns)
+	}
+}
@@ -0,0 +1,196 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditEventFilterInput mirrors repository.AuditFilter
+var AuditEventFilterInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "AuditEventFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"actorId":  &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"action":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"entity":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"entityId": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"since":    &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"until":    &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		},
+	},
+)
+
+// AuditEventType is one audit log entry; before/after are JSON strings of the changed fields
+var AuditEventType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditEvent",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"actorId":   &graphql.Field{Type: graphql.Int},
+			"action":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"entity":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"entityId":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"before":    &graphql.Field{Type: graphql.String},
+			"after":     &graphql.Field{Type: graphql.String},
+			"requestId": &graphql.Field{Type: graphql.String},
+			"ip":        &graphql.Field{Type: graphql.String},
+			"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	},
+)
+
+// AuditEventEdgeType pairs an audit event with its cursor
+var AuditEventEdgeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditEventEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: AuditEventType},
+		},
+	},
+)
+
+// AuditEventConnectionType is a page of the audit log, newest first
+var AuditEventConnectionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuditEventConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewList(AuditEventEdgeType)},
+			"nodes":    &graphql.Field{Type: graphql.NewList(AuditEventType)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(PageInfoType)},
+		},
+	},
+)
+
+type auditEventNode struct {
+	ID        string    `json:"id"`
+	ActorID   *int      `json:"actorId"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityID  int       `json:"entityId"`
+	Before    *string   `json:"before"`
+	After     *string   `json:"after"`
+	RequestID string    `json:"requestId"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type auditEventEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   auditEventNode `json:"node"`
+}
+
+type auditEventConnection struct {
+	Edges    []auditEventEdge `json:"edges"`
+	Nodes    []auditEventNode `json:"nodes"`
+	PageInfo pageInfo         `json:"pageInfo"`
+}
+
+func newAuditEventNode(ev models.AuditEvent) auditEventNode {
+	n := auditEventNode{
+		ID:        fmt.Sprint(ev.ID),
+		ActorID:   ev.ActorID,
+		Action:    ev.Action,
+		Entity:    ev.Entity,
+		EntityID:  ev.EntityID,
+		RequestID: ev.RequestID,
+		IP:        ev.IP,
+		CreatedAt: ev.CreatedAt,
+	}
+	if ev.Before != nil {
+		s := string(ev.Before)
+		n.Before = &s
+	}
+	if ev.After != nil {
+		s := string(ev.After)
+		n.After = &s
+	}
+	return n
+}
+
+// auditEventsField lists the audit log for admins, newest first
+func auditEventsField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: AuditEventConnectionType,
+		Args: graphql.FieldConfigArgument{
+			"filter": &graphql.ArgumentConfig{Type: AuditEventFilterInput},
+			"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultAuditPageSize},
+			"after":  &graphql.ArgumentConfig{Type: graphql.String},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+
+			first, _ := p.Args["first"].(int)
+			if first < 0 || first > maxAuditPageSize {
+				return nil, fmt.Errorf("first must be between 0 and %d", maxAuditPageSize)
+			}
+			var afterID int64
+			if after, ok := p.Args["after"].(string); ok {
+				id, err := repository.DecodeAuditCursor(after)
+				if err != nil {
+					return nil, errors.New("invalid after cursor")
+				}
+				afterID = id
+			}
+
+			// One extra row tells us whether another page exists
+			events, err := res.Audit.List(p.Context, parseAuditFilter(p.Args["filter"]), first+1, afterID)
+			if err != nil {
+				return nil, err
+			}
+
+			conn := auditEventConnection{}
+			conn.PageInfo.HasPreviousPage = afterID > 0
+			if len(events) > first {
+				conn.PageInfo.HasNextPage = true
+				events = events[:first]
+			}
+			for _, ev := range events {
+				node := newAuditEventNode(ev)
+				conn.Nodes = append(conn.Nodes, node)
+				conn.Edges = append(conn.Edges, auditEventEdge{Cursor: repository.EncodeAuditCursor(ev.ID), Node: node})
+			}
+			if len(conn.Edges) > 0 {
+				conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+				conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+			}
+			return conn, nil
+		},
+	}
+}
+
+func parseAuditFilter(arg interface{}) repository.AuditFilter {
+	var f repository.AuditFilter
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return f
+	}
+	f.Action, _ = m["action"].(string)
+	f.Entity, _ = m["entity"].(string)
+	if v, ok := m["actorId"].(int); ok {
+		f.ActorID = &v
+	}
+	if v, ok := m["entityId"].(int); ok {
+		f.EntityID = &v
+	}
+	if v, ok := m["since"].(time.Time); ok {
+		f.Since = &v
+	}
+	if v, ok := m["until"].(time.Time); ok {
+		f.Until = &v
+	}
+	return f
+}
@@ -0,0 +1,59 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/repository"
+	"context"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestMutationsWriteAuditEvents(t *testing.T) {
+	audit := repository.NewMemoryAuditRepository()
+	repo := repository.NewMemoryCarRepository()
+	repo.Audit = audit
+	schema, err := InitSchema(&Resolver{Cars: repo, Audit: audit})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	ctx := context.WithValue(adminContext(), middleware.ClientIPKey, "10.0.0.1")
+
+	for _, mutation := range []string{
+		`mutation { createCar(make: "Tesla", model: "3", year: 2023, price: 40000, color: "White", mileage: 0) { id } }`,
+		`mutation { updateCar(id: 1, price: 38000) { id } }`,
+	} {
+		result := graphql.Do(graphql.Params{Schema: schema, RequestString: mutation, Context: ctx})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+	}
+
+	query := `{ auditEvents(first: 1) { nodes { actorId action entityId before after ip } pageInfo { hasNextPage } } }`
+
+	// Anonymous callers cannot read the log
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: query, Context: context.Background()})
+	if len(result.Errors) == 0 {
+		t.Error("Expected unauthorized error, got nil")
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, RequestString: query, Context: ctx})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	conn := result.Data.(map[string]interface{})["auditEvents"].(map[string]interface{})
+	nodes := conn["nodes"].([]interface{})
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(nodes))
+	}
+	ev := nodes[0].(map[string]interface{})
+	if ev["action"] != repository.ActionCarUpdate || ev["actorId"] != 1 || ev["ip"] != "10.0.0.1" {
+		t.Errorf("Unexpected newest event: %v", ev)
+	}
+	if ev["before"] != `{"price":40000,"version":1}` || ev["after"] != `{"price":38000,"version":2}` {
+		t.Errorf("Expected only the price and version in the diff, got before=%v after=%v", ev["before"], ev["after"])
+	}
+	if !conn["pageInfo"].(map[string]interface{})["hasNextPage"].(bool) {
+		t.Error("Expected the create event on a next page")
+	}
+}
@@ -0,0 +1,296 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// AuthPayloadType is returned by verifyLogin and refreshToken
+var AuthPayloadType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "AuthPayload",
+		Fields: graphql.Fields{
+			"accessToken":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"accessTokenExpiresAt":  &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"refreshToken":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"refreshTokenExpiresAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	},
+)
+
+type authPayload struct {
+	AccessToken           string    `json:"accessToken"`
+	AccessTokenExpiresAt  time.Time `json:"accessTokenExpiresAt"`
+	RefreshToken          string    `json:"refreshToken"`
+	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
+}
+
+// authPayload signs a fresh access token to go with the given refresh token
+func (res *Resolver) authPayload(userID int, role, refresh string, refreshExpiry time.Time) (authPayload, error) {
+	token, err := res.Tokens.GenerateToken(userID, role)
+	if err != nil {
+		return authPayload{}, fmt.Errorf("failed to generate token: %v", err)
+	}
+	return authPayload{
+		AccessToken:           token,
+		AccessTokenExpiresAt:  time.Now().Add(res.Tokens.AccessTokenTTL()),
+		RefreshToken:          refresh,
+		RefreshTokenExpiresAt: refreshExpiry,
+	}, nil
+}
+
+// verifyPolicy locks an email or IP out after repeated failed verifyLogin attempts
+func (res *Resolver) verifyPolicy() repository.LockoutPolicy {
+	return repository.LockoutPolicy{
+		Threshold: res.Login.MaxFailures,
+		Base:      res.Login.LockoutBase,
+		Max:       res.Login.LockoutMax,
+		Window:    res.Login.AttemptWindow,
+	}
+}
+
+// requestPolicy limits how many codes one IP can request, whatever the email
+func (res *Resolver) requestPolicy() repository.LockoutPolicy {
+	policy := res.verifyPolicy()
+	policy.Threshold = res.Login.MaxRequestsPerIP
+	return policy
+}
+
+// checkLocked returns a RATE_LIMITED error while the key is locked out
+func (res *Resolver) checkLocked(ctx context.Context, scope, key string) error {
+	until, err := res.Throttle.LockedUntil(ctx, scope, key)
+	if err != nil {
+		return fmt.Errorf("failed to check login attempts: %v", err)
+	}
+	if !until.IsZero() {
+		return rateLimitedError(time.Until(until), "too many attempts, try again later")
+	}
+	return nil
+}
+
+// recordVerifyFailure counts a failed verifyLogin against both the email and the IP
+func (res *Resolver) recordVerifyFailure(ctx context.Context, email, ip string) {
+	if _, err := res.Throttle.Record(ctx, repository.ScopeVerifyEmail, email, res.verifyPolicy()); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", email, err)
+	}
+	if _, err := res.Throttle.Record(ctx, repository.ScopeVerifyIP, ip, res.verifyPolicy()); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", ip, err)
+	}
+}
+
+// codeLimits bounds how often login codes can be requested and guessed
+func (res *Resolver) codeLimits() repository.CodeLimits {
+	return repository.CodeLimits{
+		MaxAttempts:    res.Login.CodeMaxAttempts,
+		MaxOutstanding: res.Login.MaxOutstandingCodes,
+		ResendCooldown: res.Login.ResendCooldown,
+	}
+}
+
+// throttleKey normalises emails so "A@x.com" and "a@x.com " share one counter
+func throttleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// requestLoginField emails a one-time login code, registering the user on first use
+func requestLoginField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.String,
+		Args: graphql.FieldConfigArgument{
+			"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			email, _ := p.Args["email"].(string)
+			ip := middleware.ClientIP(p.Context)
+
+			// 1. Refuse locked-out callers, then count this request against the IP
+			if err := res.checkLocked(p.Context, repository.ScopeRequestIP, ip); err != nil {
+				return nil, err
+			}
+			if err := res.checkLocked(p.Context, repository.ScopeVerifyEmail, throttleKey(email)); err != nil {
+				return nil, err
+			}
+			if _, err := res.Throttle.Record(p.Context, repository.ScopeRequestIP, ip, res.requestPolicy()); err != nil {
+				return nil, fmt.Errorf("failed to record login request: %v", err)
+			}
+
+			// 2. Register the user on first use and store the code, within the resend cooldown
+			// and outstanding code limits; only the code's keyed hash is stored
+			code, err := utils.GenerateOTP(res.Login.CodeLength)
+			if err != nil {
+				return nil, err
+			}
+			_, err = res.LoginCodes.Issue(p.Context, email, res.codeLimits(), time.Now().Add(res.Login.CodeTTL),
+				func(userID int) string { return utils.HashOTP(res.Login.CodePepper, userID, code) })
+			var limited *repository.CodeRequestError
+			if errors.As(err, &limited) {
+				return nil, rateLimitedError(limited.Wait, "%s", limited.Reason)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to save code: %v", err)
+			}
+
+			// 3. Send Email
+			err = res.Mailer.SendOTP(email, code)
+			if err != nil {
+				return nil, fmt.Errorf("failed to send email: %v", err)
+			}
+
+			return "Verification code sent to email", nil
+		},
+	}
+}
+
+// verifyLoginField exchanges an emailed code for an access token and a refresh token
+func verifyLoginField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: AuthPayloadType,
+		Args: graphql.FieldConfigArgument{
+			"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			"code":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			email, _ := p.Args["email"].(string)
+			code, _ := p.Args["code"].(string)
+			ip := middleware.ClientIP(p.Context)
+			key := throttleKey(email)
+
+			// 1. Refuse while the email or the IP is locked out
+			if err := res.checkLocked(p.Context, repository.ScopeVerifyEmail, key); err != nil {
+				return nil, err
+			}
+			if err := res.checkLocked(p.Context, repository.ScopeVerifyIP, ip); err != nil {
+				return nil, err
+			}
+
+			// 2. Get User ID and Role
+			userID, role, err := res.LoginCodes.User(p.Context, email)
+			if errors.Is(err, repository.ErrUserNotFound) {
+				res.recordVerifyFailure(p.Context, key, ip)
+				return nil, errors.New("user not found")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify code: %v", err)
+			}
+
+			// 3. Verify Code against every unused code of the user (codes that used up their attempts no longer match)
+			match, err := res.matchCode(p.Context, userID, code)
+			if err != nil {
+				return nil, err
+			}
+			if match.ID == 0 {
+				// Every live code of the user absorbs the failed guess
+				if err := res.LoginCodes.RecordFailure(p.Context, userID); err != nil {
+					log.Printf("Failed to record code failure for user %d: %v", userID, err)
+				}
+				res.recordVerifyFailure(p.Context, key, ip)
+				return nil, errors.New("invalid code")
+			}
+
+			if time.Now().After(match.ExpiresAt) {
+				return nil, errors.New("code expired")
+			}
+
+			// 4. Consume the code (only one concurrent request can win) and reset the email's failure counter
+			consumed, err := res.LoginCodes.Consume(p.Context, match.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to consume code: %v", err)
+			}
+			if !consumed {
+				return nil, errors.New("invalid code")
+			}
+			_ = res.Throttle.Reset(p.Context, repository.ScopeVerifyEmail, key)
+
+			// 5. Start a new session: access JWT with Role plus the first refresh token of a new family
+			familyID, err := utils.RandomToken(24) // 32 characters
+			if err != nil {
+				return nil, fmt.Errorf("failed to start session: %v", err)
+			}
+			refresh, hash, refreshExpiry, err := res.Tokens.NewRefreshToken()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+			}
+			if err := res.Sessions.Create(p.Context, userID, familyID, hash, refreshExpiry); err != nil {
+				return nil, fmt.Errorf("failed to save refresh token: %v", err)
+			}
+
+			return res.authPayload(userID, role, refresh, refreshExpiry)
+		},
+	}
+}
+
+// refreshTokenField rotates a refresh token: the presented one is revoked and a new pair issued.
+// Presenting an already-rotated token revokes the whole session.
+func refreshTokenField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: AuthPayloadType,
+		Args: graphql.FieldConfigArgument{
+			"refreshToken": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			oldToken, _ := p.Args["refreshToken"].(string)
+
+			refresh, hash, refreshExpiry, err := res.Tokens.NewRefreshToken()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+			}
+			session, err := res.Sessions.Rotate(p.Context, utils.HashRefreshToken(oldToken), hash, refreshExpiry)
+			if errors.Is(err, repository.ErrTokenInvalid) || errors.Is(err, repository.ErrTokenReused) {
+				return nil, err
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to rotate refresh token: %v", err)
+			}
+
+			return res.authPayload(session.UserID, session.Role, refresh, refreshExpiry)
+		},
+	}
+}
+
+// logoutField revokes the session the refresh token belongs to
+func logoutField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"refreshToken": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			token, _ := p.Args["refreshToken"].(string)
+			err := res.Sessions.RevokeFamily(p.Context, utils.HashRefreshToken(token))
+			if errors.Is(err, repository.ErrTokenInvalid) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+	}
+}
+
+// matchCode returns the user's unused code matching the submitted one, or a zero LoginCode if none does.
+// Hashes are compared in constant time so response timing does not leak how close a guess was.
+func (res *Resolver) matchCode(ctx context.Context, userID int, code string) (repository.LoginCode, error) {
+	codes, err := res.LoginCodes.Codes(ctx, userID, res.Login.CodeMaxAttempts)
+	if err != nil {
+		return repository.LoginCode{}, fmt.Errorf("failed to verify code: %v", err)
+	}
+
+	var match repository.LoginCode
+	for _, c := range codes {
+		// Keep checking after a match so every code costs the same
+		if utils.VerifyOTP(res.Login.CodePepper, userID, code, c.Hash) && match.ID == 0 {
+			match = c
+		}
+	}
+	return match, nil
+}
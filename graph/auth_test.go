@@ -0,0 +1,195 @@
+package graph
+
+import (
+	"car-service/config"
+	"car-service/middleware"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	sessions := repository.NewMemorySessionRepository()
+	tokens := utils.NewTokenManager(config.Default().Auth)
+	schema, err := InitSchema(&Resolver{Cars: repository.NewMemoryCarRepository(), Sessions: sessions, Tokens: tokens})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	original, hash, expiry, _ := tokens.NewRefreshToken()
+	sessions.Create(context.Background(), 7, "family-1", hash, expiry)
+
+	refresh := func(token string) *graphql.Result {
+		return graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  `mutation($t: String!) { refreshToken(refreshToken: $t) { accessToken refreshToken } }`,
+			VariableValues: map[string]interface{}{"t": token},
+			Context:        context.Background(),
+		})
+	}
+
+	result := refresh(original)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	payload := result.Data.(map[string]interface{})["refreshToken"].(map[string]interface{})
+	rotated := payload["refreshToken"].(string)
+	if rotated == original {
+		t.Fatal("Expected a new refresh token after rotation")
+	}
+	if token, err := tokens.ValidateToken(payload["accessToken"].(string)); err != nil || !token.Valid {
+		t.Errorf("Expected a valid access token, got %v", err)
+	}
+
+	// Test Reuse Of The Rotated Token Revokes The Family
+	if result := refresh(original); len(result.Errors) == 0 {
+		t.Fatal("Expected reuse of a rotated token to fail")
+	}
+	if result := refresh(rotated); len(result.Errors) == 0 {
+		t.Error("Expected the successor token to be revoked after reuse detection")
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	sessions := repository.NewMemorySessionRepository()
+	hash := utils.HashRefreshToken("stale")
+	sessions.Create(context.Background(), 7, "family-1", hash, time.Now().Add(-time.Minute))
+
+	if _, err := sessions.Rotate(context.Background(), hash, "next", time.Now().Add(time.Hour)); err != repository.ErrTokenInvalid {
+		t.Errorf("Expected ErrTokenInvalid for an expired token, got %v", err)
+	}
+}
+
+// newLoginSchema builds a schema with in-memory login stores and the given login settings
+func newLoginSchema(t *testing.T, login config.LoginConfig) (graphql.Schema, *repository.MemoryLoginCodeRepository) {
+	t.Helper()
+	codes := repository.NewMemoryLoginCodeRepository()
+	cfg := config.Default()
+	schema, err := InitSchema(&Resolver{
+		Cars:       repository.NewMemoryCarRepository(),
+		Sessions:   repository.NewMemorySessionRepository(),
+		Throttle:   repository.NewMemoryLoginThrottleRepository(),
+		LoginCodes: codes,
+		Tokens:     utils.NewTokenManager(cfg.Auth),
+		Mailer:     utils.NewMailer(cfg.SMTP),
+		Login:      login,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return schema, codes
+}
+
+func loginContext(ip string) context.Context {
+	return context.WithValue(context.Background(), middleware.ClientIPKey, ip)
+}
+
+func errorCode(result *graphql.Result) interface{} {
+	if len(result.Errors) != 1 {
+		return nil
+	}
+	return result.Errors[0].Extensions["code"]
+}
+
+func TestRequestLoginLimits(t *testing.T) {
+	login := config.Default().Login
+	login.ResendCooldown = time.Hour
+	schema, _ := newLoginSchema(t, login)
+	request := func(ip, email string) *graphql.Result {
+		return graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  `mutation($e: String!) { requestLogin(email: $e) }`,
+			VariableValues: map[string]interface{}{"e": email},
+			Context:        loginContext(ip),
+		})
+	}
+
+	if result := request("10.0.0.1", "a@example.com"); len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	result := request("10.0.0.1", "a@example.com")
+	if errorCode(result) != CodeRateLimited || result.Errors[0].Extensions["retryAfter"].(int) <= 0 {
+		t.Errorf("Expected the resend cooldown to apply, got %v", result.Errors)
+	}
+
+	// Without a cooldown, the number of unused codes is capped
+	login.ResendCooldown = 0
+	login.MaxOutstandingCodes = 2
+	schema, _ = newLoginSchema(t, login)
+	for i := 0; i < 2; i++ {
+		if result := request("10.0.0.1", "b@example.com"); len(result.Errors) > 0 {
+			t.Fatalf("Unexpected errors: %v", result.Errors)
+		}
+	}
+	if result := request("10.0.0.1", "b@example.com"); errorCode(result) != CodeRateLimited {
+		t.Errorf("Expected the outstanding code cap to apply, got %v", result.Errors)
+	}
+
+	// One IP can only request so many codes, whatever the email
+	login.MaxOutstandingCodes = 3
+	login.MaxRequestsPerIP = 3
+	schema, _ = newLoginSchema(t, login)
+	for i, email := range []string{"c@example.com", "d@example.com", "e@example.com"} {
+		if result := request("10.0.0.2", email); len(result.Errors) > 0 {
+			t.Fatalf("Request %d: unexpected errors: %v", i, result.Errors)
+		}
+	}
+	if result := request("10.0.0.2", "f@example.com"); errorCode(result) != CodeRateLimited {
+		t.Errorf("Expected the IP to be locked out, got %v", result.Errors)
+	}
+	if result := request("10.0.0.3", "f@example.com"); len(result.Errors) > 0 {
+		t.Errorf("Expected another IP to be unaffected, got %v", result.Errors)
+	}
+}
+
+func TestVerifyLoginLockoutAndCodeInvalidation(t *testing.T) {
+	login := config.Default().Login
+	login.CodeMaxAttempts = 2
+	login.MaxFailures = 3
+	schema, codes := newLoginSchema(t, login)
+	issue := func(email, code string) {
+		_, err := codes.Issue(context.Background(), email, repository.CodeLimits{MaxAttempts: 2, MaxOutstanding: 5}, time.Now().Add(time.Hour),
+			func(userID int) string { return utils.HashOTP(login.CodePepper, userID, code) })
+		if err != nil {
+			t.Fatalf("Issue failed: %v", err)
+		}
+	}
+	verify := func(ip, email, code string) *graphql.Result {
+		return graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  `mutation($e: String!, $c: String!) { verifyLogin(email: $e, code: $c) { accessToken } }`,
+			VariableValues: map[string]interface{}{"e": email, "c": code},
+			Context:        loginContext(ip),
+		})
+	}
+
+	// A code stops matching once it has absorbed its failed attempts
+	issue("a@example.com", "111111")
+	for i := 0; i < 2; i++ {
+		if result := verify("10.0.0.1", "a@example.com", "999999"); len(result.Errors) != 1 {
+			t.Fatalf("Expected a wrong code to fail, got %v", result.Errors)
+		}
+	}
+	if result := verify("10.0.0.1", "a@example.com", "111111"); len(result.Errors) != 1 || errorCode(result) == CodeRateLimited {
+		t.Errorf("Expected the invalidated code to be refused, got %v", result.Errors)
+	}
+
+	// The email is locked out after MaxFailures failures, even for a correct code and from another IP
+	issue("a@example.com", "222222")
+	if result := verify("10.0.0.2", "a@example.com", "222222"); errorCode(result) != CodeRateLimited {
+		t.Errorf("Expected the email to be locked out, got %v", result.Errors)
+	}
+
+	// A successful login works and consumes the code
+	issue("b@example.com", "333333")
+	if result := verify("10.0.0.3", "b@example.com", "333333"); len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if result := verify("10.0.0.3", "b@example.com", "333333"); len(result.Errors) != 1 {
+		t.Error("Expected a used code to be refused")
+	}
+}
@@ -0,0 +1,262 @@
+package graph
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultConnectionSize = 20
+	maxConnectionSize     = 100
+)
+
+// CarFilterInput mirrors repository.CarFilter
+var CarFilterInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "CarFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"make":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"model":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"color":      &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"yearMin":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"yearMax":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"priceMin":   &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"priceMax":   &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"mileageMax": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"status":     &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(CarStatusEnum))},
+		},
+	},
+)
+
+// CarOrderFieldEnum lists the sortable car fields
+var CarOrderFieldEnum = graphql.NewEnum(
+	graphql.EnumConfig{
+		Name: "CarOrderField",
+		Values: graphql.EnumValueConfigMap{
+			"ID":      &graphql.EnumValueConfig{Value: "id"},
+			"MAKE":    &graphql.EnumValueConfig{Value: "make"},
+			"MODEL":   &graphql.EnumValueConfig{Value: "model"},
+			"YEAR":    &graphql.EnumValueConfig{Value: "year"},
+			"PRICE":   &graphql.EnumValueConfig{Value: "price"},
+			"COLOR":   &graphql.EnumValueConfig{Value: "color"},
+			"MILEAGE": &graphql.EnumValueConfig{Value: "mileage"},
+		},
+	},
+)
+
+// OrderDirectionEnum is the sort direction of a CarOrder
+var OrderDirectionEnum = graphql.NewEnum(
+	graphql.EnumConfig{
+		Name: "OrderDirection",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  &graphql.EnumValueConfig{Value: "asc"},
+			"DESC": &graphql.EnumValueConfig{Value: "desc"},
+		},
+	},
+)
+
+// CarOrderInput is one sort key of carsConnection
+var CarOrderInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "CarOrder",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(CarOrderFieldEnum)},
+			"direction": &graphql.InputObjectFieldConfig{Type: OrderDirectionEnum, DefaultValue: "asc"},
+		},
+	},
+)
+
+// PageInfoType follows the Relay connection spec
+var PageInfoType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"startCursor":     &graphql.Field{Type: graphql.String},
+			"endCursor":       &graphql.Field{Type: graphql.String},
+		},
+	},
+)
+
+// CarEdgeType pairs a car with its opaque cursor
+var CarEdgeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "CarEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: CarType},
+		},
+	},
+)
+
+// CarConnectionType is a page of cars
+var CarConnectionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "CarConnection",
+		Fields: graphql.Fields{
+			"edges":      &graphql.Field{Type: graphql.NewList(CarEdgeType)},
+			"nodes":      &graphql.Field{Type: graphql.NewList(CarType)},
+			"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(PageInfoType)},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	},
+)
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type carEdge struct {
+	Cursor string     `json:"cursor"`
+	Node   models.Car `json:"node"`
+}
+
+type carConnection struct {
+	Edges      []carEdge    `json:"edges"`
+	Nodes      []models.Car `json:"nodes"`
+	PageInfo   pageInfo     `json:"pageInfo"`
+	TotalCount int          `json:"totalCount"`
+}
+
+// carsConnectionField resolves carsConnection with keyset pagination, so rows inserted
+// between requests never shift or duplicate the pages a client has already seen.
+func carsConnectionField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarConnectionType,
+		Args: graphql.FieldConfigArgument{
+			"first":   &graphql.ArgumentConfig{Type: graphql.Int},
+			"after":   &graphql.ArgumentConfig{Type: graphql.String},
+			"last":    &graphql.ArgumentConfig{Type: graphql.Int},
+			"before":  &graphql.ArgumentConfig{Type: graphql.String},
+			"filter":  &graphql.ArgumentConfig{Type: CarFilterInput},
+			"orderBy": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(CarOrderInput))},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			first, hasFirst := p.Args["first"].(int)
+			last, hasLast := p.Args["last"].(int)
+			if hasFirst && hasLast {
+				return nil, errors.New("first and last cannot be used together")
+			}
+			if !hasFirst && !hasLast {
+				first, hasFirst = defaultConnectionSize, true
+			}
+			size := first
+			if hasLast {
+				size = last
+			}
+			if size < 0 || size > maxConnectionSize {
+				return nil, fmt.Errorf("first/last must be between 0 and %d", maxConnectionSize)
+			}
+
+			opts := repository.ListOptions{
+				Filter:  parseCarFilter(p.Args["filter"]),
+				Sort:    parseCarOrder(p.Args["orderBy"]),
+				Limit:   size + 1, // One extra row tells us whether another page exists
+				FromEnd: hasLast,
+			}
+			if after, ok := p.Args["after"].(string); ok {
+				boundary, err := repository.DecodeCursor(after, opts.Sort)
+				if err != nil {
+					return nil, errors.New("invalid after cursor")
+				}
+				opts.After = &boundary
+			}
+			if before, ok := p.Args["before"].(string); ok {
+				boundary, err := repository.DecodeCursor(before, opts.Sort)
+				if err != nil {
+					return nil, errors.New("invalid before cursor")
+				}
+				opts.Before = &boundary
+			}
+
+			total, err := res.Cars.Count(p.Context, opts.Filter)
+			if err != nil {
+				return nil, err
+			}
+			cars := []models.Car{}
+			if size > 0 {
+				if cars, err = res.Cars.List(p.Context, opts); err != nil {
+					return nil, err
+				}
+			}
+
+			conn := carConnection{TotalCount: total}
+			hasMore := len(cars) > size
+			if hasMore && hasLast {
+				cars = cars[1:]
+			} else if hasMore {
+				cars = cars[:size]
+			}
+			if hasLast {
+				conn.PageInfo.HasPreviousPage = hasMore
+				conn.PageInfo.HasNextPage = opts.Before != nil
+			} else {
+				conn.PageInfo.HasNextPage = hasMore
+				conn.PageInfo.HasPreviousPage = opts.After != nil
+			}
+
+			conn.Nodes = cars
+			for _, c := range cars {
+				conn.Edges = append(conn.Edges, carEdge{Cursor: repository.EncodeCursor(c, opts.Sort), Node: c})
+			}
+			if len(conn.Edges) > 0 {
+				conn.PageInfo.StartCursor = &conn.Edges[0].Cursor
+				conn.PageInfo.EndCursor = &conn.Edges[len(conn.Edges)-1].Cursor
+			}
+			return conn, nil
+		},
+	}
+}
+
+func parseCarFilter(arg interface{}) repository.CarFilter {
+	var f repository.CarFilter
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return f
+	}
+	f.Make, _ = m["make"].(string)
+	f.Model, _ = m["model"].(string)
+	f.Color, _ = m["color"].(string)
+	f.Make, f.Model, f.Color = strings.TrimSpace(f.Make), strings.TrimSpace(f.Model), strings.TrimSpace(f.Color)
+	f.Statuses = parseStatuses(m["status"])
+	if v, ok := m["yearMin"].(int); ok {
+		f.YearMin = &v
+	}
+	if v, ok := m["yearMax"].(int); ok {
+		f.YearMax = &v
+	}
+	if v, ok := m["priceMin"].(float64); ok {
+		f.PriceMin = &v
+	}
+	if v, ok := m["priceMax"].(float64); ok {
+		f.PriceMax = &v
+	}
+	if v, ok := m["mileageMax"].(int); ok {
+		f.MileageMax = &v
+	}
+	return f
+}
+
+func parseCarOrder(arg interface{}) []repository.SortKey {
+	list, _ := arg.([]interface{})
+	var keys []repository.SortKey
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field, _ := m["field"].(string)
+		direction, _ := m["direction"].(string)
+		keys = append(keys, repository.SortKey{Field: field, Desc: direction == "desc"})
+	}
+	return keys
+}
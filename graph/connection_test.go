@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+type testConnection struct {
+	Nodes    []models.Car `json:"nodes"`
+	PageInfo struct {
+		HasNextPage     bool   `json:"hasNextPage"`
+		HasPreviousPage bool   `json:"hasPreviousPage"`
+		StartCursor     string `json:"startCursor"`
+		EndCursor       string `json:"endCursor"`
+	} `json:"pageInfo"`
+	TotalCount int `json:"totalCount"`
+}
+
+func queryConnection(t *testing.T, schema graphql.Schema, args map[string]interface{}) testConnection {
+	t.Helper()
+	result := graphql.Do(graphql.Params{
+		Schema: schema,
+		RequestString: `query($first: Int, $after: String, $last: Int, $before: String) {
+			carsConnection(first: $first, after: $after, last: $last, before: $before,
+				filter: {make: "Honda"}, orderBy: [{field: PRICE, direction: DESC}]) {
+				nodes { id price }
+				pageInfo { hasNextPage hasPreviousPage startCursor endCursor }
+				totalCount
+			}
+		}`,
+		VariableValues: args,
+		Context:        context.Background(),
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	data, _ := json.Marshal(result.Data.(map[string]interface{})["carsConnection"])
+	var conn testConnection
+	json.Unmarshal(data, &conn)
+	return conn
+}
+
+func TestCarsConnectionPaging(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	ctx := context.Background()
+	for _, price := range []float64{10000, 30000, 20000, 30000, 50000} {
+		repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: price, Color: "Red"})
+	}
+	repo.Create(ctx, models.Car{Make: "BMW", Model: "M3", Year: 2020, Price: 90000, Color: "Black"})
+	schema := newTestSchema(t, repo)
+
+	page1 := queryConnection(t, schema, map[string]interface{}{"first": 2})
+	if page1.TotalCount != 5 || len(page1.Nodes) != 2 || !page1.PageInfo.HasNextPage {
+		t.Fatalf("Unexpected first page: %+v", page1)
+	}
+	if page1.Nodes[0].Price != 50000 || page1.Nodes[1].ID != 2 {
+		t.Errorf("Expected 50000 then the first 30000 car, got %+v", page1.Nodes)
+	}
+
+	// A car inserted ahead of the cursor must not shift the next page
+	repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 60000, Color: "Red"})
+
+	page2 := queryConnection(t, schema, map[string]interface{}{"first": 2, "after": page1.PageInfo.EndCursor})
+	if len(page2.Nodes) != 2 || page2.Nodes[0].ID != 4 || page2.Nodes[1].Price != 20000 {
+		t.Errorf("Expected the second 30000 car then 20000, got %+v", page2.Nodes)
+	}
+	if !page2.PageInfo.HasPreviousPage {
+		t.Error("Expected hasPreviousPage on a page after a cursor")
+	}
+
+	back := queryConnection(t, schema, map[string]interface{}{"last": 2, "before": page2.PageInfo.StartCursor})
+	if len(back.Nodes) != 2 || back.Nodes[0].Price != 50000 || back.Nodes[1].ID != 2 || !back.PageInfo.HasPreviousPage {
+		t.Errorf("Expected to page back to 50000 and the first 30000 car, got %+v", back)
+	}
+}
+
+func TestCarsConnectionRejectsForeignCursor(t *testing.T) {
+	schema := newTestSchema(t, repository.NewMemoryCarRepository())
+	cursor := repository.EncodeCursor(models.Car{ID: 1, Year: 2020}, []repository.SortKey{{Field: "year"}})
+
+	result := graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  `query($after: String) { carsConnection(first: 1, after: $after) { totalCount } }`,
+		VariableValues: map[string]interface{}{"after": cursor},
+		Context:        context.Background(),
+	})
+	if len(result.Errors) == 0 {
+		t.Error("Expected error for cursor issued under a different ordering, got nil")
+	}
+}
@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+func holdField(get func(models.CarHold) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(models.CarHold)), nil
+	}
+}
+
+// CarHoldType is the active reservation of a car
+var CarHoldType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CarHold",
+	Fields: graphql.Fields{
+		"expiresAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: holdField(func(h models.CarHold) interface{} { return h.ExpiresAt }),
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: holdField(func(h models.CarHold) interface{} { return h.CreatedAt }),
+		},
+		// The customer holding the car; only visible to admins and to that customer
+		"userId": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				h := p.Source.(models.CarHold)
+				if isHolder(p.Context, h) || middleware.Authorize(p.Context, middleware.RoleAdmin) == nil {
+					return h.UserID, nil
+				}
+				return nil, nil
+			},
+		},
+		// Whether the signed-in user holds the car
+		"mine": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return isHolder(p.Context, p.Source.(models.CarHold)), nil
+			},
+		},
+	},
+})
+
+func isHolder(ctx context.Context, h models.CarHold) bool {
+	userID, ok := ctx.Value(middleware.UserIDKey).(int)
+	return ok && userID == h.UserID
+}
+
+type holdLoaderKey struct{}
+
+// holdLoader batches the active holds of every car resolved at one level into a single query
+func (res *Resolver) holdLoader(ctx context.Context) *batchLoader[models.CarHold] {
+	return requestLoader(ctx, holdLoaderKey{}, res.Cars.ActiveHolds)
+}
+
+// carHoldField resolves Car.hold through the request's hold loader; null unless the car is reserved
+func carHoldField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarHoldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			car, ok := p.Source.(models.Car)
+			if !ok || car.Status != models.StatusReserved {
+				return nil, nil
+			}
+			thunk := res.holdLoader(p.Context).Load(car.ID)
+			return func() (interface{}, error) {
+				h, ok, err := thunk()
+				if err != nil || !ok {
+					return nil, err
+				}
+				return h, nil
+			}, nil
+		},
+	}
+}
+
+// reservationContext lets the repository bypass the reservation checks when the mutation's
+// overrideReservation argument is set
+func reservationContext(p graphql.ResolveParams) context.Context {
+	if override, _ := p.Args["overrideReservation"].(bool); override {
+		return repository.WithReservationOverride(p.Context)
+	}
+	return p.Context
+}
+
+// holdError gives reservation failures a code: NOT_FOUND for missing cars, holds and users and
+// CAR_RESERVED for cars someone else holds. Other errors pass through.
+func holdError(err error, carID int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFoundError("car %d not found", carID)
+	case errors.Is(err, repository.ErrNoHold):
+		return notFoundError("car %d has no active hold of yours", carID)
+	case errors.Is(err, repository.ErrUserNotFound):
+		return notFoundError("%s", err.Error())
+	case errors.Is(err, repository.ErrCarReserved):
+		return &codedError{code: CodeCarReserved, message: err.Error()}
+	}
+	return err
+}
+
+// reserveCarField holds an available car for the signed-in customer for a number of hours
+func reserveCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Args: graphql.FieldConfigArgument{
+			"carId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"hours": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 48},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			hours, _ := p.Args["hours"].(int)
+			// Check the int before converting, so huge values cannot overflow into a negative duration
+			maxHours := int(res.Holds.MaxDuration / time.Hour)
+			if hours < 1 || hours > maxHours {
+				return nil, fmt.Errorf("hours must be between 1 and %d", maxHours)
+			}
+			duration := time.Duration(hours) * time.Hour
+
+			car, err := res.Cars.Reserve(p.Context, carID, userID, time.Now().Add(duration), res.Holds.MaxPerUser)
+			if err != nil {
+				return nil, holdError(err, carID)
+			}
+			return car, nil
+		},
+	}
+}
+
+// releaseCarField ends a hold early; customers may only release their own, admins any
+func releaseCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Args: graphql.FieldConfigArgument{
+			"carId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			if middleware.Authorize(p.Context, middleware.RoleAdmin) == nil {
+				userID = 0
+			}
+			carID, _ := p.Args["carId"].(int)
+			car, err := res.Cars.ReleaseHold(p.Context, carID, userID)
+			if err != nil {
+				return nil, holdError(err, carID)
+			}
+			return car, nil
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+
+	"github.com/graphql-go/graphql"
+)
+
+// CarImageType is a photo of a car, ordered by position
+var CarImageType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "CarImage",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"url":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"width":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"height":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"contentType": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: imageField(func(i models.CarImage) interface{} { return i.ContentType })},
+			"position":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"primary":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		},
+	},
+)
+
+func imageField(get func(models.CarImage) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		img, _ := p.Source.(models.CarImage)
+		return get(img), nil
+	}
+}
+
+type imageLoaderKey struct{}
+
+// imageLoader batches the images of every car resolved at one level into a single query
+func (res *Resolver) imageLoader(ctx context.Context) *batchLoader[[]models.CarImage] {
+	return requestLoader(ctx, imageLoaderKey{}, res.Media.ListByCars)
+}
+
+// carImagesField resolves Car.images through the request's image loader
+func carImagesField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(CarImageType))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			car, ok := p.Source.(models.Car)
+			if !ok || res.Media == nil {
+				return []models.CarImage{}, nil
+			}
+			thunk := res.imageLoader(p.Context).Load(car.ID)
+			return func() (interface{}, error) {
+				images, _, err := thunk()
+				if err != nil {
+					return nil, err
+				}
+				if images == nil {
+					images = []models.CarImage{}
+				}
+				return images, nil
+			}, nil
+		},
+	}
+}
+
+// uploadCarImageField stores a photo sent with the GraphQL multipart request spec
+func uploadCarImageField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarImageType,
+		Args: graphql.FieldConfigArgument{
+			"carId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"file":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(UploadScalar)},
+			"primary": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			placeholder, _ := p.Args["file"].(string)
+			primary, _ := p.Args["primary"].(bool)
+
+			file, err := openUpload(p.Context, placeholder)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+
+			img, err := res.Media.Upload(p.Context, carID, file, primary)
+			if err != nil {
+				return nil, imageError(err, carID)
+			}
+			return img, nil
+		},
+	}
+}
+
+// deleteCarImageField removes a photo; returns false if it does not exist
+func deleteCarImageField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"carId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"imageId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return false, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			imageID, _ := p.Args["imageId"].(int)
+
+			err := res.Media.Delete(p.Context, carID, imageID)
+			if errors.Is(err, repository.ErrImageNotFound) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+	}
+}
+
+// setPrimaryCarImageField makes a photo the car's primary one and returns the car's photos
+func setPrimaryCarImageField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(graphql.NewNonNull(CarImageType)),
+		Args: graphql.FieldConfigArgument{
+			"carId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"imageId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			imageID, _ := p.Args["imageId"].(int)
+
+			if err := res.Media.SetPrimary(p.Context, carID, imageID); err != nil {
+				return nil, imageError(err, carID)
+			}
+			return res.Media.List(p.Context, carID)
+		},
+	}
+}
+
+// reorderCarImagesField sets the display order; imageIds must list every photo of the car once
+func reorderCarImagesField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewList(graphql.NewNonNull(CarImageType)),
+		Args: graphql.FieldConfigArgument{
+			"carId":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"imageIds": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int)))},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			list, _ := p.Args["imageIds"].([]interface{})
+			imageIDs := make([]int, 0, len(list))
+			for _, v := range list {
+				id, _ := v.(int)
+				imageIDs = append(imageIDs, id)
+			}
+
+			if err := res.Media.Reorder(p.Context, carID, imageIDs); err != nil {
+				return nil, imageError(err, carID)
+			}
+			return res.Media.List(p.Context, carID)
+		},
+	}
+}
+
+// imageError gives missing cars and images a NOT_FOUND code; validation errors keep their message
+func imageError(err error, carID int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFoundError("car %d not found", carID)
+	case errors.Is(err, repository.ErrImageNotFound):
+		return notFoundError("image not found")
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package graph
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"net/http"
+	"sync"
+)
+
+type loaderKey struct{}
+
+// CarLoader batches and caches car lookups for the lifetime of one request.
+// Resolvers return the thunk from Load; graphql-go runs all thunks of one level together,
+// so the first one to run fetches every queued ID in a single query.
+type CarLoader struct {
+	ctx  context.Context
+	repo repository.CarRepository
+
+	mu      sync.Mutex
+	results map[int]*carResult
+	queue   []int
+}
+
+type carResult struct {
+	car   models.Car
+	found bool
+	done  bool
+	err   error
+}
+
+// NewCarLoader creates an empty loader bound to the request context
+func NewCarLoader(ctx context.Context, repo repository.CarRepository) *CarLoader {
+	return &CarLoader{ctx: ctx, repo: repo, results: map[int]*carResult{}}
+}
+
+// LoaderMiddleware attaches a fresh CarLoader and fresh price history, hold and image loaders to every request
+func (res *Resolver) LoaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), loaderKey{}, NewCarLoader(r.Context(), res.Cars))
+		ctx = context.WithValue(ctx, priceLoaderKey{}, newBatchLoader(r.Context(), res.Cars.PriceHistory))
+		ctx = context.WithValue(ctx, holdLoaderKey{}, newBatchLoader(r.Context(), res.Cars.ActiveHolds))
+		if res.Media != nil {
+			ctx = context.WithValue(ctx, imageLoaderKey{}, newBatchLoader(r.Context(), res.Media.ListByCars))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// carLoader returns the request's loader, or a one-off loader when none is attached (e.g. in tests)
+func (res *Resolver) carLoader(ctx context.Context) *CarLoader {
+	if l, ok := ctx.Value(loaderKey{}).(*CarLoader); ok {
+		return l
+	}
+	return NewCarLoader(ctx, res.Cars)
+}
+
+// Load queues id and returns a thunk that yields the car, or repository.ErrNotFound
+func (l *CarLoader) Load(id int) func() (models.Car, error) {
+	l.mu.Lock()
+	if _, ok := l.results[id]; !ok {
+		l.results[id] = &carResult{}
+		l.queue = append(l.queue, id)
+	}
+	l.mu.Unlock()
+
+	return func() (models.Car, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		r := l.results[id]
+		if !r.done {
+			l.dispatch()
+		}
+		if r.err != nil {
+			return models.Car{}, r.err
+		}
+		if !r.found {
+			return models.Car{}, repository.ErrNotFound
+		}
+		return r.car, nil
+	}
+}
+
+// LoadMany queues ids and returns a thunk yielding one entry per id, in input order (nil when missing)
+func (l *CarLoader) LoadMany(ids []int) func() ([]*models.Car, error) {
+	thunks := make([]func() (models.Car, error), len(ids))
+	for i, id := range ids {
+		thunks[i] = l.Load(id)
+	}
+
+	return func() ([]*models.Car, error) {
+		cars := make([]*models.Car, len(ids))
+		for i, thunk := range thunks {
+			car, err := thunk()
+			if err == repository.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			cars[i] = &car
+		}
+		return cars, nil
+	}
+}
+
+// dispatch fetches every queued ID in one round trip. Callers must hold l.mu.
+func (l *CarLoader) dispatch() {
+	ids := l.queue
+	l.queue = nil
+
+	cars, err := l.repo.GetMany(l.ctx, ids)
+	for _, c := range cars {
+		if r, ok := l.results[c.ID]; ok {
+			r.car, r.found = c, true
+		}
+	}
+	for _, id := range ids {
+		l.results[id].done = true
+		l.results[id].err = err
+	}
+}
+
+// batchLoader batches a per-car lookup (images, price history, holds) for the lifetime of one request:
+// like CarLoader, the first thunk of a level to run fetches every queued car ID with one call of fetch.
+// Errors are kept per batch, so one failed fetch does not fail cars loaded by another.
+type batchLoader[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, carIDs []int) (map[int]T, error)
+
+	mu      sync.Mutex
+	results map[int]*batchResult[T]
+	queue   []int
+}
+
+type batchResult[T any] struct {
+	value T
+	found bool
+	done  bool
+	err   error
+}
+
+// newBatchLoader creates an empty loader bound to the request context
+func newBatchLoader[T any](ctx context.Context, fetch func(context.Context, []int) (map[int]T, error)) *batchLoader[T] {
+	return &batchLoader[T]{ctx: ctx, fetch: fetch, results: map[int]*batchResult[T]{}}
+}
+
+// requestLoader returns the loader attached to the request under key, or a one-off loader when
+// none is attached (e.g. in tests)
+func requestLoader[T any](ctx context.Context, key interface{}, fetch func(context.Context, []int) (map[int]T, error)) *batchLoader[T] {
+	if l, ok := ctx.Value(key).(*batchLoader[T]); ok {
+		return l
+	}
+	return newBatchLoader(ctx, fetch)
+}
+
+// Load queues carID and returns a thunk yielding its value; false when fetch returned none for it
+func (l *batchLoader[T]) Load(carID int) func() (T, bool, error) {
+	l.mu.Lock()
+	if _, ok := l.results[carID]; !ok {
+		l.results[carID] = &batchResult[T]{}
+		l.queue = append(l.queue, carID)
+	}
+	l.mu.Unlock()
+
+	return func() (T, bool, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		r := l.results[carID]
+		if !r.done {
+			l.dispatch()
+		}
+		return r.value, r.found, r.err
+	}
+}
+
+// dispatch fetches every queued car ID in one call. Callers must hold l.mu.
+func (l *batchLoader[T]) dispatch() {
+	ids := l.queue
+	l.queue = nil
+
+	values, err := l.fetch(l.ctx, ids)
+	for _, id := range ids {
+		r := l.results[id]
+		r.value, r.found = values[id]
+		r.done, r.err = true, err
+	}
+}
@@ -0,0 +1,154 @@
+package graph
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+// countingRepo records how many batch lookups reach the repository
+type countingRepo struct {
+	*repository.MemoryCarRepository
+	getManyCalls int
+}
+
+func (r *countingRepo) GetMany(ctx context.Context, ids []int) ([]models.Car, error) {
+	r.getManyCalls++
+	return r.MemoryCarRepository.GetMany(ctx, ids)
+}
+
+func seededCountingRepo() *countingRepo {
+	repo := &countingRepo{MemoryCarRepository: repository.NewMemoryCarRepository()}
+	for _, make := range []string{"Honda", "Toyota", "BMW"} {
+		repo.Create(context.Background(), models.Car{Make: make, Model: "X", Year: 2020, Price: 1000, Color: "Red"})
+	}
+	return repo
+}
+
+func TestCarLoaderBatches(t *testing.T) {
+	repo := seededCountingRepo()
+	loader := NewCarLoader(context.Background(), repo)
+
+	first, second, missing := loader.Load(1), loader.Load(2), loader.Load(99)
+	if c, err := second(); err != nil || c.Make != "Toyota" {
+		t.Errorf("Expected Toyota, got %+v, %v", c, err)
+	}
+	if c, err := first(); err != nil || c.Make != "Honda" {
+		t.Errorf("Expected Honda, got %+v, %v", c, err)
+	}
+	if _, err := missing(); err != repository.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	loader.Load(1)()
+	if repo.getManyCalls != 1 {
+		t.Errorf("Expected 1 batched lookup, got %d", repo.getManyCalls)
+	}
+}
+
+func TestBatchLoaderKeepsErrorsPerBatch(t *testing.T) {
+	var batches [][]int
+	loader := newBatchLoader(context.Background(), func(ctx context.Context, ids []int) (map[int]string, error) {
+		batches = append(batches, ids)
+		if len(batches) == 2 {
+			return nil, errors.New("boom")
+		}
+		return map[int]string{1: "one"}, nil
+	})
+
+	first, second := loader.Load(1), loader.Load(2)
+	if v, ok, err := first(); err != nil || !ok || v != "one" {
+		t.Errorf("Expected one, got %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := second(); err != nil || ok {
+		t.Errorf("Expected no value for 2, got %v, %v", ok, err)
+	}
+
+	failed := loader.Load(3)
+	if _, _, err := failed(); err == nil {
+		t.Error("Expected the second batch to fail")
+	}
+	if v, ok, err := loader.Load(1)(); err != nil || !ok || v != "one" {
+		t.Errorf("Expected the first batch to keep its result, got %q, %v, %v", v, ok, err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 {
+		t.Errorf("Expected 2 batches, the first of 2 IDs, got %v", batches)
+	}
+}
+
+func TestCarsByIdsPreservesOrder(t *testing.T) {
+	repo := seededCountingRepo()
+	schema := newTestSchema(t, repo)
+
+	result := graphql.Do(graphql.Params{
+		Schema:        schema,
+		RequestString: `{ carsByIds(ids: [3, 99, 1, 3]) { id make } }`,
+		Context:       context.Background(),
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	cars := result.Data.(map[string]interface{})["carsByIds"].([]interface{})
+	if len(cars) != 4 || cars[1] != nil {
+		t.Fatalf("Expected 4 entries with a null second entry, got %v", cars)
+	}
+	for i, want := range []int{3, 0, 1, 3} {
+		if want == 0 {
+			continue
+		}
+		if got := cars[i].(map[string]interface{})["id"]; got != want {
+			t.Errorf("Entry %d: expected id %d, got %v", i, want, got)
+		}
+	}
+	if repo.getManyCalls != 1 {
+		t.Errorf("Expected a single round trip, got %d", repo.getManyCalls)
+	}
+}
+
+func TestSiblingCarFieldsAreBatched(t *testing.T) {
+	repo := seededCountingRepo()
+	schema := newTestSchema(t, repo)
+	ctx := context.WithValue(context.Background(), loaderKey{}, NewCarLoader(context.Background(), repo))
+
+	result := graphql.Do(graphql.Params{
+		Schema:        schema,
+		RequestString: `{ a: car(id: 1) { make } b: car(id: 2) { make } missing: car(id: 99) { make } }`,
+		Context:       ctx,
+	})
+	data := result.Data.(map[string]interface{})
+	if data["b"].(map[string]interface{})["make"] != "Toyota" || data["missing"] != nil {
+		t.Errorf("Unexpected result %v", data)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeNotFound || result.Errors[0].Path[0] != "missing" {
+		t.Errorf("Expected a NOT_FOUND error for the missing car, got %+v", result.Errors)
+	}
+	if repo.getManyCalls != 1 {
+		t.Errorf("Expected the sibling car fields to share one lookup, got %d", repo.getManyCalls)
+	}
+}
+
+// TestCarNotFound pins the graphql-go behaviour codedThunk relies on: a located error panicked
+// inside a thunk reaches the response unchanged, extensions included. If an upgrade breaks this,
+// car(id:) errors lose their code.
+func TestCarNotFound(t *testing.T) {
+	schema := newTestSchema(t, seededCountingRepo())
+
+	result := graphql.Do(graphql.Params{
+		Schema:        schema,
+		RequestString: `{ car(id: 999) { id } }`,
+		Context:       context.Background(),
+	})
+	if car := result.Data.(map[string]interface{})["car"]; car != nil {
+		t.Errorf("Expected null car, got %v", car)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeNotFound {
+		t.Fatalf("Expected a NOT_FOUND error, got %+v", result.Errors)
+	}
+	if err := result.Errors[0]; err.Message != "car 999 not found" || len(err.Path) != 1 || err.Path[0] != "car" || len(err.Locations) != 1 {
+		t.Errorf("Expected the error located at car, got %+v", err)
+	}
+}
@@ -0,0 +1,477 @@
+package graph
+
+import (
+	"bytes"
+	"car-service/documents"
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// OrderStatusEnum is the status of a sales order
+var OrderStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "OrderStatus",
+	Values: graphql.EnumValueConfigMap{
+		"OPEN":      &graphql.EnumValueConfig{Value: models.OrderOpen},
+		"CANCELLED": &graphql.EnumValueConfig{Value: models.OrderCancelled},
+	},
+})
+
+// PaymentStatusEnum is how much of an order has been paid
+var PaymentStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentStatus",
+	Values: graphql.EnumValueConfigMap{
+		"UNPAID":         &graphql.EnumValueConfig{Value: models.PaymentUnpaid},
+		"PARTIALLY_PAID": &graphql.EnumValueConfig{Value: models.PaymentPartial},
+		"PAID":           &graphql.EnumValueConfig{Value: models.PaymentPaid},
+		"REFUNDED":       &graphql.EnumValueConfig{Value: models.PaymentRefunded},
+	},
+})
+
+// PaymentMethodEnum is how a payment was made
+var PaymentMethodEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentMethod",
+	Values: graphql.EnumValueConfigMap{
+		"CASH":          &graphql.EnumValueConfig{Value: models.PaymentCash},
+		"CARD":          &graphql.EnumValueConfig{Value: models.PaymentCard},
+		"BANK_TRANSFER": &graphql.EnumValueConfig{Value: models.PaymentBankTransfer},
+		"FINANCING":     &graphql.EnumValueConfig{Value: models.PaymentFinancing},
+		"CHECK":         &graphql.EnumValueConfig{Value: models.PaymentCheck},
+	},
+})
+
+// LineItemKindEnum tells fees from taxes
+var LineItemKindEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "LineItemKind",
+	Values: graphql.EnumValueConfigMap{
+		"FEE": &graphql.EnumValueConfig{Value: models.LineItemFee},
+		"TAX": &graphql.EnumValueConfig{Value: models.LineItemTax},
+	},
+})
+
+// DocumentFormatEnum is the output format of a rendered document
+var DocumentFormatEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "DocumentFormat",
+	Values: graphql.EnumValueConfigMap{
+		"HTML": &graphql.EnumValueConfig{Value: string(documents.FormatHTML)},
+		"PDF":  &graphql.EnumValueConfig{Value: string(documents.FormatPDF)},
+	},
+})
+
+// LineItemInput is a fee (amount) or a tax (rate in percent) of a new order
+var LineItemInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "LineItemInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"kind":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(LineItemKindEnum)},
+		"description": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"amount":      &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		"rate":        &graphql.InputObjectFieldConfig{Type: graphql.Float},
+	},
+})
+
+// LineItemType is a fee or tax of an order; taxes carry their rate and computed amount
+var LineItemType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LineItem",
+	Fields: graphql.Fields{
+		"kind":        &graphql.Field{Type: graphql.NewNonNull(LineItemKindEnum)},
+		"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"rate":        &graphql.Field{Type: graphql.Float},
+		"amount":      &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+	},
+})
+
+func paymentField(get func(models.Payment) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(models.Payment)), nil
+	}
+}
+
+// PaymentType is a recorded payment; refunds have a negative amount
+var PaymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Payment",
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"amount":    &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"method":    &graphql.Field{Type: graphql.NewNonNull(PaymentMethodEnum)},
+		"reference": &graphql.Field{Type: graphql.String},
+		"receivedAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: paymentField(func(pm models.Payment) interface{} { return pm.ReceivedAt }),
+		},
+		"recordedBy": &graphql.Field{
+			Type:    graphql.Int,
+			Resolve: paymentField(func(pm models.Payment) interface{} { return pm.RecordedBy }),
+		},
+	},
+})
+
+// InvoiceFileType is a rendered invoice. content is the HTML markup, or the PDF encoded as base64.
+var InvoiceFileType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "InvoiceFile",
+	Fields: graphql.Fields{
+		"filename":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"contentType": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"content":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// invoiceFile is the source of InvoiceFileType
+type invoiceFile struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+func orderField(get func(models.Order) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(models.Order)), nil
+	}
+}
+
+// OrderType is the sale of a car to a buyer; Order.car and Order.invoice are attached in InitSchema
+var OrderType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Order",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"invoiceNumber": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: orderField(func(o models.Order) interface{} { return o.InvoiceNumber }),
+		},
+		// carId is null once the car has been purged
+		"carId": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: orderField(func(o models.Order) interface{} {
+				if o.CarID == 0 {
+					return nil
+				}
+				return o.CarID
+			}),
+		},
+		// The vehicle as sold, e.g. "2018 Honda Civic"
+		"vehicle": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"vin": &graphql.Field{
+			Type:    graphql.String,
+			Resolve: orderField(func(o models.Order) interface{} { return o.VIN }),
+		},
+		"mileage": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"buyerId": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Int),
+			Resolve: orderField(func(o models.Order) interface{} { return o.BuyerID }),
+		},
+		"buyerEmail": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.String),
+			Resolve: orderField(func(o models.Order) interface{} { return o.BuyerEmail }),
+		},
+		// The agreed price of the car
+		"price": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"lineItems": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(LineItemType))),
+			Resolve: orderField(func(o models.Order) interface{} { return o.LineItems }),
+		},
+		// The price plus fees, which taxes are charged on
+		"subtotal": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Float),
+			Resolve: orderField(func(o models.Order) interface{} { return o.Subtotal() }),
+		},
+		"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"amountPaid": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Float),
+			Resolve: orderField(func(o models.Order) interface{} { return o.AmountPaid }),
+		},
+		"balance": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Float),
+			Resolve: orderField(func(o models.Order) interface{} { return o.Balance() }),
+		},
+		"status": &graphql.Field{Type: graphql.NewNonNull(OrderStatusEnum)},
+		"paymentStatus": &graphql.Field{
+			Type:    graphql.NewNonNull(PaymentStatusEnum),
+			Resolve: orderField(func(o models.Order) interface{} { return o.PaymentStatus }),
+		},
+		"payments": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(PaymentType)))},
+		"dueAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: orderField(func(o models.Order) interface{} { return o.DueAt }),
+		},
+		"createdAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: orderField(func(o models.Order) interface{} { return o.CreatedAt }),
+		},
+		"cancelledAt": &graphql.Field{
+			Type:    graphql.DateTime,
+			Resolve: orderField(func(o models.Order) interface{} { return o.CancelledAt }),
+		},
+	},
+})
+
+// orderCarField resolves Order.car through the request's CarLoader; null once the car is deleted
+func orderCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			carID := p.Source.(models.Order).CarID
+			if carID == 0 {
+				return nil, nil
+			}
+			thunk := res.carLoader(p.Context).Load(carID)
+			return func() (interface{}, error) {
+				car, err := thunk()
+				if errors.Is(err, repository.ErrNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return car, nil
+			}, nil
+		},
+	}
+}
+
+// orderInvoiceField renders the order's invoice from the invoice template
+func orderInvoiceField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(InvoiceFileType),
+		Args: graphql.FieldConfigArgument{
+			"format": &graphql.ArgumentConfig{Type: DocumentFormatEnum, DefaultValue: string(documents.FormatHTML)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			order := p.Source.(models.Order)
+			format := documents.Format(p.Args["format"].(string))
+			var buf bytes.Buffer
+			if err := res.Documents.RenderInvoice(p.Context, &buf, format, order); err != nil {
+				return nil, err
+			}
+			file := invoiceFile{
+				Filename:    fmt.Sprintf("invoice-%s.%s", order.InvoiceNumber, format),
+				ContentType: format.ContentType(),
+				Content:     buf.String(),
+			}
+			if format == documents.FormatPDF {
+				file.Content = base64.StdEncoding.EncodeToString(buf.Bytes())
+			}
+			return file, nil
+		},
+	}
+}
+
+// orderError gives sales failures a code: NOT_FOUND for missing cars, buyers and orders,
+// CAR_RESERVED for cars held by another customer, INVALID_TRANSITION for cars that are
+// not for sale and cancelled orders, and CONFLICT for a car that already has an open order
+// or an order that still has money paid on it. Other errors pass through.
+func orderError(err error, carID int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFoundError("car %d not found", carID)
+	case errors.Is(err, repository.ErrOrderNotFound), errors.Is(err, repository.ErrBuyerNotFound):
+		return notFoundError("%s", err.Error())
+	case errors.Is(err, repository.ErrCarReserved):
+		return &codedError{code: CodeCarReserved, message: err.Error()}
+	case errors.Is(err, repository.ErrCarNotForSale), errors.Is(err, repository.ErrOrderCancelled):
+		return &codedError{code: CodeInvalidTransition, message: err.Error()}
+	case errors.Is(err, repository.ErrOpenOrder), errors.Is(err, repository.ErrOrderPaid):
+		return &codedError{code: CodeConflict, message: err.Error()}
+	}
+	return err
+}
+
+// visibleOrder returns the order if the signed-in user is an admin or its buyer
+func (res *Resolver) visibleOrder(ctx context.Context, id int) (models.Order, error) {
+	userID, err := customer(ctx)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order, err := res.Orders.Get(ctx, id)
+	if err != nil {
+		return models.Order{}, orderError(err, 0)
+	}
+	if order.BuyerID != userID && middleware.Authorize(ctx, middleware.RoleAdmin) != nil {
+		return models.Order{}, orderError(repository.ErrOrderNotFound, 0)
+	}
+	return order, nil
+}
+
+// orderQueryField returns one order to an admin or to its buyer
+func orderQueryField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: OrderType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, _ := p.Args["id"].(int)
+			order, err := res.visibleOrder(p.Context, id)
+			if err != nil {
+				return nil, err
+			}
+			return order, nil
+		},
+	}
+}
+
+// myOrdersField lists the signed-in customer's purchases, newest first
+func myOrdersField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(OrderType))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			return res.Orders.List(p.Context, repository.OrderFilter{BuyerID: &userID})
+		},
+	}
+}
+
+// ordersField lists orders for admins, newest first
+func ordersField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(OrderType))),
+		Args: graphql.FieldConfigArgument{
+			"buyerId":       &graphql.ArgumentConfig{Type: graphql.Int},
+			"carId":         &graphql.ArgumentConfig{Type: graphql.Int},
+			"status":        &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(OrderStatusEnum))},
+			"paymentStatus": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(PaymentStatusEnum))},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			filter := repository.OrderFilter{
+				Statuses:        parseStatuses(p.Args["status"]),
+				PaymentStatuses: parseStatuses(p.Args["paymentStatus"]),
+			}
+			if buyerID, ok := p.Args["buyerId"].(int); ok {
+				filter.BuyerID = &buyerID
+			}
+			if carID, ok := p.Args["carId"].(int); ok {
+				filter.CarID = &carID
+			}
+			return res.Orders.List(p.Context, filter)
+		},
+	}
+}
+
+// parseLineItems converts the lineItems argument of createOrder
+func parseLineItems(arg interface{}) []models.LineItem {
+	raw, _ := arg.([]interface{})
+	items := make([]models.LineItem, 0, len(raw))
+	for _, v := range raw {
+		m, _ := v.(map[string]interface{})
+		item := models.LineItem{}
+		item.Kind, _ = m["kind"].(string)
+		item.Description, _ = m["description"].(string)
+		item.Amount, _ = m["amount"].(float64)
+		if rate, ok := m["rate"].(float64); ok {
+			item.Rate = &rate
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// createOrderField sells a car to a buyer at the agreed price, marking the car sold
+func createOrderField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: OrderType,
+		Args: graphql.FieldConfigArgument{
+			"carId":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"buyerId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"price":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
+			// Fees are added to the price; taxes are charged on the price plus fees
+			"lineItems": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(LineItemInput))},
+			// Allow selling a car reserved by another customer
+			"overrideReservation": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			order := models.Order{LineItems: parseLineItems(p.Args["lineItems"])}
+			order.CarID, _ = p.Args["carId"].(int)
+			order.BuyerID, _ = p.Args["buyerId"].(int)
+			order.Price, _ = p.Args["price"].(float64)
+			if err := utils.ValidateOrder(order); err != nil {
+				return nil, err
+			}
+			order.PriceItems()
+			order.DueAt = time.Now().AddDate(0, 0, res.Sales.PaymentTermsDays)
+
+			created, err := res.Orders.Create(reservationContext(p), order)
+			if err != nil {
+				return nil, orderError(err, order.CarID)
+			}
+			return created, nil
+		},
+	}
+}
+
+// recordPaymentField records money received, or refunded, for an order
+func recordPaymentField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: OrderType,
+		Args: graphql.FieldConfigArgument{
+			"orderId": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			// Always positive; set refund to give money back
+			"amount":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"method":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(PaymentMethodEnum)},
+			"reference": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+			// Defaults to now
+			"receivedAt": &graphql.ArgumentConfig{Type: graphql.DateTime},
+			"refund":     &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			payment := models.Payment{ReceivedAt: time.Now()}
+			payment.OrderID, _ = p.Args["orderId"].(int)
+			payment.Amount, _ = p.Args["amount"].(float64)
+			payment.Method, _ = p.Args["method"].(string)
+			payment.Reference, _ = p.Args["reference"].(string)
+			if receivedAt, ok := p.Args["receivedAt"].(time.Time); ok {
+				payment.ReceivedAt = receivedAt
+			}
+			if payment.Amount <= 0 {
+				return nil, errors.New("amount must be greater than 0")
+			}
+			if refund, _ := p.Args["refund"].(bool); refund {
+				payment.Amount = -payment.Amount
+			}
+
+			order, err := res.Orders.RecordPayment(p.Context, payment)
+			if err != nil {
+				return nil, orderError(err, 0)
+			}
+			return order, nil
+		},
+	}
+}
+
+// cancelOrderField cancels an unpaid order and puts the car back on sale; the invoice number is kept
+func cancelOrderField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: OrderType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			id, _ := p.Args["id"].(int)
+			order, err := res.Orders.Cancel(p.Context, id)
+			if err != nil {
+				return nil, orderError(err, 0)
+			}
+			return order, nil
+		},
+	}
+}
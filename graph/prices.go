@@ -0,0 +1,134 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// PriceChangeType is one entry of a car's price history
+var PriceChangeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PriceChange",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		// Null for the price the car was listed at
+		"oldPrice": &graphql.Field{
+			Type: graphql.Float,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if pc := p.Source.(models.PriceChange); pc.OldPrice != nil {
+					return *pc.OldPrice, nil
+				}
+				return nil, nil
+			},
+		},
+		"newPrice": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.PriceChange).NewPrice, nil
+			},
+		},
+		"changedAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.PriceChange).ChangedAt, nil
+			},
+		},
+		// User who made the change; only shown to admins
+		"changedBy": &graphql.Field{
+			Type: graphql.Int,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				pc := p.Source.(models.PriceChange)
+				if pc.ChangedBy == nil || middleware.Authorize(p.Context, middleware.RoleAdmin) != nil {
+					return nil, nil
+				}
+				return *pc.ChangedBy, nil
+			},
+		},
+	},
+})
+
+// PriceDropType is a car advertised at a reduced price
+var PriceDropType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PriceDrop",
+	Fields: graphql.Fields{
+		"car": &graphql.Field{Type: graphql.NewNonNull(CarType)},
+		"previousPrice": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Float),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.PriceDrop).PreviousPrice, nil
+			},
+		},
+		"amount":  &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"percent": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		// Time of the car's latest price change
+		"changedAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(models.PriceDrop).ChangedAt, nil
+			},
+		},
+	},
+})
+
+type priceLoaderKey struct{}
+
+// priceLoader batches the price history of every car resolved at one level into a single query
+func (res *Resolver) priceLoader(ctx context.Context) *batchLoader[[]models.PriceChange] {
+	return requestLoader(ctx, priceLoaderKey{}, res.Cars.PriceHistory)
+}
+
+// carPriceHistoryField resolves Car.priceHistory through the request's price loader
+func carPriceHistoryField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(PriceChangeType))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			car, ok := p.Source.(models.Car)
+			if !ok {
+				return []models.PriceChange{}, nil
+			}
+			thunk := res.priceLoader(p.Context).Load(car.ID)
+			return func() (interface{}, error) {
+				history, _, err := thunk()
+				if err != nil {
+					return nil, err
+				}
+				if history == nil {
+					history = []models.PriceChange{}
+				}
+				return history, nil
+			}, nil
+		},
+	}
+}
+
+// recentPriceDropsField lists cars whose price fell since a given time, biggest drop first
+func recentPriceDropsField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(PriceDropType))),
+		Args: graphql.FieldConfigArgument{
+			"since":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.DateTime)},
+			"minPercent": &graphql.ArgumentConfig{Type: graphql.Float, DefaultValue: 0.0},
+			"limit":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultConnectionSize},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			since, ok := p.Args["since"].(time.Time)
+			if !ok {
+				return nil, errors.New("since must be an RFC 3339 date-time")
+			}
+			minPercent, _ := p.Args["minPercent"].(float64)
+			limit, _ := p.Args["limit"].(int)
+			if minPercent < 0 || minPercent > 100 {
+				return nil, errors.New("minPercent must be between 0 and 100")
+			}
+			if limit < 1 || limit > maxConnectionSize {
+				return nil, fmt.Errorf("limit must be between 1 and %d", maxConnectionSize)
+			}
+			return res.Cars.RecentPriceDrops(p.Context, since, minPercent, limit)
+		},
+	}
+}
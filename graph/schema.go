@@ -1,14 +1,17 @@
 package graph
 
 import (
-	"car-service/db"
+	"car-service/booking"
+	"car-service/config"
+	"car-service/documents"
 	"car-service/middleware"
 	"car-service/models"
+	"car-service/repository"
+	"car-service/storage"
 	"car-service/utils"
+	"car-service/vin"
 	"errors"
 	"fmt"
-	"math/rand"
-	"time"
 
 	"github.com/graphql-go/graphql"
 )
@@ -25,146 +28,207 @@ var CarType = graphql.NewObject(
 			"price":   &graphql.Field{Type: graphql.Float},
 			"color":   &graphql.Field{Type: graphql.String},
 			"mileage": &graphql.Field{Type: graphql.Int},
+			"vin":     &graphql.Field{Type: graphql.String},
+			"status":  &graphql.Field{Type: graphql.NewNonNull(CarStatusEnum)},
+			"statusChangedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if car, ok := p.Source.(models.Car); ok && car.StatusChangedAt != nil {
+						return *car.StatusChangedAt, nil
+					}
+					return nil, nil
+				},
+			},
+			// User who made the last status change; only shown to admins
+			"statusChangedBy": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					car, ok := p.Source.(models.Car)
+					if !ok || car.StatusChangedBy == nil || middleware.Authorize(p.Context, middleware.RoleAdmin) != nil {
+						return nil, nil
+					}
+					return *car.StatusChangedBy, nil
+				},
+			},
+			"version": &graphql.Field{Type: graphql.Int},
+			// Set only on cars returned by a search
+			"match": &graphql.Field{Type: searchMatchType},
+			// Set only on cars returned by trashedCars
+			"deletedAt": &graphql.Field{
+				Type: graphql.DateTime,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if car, ok := p.Source.(models.Car); ok && car.DeletedAt != nil {
+						return *car.DeletedAt, nil
+					}
+					return nil, nil
+				},
+			},
 		},
 	},
 )
 
-// RootQuery defines the entry point for queries
-var RootQuery = graphql.NewObject(
-	graphql.ObjectConfig{
+var highlightType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Highlight",
+	Description: "A field value with the matched words wrapped in <mark></mark>; the rest is HTML-escaped",
+	Fields: graphql.Fields{
+		"field":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"snippet": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var searchMatchType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SearchMatch",
+	Fields: graphql.Fields{
+		// Orders the cars of one search, higher first; not comparable across searches
+		"rank":       &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"highlights": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(highlightType)))},
+	},
+})
+
+// Resolver holds the dependencies shared by the GraphQL resolvers
+type Resolver struct {
+	Cars       repository.CarRepository
+	Sessions   repository.SessionRepository
+	Throttle   repository.LoginThrottleRepository
+	LoginCodes repository.LoginCodeRepository
+	Audit      repository.AuditRepository
+	Media      *storage.ImageService
+	// TestDrives books test drives and emails the confirmations
+	TestDrives *booking.Service
+	Tokens     *utils.TokenManager
+	Mailer     *utils.Mailer
+	Login      config.LoginConfig
+	Holds      config.HoldsConfig
+	// Orders records sales; Documents renders their invoices
+	Orders    repository.OrderRepository
+	Documents *documents.Renderer
+	Sales     config.SalesConfig
+}
+
+// newRootQuery defines the entry point for queries
+func newRootQuery(res *Resolver) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
 		Name: "RootQuery",
 		Fields: graphql.Fields{
 			"cars": &graphql.Field{
 				Type: graphql.NewList(CarType),
+				Args: graphql.FieldConfigArgument{
+					// Free text such as "red civic"; ranks the best matches first and sets match
+					"search": &graphql.ArgumentConfig{Type: graphql.String},
+					"status": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(CarStatusEnum))},
+				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					// Fetch cars from DB (Duplicated logic from handlers for simplicity)
-					rows, err := db.DB.Query("SELECT id, make, model, year, price, color, mileage FROM cars")
-					if err != nil {
-						return nil, err
-					}
-					defer rows.Close()
-
-					var cars []models.Car
-					for rows.Next() {
-						var c models.Car
-						if err := rows.Scan(&c.ID, &c.Make, &c.Model, &c.Year, &c.Price, &c.Color, &c.Mileage); err != nil {
+					search, _ := p.Args["search"].(string)
+					return res.Cars.List(p.Context, repository.ListOptions{Filter: repository.CarFilter{
+						Search:   search,
+						Statuses: parseStatuses(p.Args["status"]),
+					}})
+				},
+			},
+			"carsConnection":   carsConnectionField(res),
+			"auditEvents":      auditEventsField(res),
+			"trashedCars":      trashedCarsField(res),
+			"recentPriceDrops": recentPriceDropsField(res),
+			"myTestDrives":     myTestDrivesField(res),
+			"testDrives":       testDrivesField(res),
+			"testDriveFeedUrl": testDriveFeedURLField(res),
+			"order":            orderQueryField(res),
+			"myOrders":         myOrdersField(res),
+			"orders":           ordersField(res),
+			"car": &graphql.Field{
+				Type: CarType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(int)
+					thunk := res.carLoader(p.Context).Load(id)
+					return codedThunk(p, func() (interface{}, error) {
+						car, err := thunk()
+						if errors.Is(err, repository.ErrNotFound) {
+							return nil, notFoundError("car %d not found", id)
+						}
+						if err != nil {
 							return nil, err
 						}
-						cars = append(cars, c)
-					}
-					return cars, nil
+						return car, nil
+					}), nil
 				},
 			},
-		},
-	},
-)
-
-// RootMutation defines the entry point for mutations
-var RootMutation = graphql.NewObject(
-	graphql.ObjectConfig{
-		Name: "RootMutation",
-		Fields: graphql.Fields{
-			// --- Auth Mutations ---
-			"requestLogin": &graphql.Field{
-				Type: graphql.String,
+			"decodeVin": decodeVinField(),
+			"carByVin": &graphql.Field{
+				Type: CarType,
 				Args: graphql.FieldConfigArgument{
-					"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"vin": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					email, _ := p.Args["email"].(string)
-
-					// 1. Ensure user exists (Upsert) - Default role is 'user' via DB default
-					var userID int
-					fmt.Printf("Attempting to login/register email: %s\n", email)
-					err := db.DB.QueryRow("INSERT INTO users (email) VALUES ($1) ON CONFLICT (email) DO UPDATE SET email=EXCLUDED.email RETURNING id", email).Scan(&userID)
-					if err != nil {
-						fmt.Printf("Database error during user upsert: %v\n", err)
-						return nil, fmt.Errorf("database error: %v", err)
-					}
-					fmt.Printf("User ID for %s is %d\n", email, userID)
-
-					// 2. Generate 6-digit code
-					rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-					code := fmt.Sprintf("%06d", rng.Intn(1000000))
-
-					// 3. Save code to DB
-					expiry := time.Now().Add(15 * time.Minute)
-					_, err = db.DB.Exec("INSERT INTO verification_codes (user_id, code, expires_at) VALUES ($1, $2, $3)", userID, code, expiry)
-					if err != nil {
-						return nil, fmt.Errorf("failed to save code: %v", err)
+					rawVIN, _ := p.Args["vin"].(string)
+					normalized := utils.NormalizeVIN(rawVIN)
+					car, err := res.Cars.GetByVIN(p.Context, normalized)
+					if errors.Is(err, repository.ErrNotFound) {
+						return nil, notFoundError("no car with VIN %s", normalized)
 					}
-
-					// 4. Send Email
-					err = utils.SendOTP(email, code)
 					if err != nil {
-						return nil, fmt.Errorf("failed to send email: %v", err)
+						return nil, err
 					}
-
-					return "Verification code sent to email", nil
+					return car, nil
 				},
 			},
-			"verifyLogin": &graphql.Field{
-				Type: graphql.String, // Returns JWT Token
+			"carsByIds": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(CarType)),
 				Args: graphql.FieldConfigArgument{
-					"email": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-					"code":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"ids": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.Int)))},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					email, _ := p.Args["email"].(string)
-					code, _ := p.Args["code"].(string)
-
-					// 1. Get User ID and Role
-					var userID int
-					var role string
-					err := db.DB.QueryRow("SELECT id, role FROM users WHERE email=$1", email).Scan(&userID, &role)
-					if err != nil {
-						return nil, errors.New("user not found")
-					}
-
-					// 2. Verify Code
-					var dbCode string
-					var expiresAt time.Time
-					err = db.DB.QueryRow("SELECT code, expires_at FROM verification_codes WHERE user_id=$1 AND code=$2 ORDER BY created_at DESC LIMIT 1", userID, code).Scan(&dbCode, &expiresAt)
-					if err != nil {
-						return nil, errors.New("invalid code")
+					rawIDs, _ := p.Args["ids"].([]interface{})
+					if len(rawIDs) > maxConnectionSize {
+						return nil, fmt.Errorf("at most %d ids can be requested at once", maxConnectionSize)
 					}
-
-					if time.Now().After(expiresAt) {
-						return nil, errors.New("code expired")
-					}
-
-					// 3. Generate JWT with Role
-					token, err := utils.GenerateToken(userID, role)
-					if err != nil {
-						return nil, fmt.Errorf("failed to generate token: %v", err)
+					ids := make([]int, len(rawIDs))
+					for i, raw := range rawIDs {
+						ids[i], _ = raw.(int)
 					}
-
-					// 4. Clean up used codes (optional)
-					_, _ = db.DB.Exec("DELETE FROM verification_codes WHERE user_id=$1", userID)
-
-					return token, nil
+					// Entries for unknown IDs stay null, the rest keep the input order
+					return res.carLoader(p.Context).LoadMany(ids)()
 				},
 			},
+		},
+	})
+}
+
+// newRootMutation defines the entry point for mutations
+func newRootMutation(res *Resolver) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: "RootMutation",
+		Fields: graphql.Fields{
+			// --- Auth Mutations ---
+			"requestLogin": requestLoginField(res),
+			"verifyLogin":  verifyLoginField(res),
+			"refreshToken": refreshTokenField(res),
+			"logout":       logoutField(res),
 
 			// --- Car Mutations (Protected) ---
 			"createCar": &graphql.Field{
 				Type: CarType,
 				Args: graphql.FieldConfigArgument{
-					"make":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					// make and year may be left out with autofill
+					"make":    &graphql.ArgumentConfig{Type: graphql.String},
 					"model":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
-					"year":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"year":    &graphql.ArgumentConfig{Type: graphql.Int},
 					"price":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
 					"color":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
 					"mileage": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"vin":     &graphql.ArgumentConfig{Type: graphql.String},
+					// DRAFT or AVAILABLE (the default)
+					"status": &graphql.ArgumentConfig{Type: CarStatusEnum, DefaultValue: models.StatusAvailable},
+					// Fill a missing make and year from the VIN; supplied values that disagree
+					// with it fail with VIN_MISMATCH
+					"autofill": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					// Auth Check
-					if p.Context.Value(middleware.UserIDKey) == nil {
-						return nil, errors.New("unauthorized")
-					}
-					// RBAC Check
-					if p.Context.Value(middleware.RoleKey) != "admin" {
-						return nil, errors.New("forbidden: admins only")
+					// Auth + RBAC Check (same policy as the REST write routes)
+					if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+						return nil, err
 					}
 
 					make, _ := p.Args["make"].(string)
@@ -173,6 +237,11 @@ var RootMutation = graphql.NewObject(
 					price, _ := p.Args["price"].(float64)
 					color, _ := p.Args["color"].(string)
 					mileage, _ := p.Args["mileage"].(int)
+					rawVIN, _ := p.Args["vin"].(string)
+					status, _ := p.Args["status"].(string)
+					if !models.IsInitialStatus(status) {
+						return nil, errors.New("a new car must be DRAFT or AVAILABLE")
+					}
 
 					car := models.Car{
 						Make:    make,
@@ -181,22 +250,38 @@ var RootMutation = graphql.NewObject(
 						Price:   price,
 						Color:   color,
 						Mileage: mileage,
+						VIN:     utils.NormalizeVIN(rawVIN),
+						Status:  status,
 					}
 
+					if autofill, _ := p.Args["autofill"].(bool); autofill {
+						if err := vin.Autofill(&car); err != nil {
+							return nil, vinMismatchError(err)
+						}
+					}
+					if car.Make == "" {
+						return nil, errors.New("make is required; autofill only knows the manufacturers in its bundled WMI table")
+					}
 					if err := utils.ValidateCar(car); err != nil {
 						return nil, err
 					}
 
-					err := db.DB.QueryRow(
-						"INSERT INTO cars (make, model, year, price, color, mileage) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-						car.Make, car.Model, car.Year, car.Price, car.Color, car.Mileage).Scan(&car.ID)
-
+					car, err := res.Cars.Create(p.Context, car)
 					if err != nil {
-						return nil, err
+						return nil, conflictError(err)
 					}
 					return car, nil
 				},
 			},
+			"changeCarStatus":  changeCarStatusField(res),
+			"bookTestDrive":    bookTestDriveField(res),
+			"confirmTestDrive": confirmTestDriveField(res),
+			"cancelTestDrive":  cancelTestDriveField(res),
+			"reserveCar":       reserveCarField(res),
+			"releaseCar":       releaseCarField(res),
+			"createOrder":      createOrderField(res),
+			"recordPayment":    recordPaymentField(res),
+			"cancelOrder":      cancelOrderField(res),
 			"updateCar": &graphql.Field{
 				Type: CarType,
 				Args: graphql.FieldConfigArgument{
@@ -207,22 +292,23 @@ var RootMutation = graphql.NewObject(
 					"price":   &graphql.ArgumentConfig{Type: graphql.Float},
 					"color":   &graphql.ArgumentConfig{Type: graphql.String},
 					"mileage": &graphql.ArgumentConfig{Type: graphql.Int},
+					// An empty string removes the VIN
+					"vin": &graphql.ArgumentConfig{Type: graphql.String},
+					// Fail with a CONFLICT error unless the car is still at this version
+					"expectedVersion": &graphql.ArgumentConfig{Type: graphql.Int},
+					// Allow changing the price of a reserved car
+					"overrideReservation": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					// Auth Check
-					if p.Context.Value(middleware.UserIDKey) == nil {
-						return nil, errors.New("unauthorized")
-					}
-					// RBAC Check
-					if p.Context.Value(middleware.RoleKey) != "admin" {
-						return nil, errors.New("forbidden: admins only")
+					// Auth + RBAC Check (same policy as the REST write routes)
+					if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+						return nil, err
 					}
 
 					id, _ := p.Args["id"].(int)
+					expectedVersion, _ := p.Args["expectedVersion"].(int)
 
-					var car models.Car
-					err := db.DB.QueryRow("SELECT id, make, model, year, price, color, mileage FROM cars WHERE id=$1", id).
-						Scan(&car.ID, &car.Make, &car.Model, &car.Year, &car.Price, &car.Color, &car.Mileage)
+					car, err := res.Cars.Get(p.Context, id)
 					if err != nil {
 						return nil, err
 					}
@@ -245,54 +331,71 @@ var RootMutation = graphql.NewObject(
 					if val, ok := p.Args["mileage"].(int); ok {
 						car.Mileage = val
 					}
+					if val, ok := p.Args["vin"].(string); ok {
+						car.VIN = utils.NormalizeVIN(val)
+					}
 
 					if err := utils.ValidateCar(car); err != nil {
 						return nil, err
 					}
 
-					_, err = db.DB.Exec("UPDATE cars SET make=$1, model=$2, year=$3, price=$4, color=$5, mileage=$6 WHERE id=$7",
-						car.Make, car.Model, car.Year, car.Price, car.Color, car.Mileage, car.ID)
+					car, err = res.Cars.Update(reservationContext(p), car, expectedVersion)
 					if err != nil {
-						return nil, err
+						return nil, conflictError(err)
 					}
-
 					return car, nil
 				},
 			},
+			"uploadCarImage":     uploadCarImageField(res),
+			"deleteCarImage":     deleteCarImageField(res),
+			"setPrimaryCarImage": setPrimaryCarImageField(res),
+			"reorderCarImages":   reorderCarImagesField(res),
+			"restoreCar":         restoreCarField(res),
+			"purgeCar":           purgeCarField(res),
 			"deleteCar": &graphql.Field{
 				Type: graphql.Boolean,
 				Args: graphql.FieldConfigArgument{
-					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"id":              &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"expectedVersion": &graphql.ArgumentConfig{Type: graphql.Int},
+					// Allow deleting a reserved car
+					"overrideReservation": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
 				},
 				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
-					// Auth Check
-					if p.Context.Value(middleware.UserIDKey) == nil {
-						return false, errors.New("unauthorized")
-					}
-					// RBAC Check
-					if p.Context.Value(middleware.RoleKey) != "admin" {
-						return false, errors.New("forbidden: admins only")
+					// Auth + RBAC Check (same policy as the REST write routes)
+					if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+						return false, err
 					}
 
 					id, _ := p.Args["id"].(int)
-					res, err := db.DB.Exec("DELETE FROM cars WHERE id=$1", id)
+					expectedVersion, _ := p.Args["expectedVersion"].(int)
+					err := res.Cars.Delete(reservationContext(p), id, expectedVersion)
+					if errors.Is(err, repository.ErrNotFound) {
+						return false, nil
+					}
 					if err != nil {
-						return false, err
+						return false, conflictError(err)
 					}
-					params, _ := res.RowsAffected()
-					return params > 0, nil
+					return true, nil
 				},
 			},
 		},
-	},
-)
+	})
+}
 
 // InitSchema creates and returns the GraphQL schema
-func InitSchema() (graphql.Schema, error) {
+func InitSchema(res *Resolver) (graphql.Schema, error) {
+	// Car.images, Car.priceHistory, Car.hold, TestDrive.car, Order.car and Order.invoice need
+	// the resolver, so they are attached here
+	CarType.AddFieldConfig("images", carImagesField(res))
+	CarType.AddFieldConfig("priceHistory", carPriceHistoryField(res))
+	CarType.AddFieldConfig("hold", carHoldField(res))
+	TestDriveType.AddFieldConfig("car", testDriveCarField(res))
+	OrderType.AddFieldConfig("car", orderCarField(res))
+	OrderType.AddFieldConfig("invoice", orderInvoiceField(res))
 	return graphql.NewSchema(
 		graphql.SchemaConfig{
-			Query:    RootQuery,
-			Mutation: RootMutation,
+			Query:    newRootQuery(res),
+			Mutation: newRootMutation(res),
 		},
 	)
 }
@@ -0,0 +1,482 @@
+package graph
+
+import (
+	"car-service/booking"
+	"car-service/config"
+	"car-service/documents"
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+func newTestSchema(t *testing.T, repo repository.CarRepository) graphql.Schema {
+	t.Helper()
+	schema, err := InitSchema(&Resolver{Cars: repo})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return schema
+}
+
+func adminContext() context.Context {
+	ctx := context.WithValue(context.Background(), middleware.UserIDKey, 1)
+	return context.WithValue(ctx, middleware.RoleKey, "admin")
+}
+
+func TestCarsQuery(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000, Color: "Red", Mileage: 100})
+	schema := newTestSchema(t, repo)
+
+	result := graphql.Do(graphql.Params{
+		Schema:        schema,
+		RequestString: `{ cars { id make model } }`,
+		Context:       context.Background(),
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+
+	cars := result.Data.(map[string]interface{})["cars"].([]interface{})
+	if len(cars) != 1 {
+		t.Fatalf("Expected 1 car, got %d", len(cars))
+	}
+	if make := cars[0].(map[string]interface{})["make"]; make != "Honda" {
+		t.Errorf("Expected make Honda, got %v", make)
+	}
+}
+
+func TestCreateCarRequiresAdmin(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	schema := newTestSchema(t, repo)
+	mutation := `mutation { createCar(make: "Tesla", model: "3", year: 2023, price: 40000, color: "White", mileage: 0) { id } }`
+
+	// Test Anonymous Caller
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: mutation, Context: context.Background()})
+	if len(result.Errors) == 0 {
+		t.Error("Expected unauthorized error, got nil")
+	}
+
+	// Test Admin Caller
+	result = graphql.Do(graphql.Params{Schema: schema, RequestString: mutation, Context: adminContext()})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	cars, _ := repo.List(context.Background(), repository.ListOptions{})
+	if len(cars) != 1 {
+		t.Errorf("Expected 1 stored car, got %d", len(cars))
+	}
+}
+
+func TestUpdateCarExpectedVersionConflict(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000, Color: "Red"})
+	schema := newTestSchema(t, repo)
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { updateCar(id: 1, price: 19000, expectedVersion: 1) { version } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if v := result.Data.(map[string]interface{})["updateCar"].(map[string]interface{})["version"]; v != 2 {
+		t.Errorf("Expected version 2, got %v", v)
+	}
+
+	// A second writer still holding version 1 must not overwrite the change
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { updateCar(id: 1, price: 18000, expectedVersion: 1) { version } }`})
+	if len(result.Errors) != 1 {
+		t.Fatalf("Expected 1 error, got %v", result.Errors)
+	}
+	ext := result.Errors[0].Extensions
+	if ext["code"] != CodeConflict || ext["currentVersion"] != 2 {
+		t.Errorf("Expected CONFLICT with currentVersion 2, got %v", ext)
+	}
+	if car, _ := repo.Get(context.Background(), 1); car.Price != 19000 {
+		t.Errorf("Expected price to stay 19000, got %v", car.Price)
+	}
+}
+
+func TestCarByVinAndDuplicateVIN(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	schema := newTestSchema(t, repo)
+	mutation := `mutation { createCar(make: "Honda", model: "Accord", year: 2003, price: 4000, color: "Black", mileage: 150000, vin: " 1hgcm82633a004352") { id vin } }`
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: adminContext(), RequestString: mutation})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if vin := result.Data.(map[string]interface{})["createCar"].(map[string]interface{})["vin"]; vin != "1HGCM82633A004352" {
+		t.Errorf("Expected the VIN to be normalized, got %v", vin)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(), RequestString: mutation})
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeConflict || result.Errors[0].Extensions["field"] != "vin" {
+		t.Fatalf("Expected a CONFLICT error on vin, got %v", result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ carByVin(vin: "1HGCM82633A004352") { model } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if model := result.Data.(map[string]interface{})["carByVin"].(map[string]interface{})["model"]; model != "Accord" {
+		t.Errorf("Expected Accord, got %v", model)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ carByVin(vin: "JH4KA7561PC008269") { id } }`})
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeNotFound {
+		t.Errorf("Expected NOT_FOUND, got %v", result.Errors)
+	}
+}
+
+func TestDecodeVinAndAutofill(t *testing.T) {
+	schema := newTestSchema(t, repository.NewMemoryCarRepository())
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ decodeVin(vin: "1HGCM82633A004352") { make manufacturer country modelYear } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	decoded := result.Data.(map[string]interface{})["decodeVin"].(map[string]interface{})
+	if decoded["make"] != "Honda" || decoded["country"] != "United States" || decoded["modelYear"] != 2003 {
+		t.Errorf("Unexpected decoding %v", decoded)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { createCar(model: "Accord", price: 4000, color: "Black", mileage: 0, vin: "1HGCM82633A004352", autofill: true) { make year } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if car := result.Data.(map[string]interface{})["createCar"].(map[string]interface{}); car["make"] != "Honda" || car["year"] != 2003 {
+		t.Errorf("Expected Honda 2003, got %v", car)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { createCar(make: "Honda", year: 2010, model: "Accord", price: 4000, color: "Black", mileage: 0, vin: "1HGCM82633A004352", autofill: true) { id } }`})
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeVINMismatch {
+		t.Fatalf("Expected VIN_MISMATCH, got %v", result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { createCar(model: "Accord", year: 2003, price: 4000, color: "Black", mileage: 0) { id } }`})
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected make to be required without autofill, got %v", result.Errors)
+	}
+}
+
+func TestCarsSearch(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"})
+	repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Accord", Year: 2021, Price: 24000, Color: "Red"})
+	schema := newTestSchema(t, repo)
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ cars(search: "red civik") { model match { rank highlights { field snippet } } } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	cars := result.Data.(map[string]interface{})["cars"].([]interface{})
+	if len(cars) != 1 {
+		t.Fatalf("Expected only the Civic, got %v", cars)
+	}
+	highlights := cars[0].(map[string]interface{})["match"].(map[string]interface{})["highlights"].([]interface{})
+	if len(highlights) != 2 || highlights[0].(map[string]interface{})["snippet"] != "<mark>Civic</mark>" {
+		t.Errorf("Unexpected highlights %v", highlights)
+	}
+}
+
+func TestPriceHistoryAndRecentPriceDrops(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 20000, Color: "Red"})
+	schema := newTestSchema(t, repo)
+	since := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { updateCar(id: 1, price: 15000) { priceHistory { oldPrice newPrice changedBy } } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	history := result.Data.(map[string]interface{})["updateCar"].(map[string]interface{})["priceHistory"].([]interface{})
+	if len(history) != 2 || history[0].(map[string]interface{})["oldPrice"] != nil ||
+		history[1].(map[string]interface{})["oldPrice"] != 20000.0 || history[1].(map[string]interface{})["changedBy"] != 1 {
+		t.Errorf("Unexpected history %v", history)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ recentPriceDrops(since: "` + since + `", minPercent: 20) { car { model } previousPrice amount percent } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	drops := result.Data.(map[string]interface{})["recentPriceDrops"].([]interface{})
+	if len(drops) != 1 || drops[0].(map[string]interface{})["percent"] != 25.0 || drops[0].(map[string]interface{})["amount"] != 5000.0 {
+		t.Errorf("Unexpected drops %v", drops)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ recentPriceDrops(since: "` + since + `", minPercent: 150) { percent } }`})
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected minPercent to be validated, got %v", result.Errors)
+	}
+}
+
+func TestChangeCarStatus(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	schema := newTestSchema(t, repo)
+	result := graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { createCar(make: "Honda", model: "Civic", year: 2018, price: 15000, color: "Red", mileage: 0, status: DRAFT) { status } }`})
+	if len(result.Errors) > 0 || result.Data.(map[string]interface{})["createCar"].(map[string]interface{})["status"] != "DRAFT" {
+		t.Fatalf("Expected a DRAFT car, got %v %v", result.Data, result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `mutation { changeCarStatus(id: 1, status: AVAILABLE) { status } }`})
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected anonymous callers to be refused, got %v", result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { changeCarStatus(id: 1, status: SOLD) { status } }`})
+	if len(result.Errors) != 1 {
+		t.Fatalf("Expected 1 error, got %v", result.Errors)
+	}
+	ext := result.Errors[0].Extensions
+	if ext["code"] != CodeInvalidTransition || ext["from"] != "DRAFT" || ext["to"] != "SOLD" {
+		t.Errorf("Expected INVALID_TRANSITION from DRAFT to SOLD, got %v", ext)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { changeCarStatus(id: 1, status: AVAILABLE) { status statusChangedBy version } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	if car := result.Data.(map[string]interface{})["changeCarStatus"].(map[string]interface{}); car["status"] != "AVAILABLE" || car["statusChangedBy"] != 1 || car["version"] != 2 {
+		t.Errorf("Unexpected car %v", car)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: context.Background(),
+		RequestString: `{ available: cars(status: [AVAILABLE]) { id statusChangedBy } sold: carsConnection(filter: { status: [SOLD] }) { totalCount } }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	data := result.Data.(map[string]interface{})
+	available := data["available"].([]interface{})
+	if len(available) != 1 || available[0].(map[string]interface{})["statusChangedBy"] != nil {
+		t.Errorf("Expected 1 available car without statusChangedBy for anonymous callers, got %v", available)
+	}
+	if total := data["sold"].(map[string]interface{})["totalCount"]; total != 0 {
+		t.Errorf("Expected no sold cars, got %v", total)
+	}
+}
+
+func TestBookTestDrive(t *testing.T) {
+	cars := repository.NewMemoryCarRepository()
+	cars.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"})
+	drives, err := booking.NewService(repository.NewMemoryTestDriveRepository(), cars, nil, config.Default().Bookings, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create booking service: %v", err)
+	}
+	schema, err := InitSchema(&Resolver{Cars: cars, TestDrives: drives})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	customer := func(id int) context.Context {
+		ctx := context.WithValue(context.Background(), middleware.UserIDKey, id)
+		return context.WithValue(ctx, middleware.RoleKey, middleware.RoleUser)
+	}
+
+	// 10:00 UTC on the next weekday at least two days away, within the default opening hours
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 2).Add(10 * time.Hour)
+	for start.Weekday() == time.Saturday || start.Weekday() == time.Sunday {
+		start = start.AddDate(0, 0, 1)
+	}
+	book := `mutation ($start: DateTime!) { bookTestDrive(carId: 1, start: $start, durationMinutes: 30) { id status car { model } } }`
+	vars := map[string]interface{}{"start": start.Format(time.RFC3339)}
+
+	result := graphql.Do(graphql.Params{Schema: schema, Context: context.Background(), RequestString: book, VariableValues: vars})
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected anonymous callers to be refused, got %v", result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: customer(7), RequestString: book, VariableValues: vars})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	td := result.Data.(map[string]interface{})["bookTestDrive"].(map[string]interface{})
+	if td["status"] != "PENDING" || td["car"].(map[string]interface{})["model"] != "Civic" {
+		t.Errorf("Unexpected booking %v", td)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: customer(8), RequestString: book, VariableValues: vars})
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeConflict {
+		t.Errorf("Expected a CONFLICT for the taken slot, got %v", result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: customer(7),
+		RequestString: `mutation { confirmTestDrive(id: 1) { status } }`})
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected customers to be refused confirmation, got %v", result.Errors)
+	}
+	result = graphql.Do(graphql.Params{Schema: schema, Context: adminContext(),
+		RequestString: `mutation { confirmTestDrive(id: 1) { status } }`})
+	if len(result.Errors) > 0 || result.Data.(map[string]interface{})["confirmTestDrive"].(map[string]interface{})["status"] != "CONFIRMED" {
+		t.Errorf("Expected the admin to confirm, got %v %v", result.Data, result.Errors)
+	}
+
+	result = graphql.Do(graphql.Params{Schema: schema, Context: customer(7),
+		RequestString: `{ myTestDrives { id status } testDriveFeedUrl }`})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	data := result.Data.(map[string]interface{})
+	if mine := data["myTestDrives"].([]interface{}); len(mine) != 1 {
+		t.Errorf("Expected 1 booking, got %v", mine)
+	}
+	if url, _ := data["testDriveFeedUrl"].(string); !strings.Contains(url, "token=7.") {
+		t.Errorf("Unexpected feed URL %q", url)
+	}
+}
+
+func TestReserveCar(t *testing.T) {
+	cars := repository.NewMemoryCarRepository()
+	cars.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"})
+	schema, err := InitSchema(&Resolver{Cars: cars, Holds: config.Default().Holds})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	customer := func(id int) context.Context {
+		ctx := context.WithValue(context.Background(), middleware.UserIDKey, id)
+		return context.WithValue(ctx, middleware.RoleKey, middleware.RoleUser)
+	}
+	do := func(ctx context.Context, query string) *graphql.Result {
+		return graphql.Do(graphql.Params{Schema: schema, Context: ctx, RequestString: query})
+	}
+
+	// 3000000 hours overflows time.Duration
+	for _, hours := range []int{1000, 3000000} {
+		if result := do(customer(7), fmt.Sprintf(`mutation { reserveCar(carId: 1, hours: %d) { id } }`, hours)); len(result.Errors) != 1 {
+			t.Errorf("Expected %d hours to be refused, got %v", hours, result.Errors)
+		}
+	}
+	result := do(customer(7), `mutation { reserveCar(carId: 1) { status hold { userId mine expiresAt } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	car := result.Data.(map[string]interface{})["reserveCar"].(map[string]interface{})
+	hold := car["hold"].(map[string]interface{})
+	if car["status"] != "RESERVED" || hold["userId"] != 7 || hold["mine"] != true {
+		t.Errorf("Unexpected reservation %v", car)
+	}
+
+	// Other customers see that the car is held, but not by whom
+	result = do(customer(8), `{ car(id: 1) { hold { userId mine } } }`)
+	hold = result.Data.(map[string]interface{})["car"].(map[string]interface{})["hold"].(map[string]interface{})
+	if hold["userId"] != nil || hold["mine"] != false {
+		t.Errorf("Expected the holder to be hidden, got %v", hold)
+	}
+	if result := do(customer(8), `mutation { reserveCar(carId: 1) { id } }`); len(result.Errors) != 1 ||
+		result.Errors[0].Extensions["code"] != CodeCarReserved {
+		t.Errorf("Expected CAR_RESERVED, got %v", result.Errors)
+	}
+
+	result = do(adminContext(), `mutation { updateCar(id: 1, price: 14000) { price } }`)
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeCarReserved {
+		t.Errorf("Expected the price change to be refused, got %v", result.Errors)
+	}
+	result = do(adminContext(), `mutation { updateCar(id: 1, price: 14000, overrideReservation: true) { price } }`)
+	if len(result.Errors) > 0 {
+		t.Errorf("Expected the override to allow the price change, got %v", result.Errors)
+	}
+
+	if result := do(customer(8), `mutation { releaseCar(carId: 1) { status } }`); len(result.Errors) != 1 ||
+		result.Errors[0].Extensions["code"] != CodeNotFound {
+		t.Errorf("Expected another customer's release to fail, got %v", result.Errors)
+	}
+	result = do(customer(7), `mutation { releaseCar(carId: 1) { status hold { mine } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	car = result.Data.(map[string]interface{})["releaseCar"].(map[string]interface{})
+	if car["status"] != "AVAILABLE" || car["hold"] != nil {
+		t.Errorf("Expected the car back on sale, got %v", car)
+	}
+}
+
+func TestSalesOrders(t *testing.T) {
+	cars := repository.NewMemoryCarRepository()
+	cars.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"})
+	orders := repository.NewMemoryOrderRepository(cars, "INV-")
+	renderer := documents.NewRenderer(repository.NewMemoryDocumentTemplateRepository(), config.Default().Documents)
+	schema, err := InitSchema(&Resolver{Cars: cars, Orders: orders, Documents: renderer, Sales: config.Default().Sales})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	customer := func(id int) context.Context {
+		ctx := context.WithValue(context.Background(), middleware.UserIDKey, id)
+		return context.WithValue(ctx, middleware.RoleKey, middleware.RoleUser)
+	}
+	do := func(ctx context.Context, query string) *graphql.Result {
+		return graphql.Do(graphql.Params{Schema: schema, Context: ctx, RequestString: query})
+	}
+
+	create := `mutation { createOrder(carId: 1, buyerId: 7, price: 14500, lineItems: [
+		{kind: FEE, description: "Documentation fee", amount: 500},
+		{kind: TAX, description: "Sales tax", rate: 10}
+	]) { invoiceNumber subtotal total balance paymentStatus lineItems { amount } car { status } } }`
+	if result := do(customer(7), create); len(result.Errors) != 1 {
+		t.Errorf("Expected customers to be refused, got %v", result.Errors)
+	}
+	result := do(adminContext(), create)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	order := result.Data.(map[string]interface{})["createOrder"].(map[string]interface{})
+	if order["invoiceNumber"] != "INV-000001" || order["subtotal"] != 15000.0 || order["total"] != 16500.0 ||
+		order["paymentStatus"] != "UNPAID" || order["car"].(map[string]interface{})["status"] != "SOLD" {
+		t.Errorf("Unexpected order %v", order)
+	}
+	if result := do(adminContext(), create); len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeInvalidTransition {
+		t.Errorf("Expected a sold car to be refused, got %v", result.Errors)
+	}
+	result = do(adminContext(), `mutation { createOrder(carId: 999, buyerId: 7, price: 14500) { id } }`)
+	if errorCode(result) != CodeNotFound || result.Errors[0].Message != "car 999 not found" {
+		t.Errorf("Expected car 999 to be reported missing, got %v", result.Errors)
+	}
+
+	result = do(adminContext(), `mutation { recordPayment(orderId: 1, amount: 6500, method: BANK_TRANSFER) { balance paymentStatus payments { amount method } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	order = result.Data.(map[string]interface{})["recordPayment"].(map[string]interface{})
+	if order["balance"] != 10000.0 || order["paymentStatus"] != "PARTIALLY_PAID" {
+		t.Errorf("Unexpected order after payment %v", order)
+	}
+	if result := do(adminContext(), `mutation { cancelOrder(id: 1) { status } }`); len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeConflict {
+		t.Errorf("Expected a paid order to be kept, got %v", result.Errors)
+	}
+
+	// Buyers see their own orders and invoices; other customers do not
+	result = do(customer(7), `{ myOrders { invoiceNumber } order(id: 1) { invoice(format: PDF) { filename contentType } } }`)
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", result.Errors)
+	}
+	data := result.Data.(map[string]interface{})
+	invoice := data["order"].(map[string]interface{})["invoice"].(map[string]interface{})
+	if len(data["myOrders"].([]interface{})) != 1 || invoice["filename"] != "invoice-INV-000001.pdf" || invoice["contentType"] != "application/pdf" {
+		t.Errorf("Unexpected buyer view %v", data)
+	}
+	if result := do(customer(8), `{ order(id: 1) { id } }`); len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != CodeNotFound {
+		t.Errorf("Expected another customer's order to be hidden, got %v", result.Errors)
+	}
+	if result := do(customer(8), `{ orders { id } }`); len(result.Errors) != 1 {
+		t.Errorf("Expected the order list to be admin only, got %v", result.Errors)
+	}
+}
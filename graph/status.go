@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"errors"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+// CarStatusEnum is the inventory lifecycle status of a car
+var CarStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "CarStatus",
+	Values: graphql.EnumValueConfigMap{
+		"DRAFT":     &graphql.EnumValueConfig{Value: models.StatusDraft},
+		"AVAILABLE": &graphql.EnumValueConfig{Value: models.StatusAvailable},
+		"RESERVED":  &graphql.EnumValueConfig{Value: models.StatusReserved},
+		"SOLD":      &graphql.EnumValueConfig{Value: models.StatusSold},
+	},
+})
+
+// parseStatuses reads a [CarStatus!] argument
+func parseStatuses(arg interface{}) []string {
+	raw, _ := arg.([]interface{})
+	var statuses []string
+	for _, v := range raw {
+		if s, ok := v.(string); ok {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses
+}
+
+// transitionError converts a *repository.StatusTransitionError into an INVALID_TRANSITION
+// error naming the statuses the car may move to. Other errors go through conflictError.
+func transitionError(err error) error {
+	var transition *repository.StatusTransitionError
+	if !errors.As(err, &transition) {
+		return conflictError(err)
+	}
+	allowed := make([]string, len(transition.Allowed))
+	for i, s := range transition.Allowed {
+		allowed[i] = strings.ToUpper(s)
+	}
+	return &codedError{
+		code:    CodeInvalidTransition,
+		message: transition.Error(),
+		extra: map[string]interface{}{
+			"from":    strings.ToUpper(transition.From),
+			"to":      strings.ToUpper(transition.To),
+			"allowed": allowed,
+		},
+	}
+}
+
+// changeCarStatusField moves a car along the inventory lifecycle
+func changeCarStatusField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Args: graphql.FieldConfigArgument{
+			"id":              &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"status":          &graphql.ArgumentConfig{Type: graphql.NewNonNull(CarStatusEnum)},
+			"expectedVersion": &graphql.ArgumentConfig{Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			id, _ := p.Args["id"].(int)
+			status, _ := p.Args["status"].(string)
+			expectedVersion, _ := p.Args["expectedVersion"].(int)
+
+			car, err := res.Cars.SetStatus(p.Context, id, status, expectedVersion)
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, notFoundError("car %d not found", id)
+			}
+			if err != nil {
+				return nil, transitionError(err)
+			}
+			return car, nil
+		},
+	}
+}
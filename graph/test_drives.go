@@ -0,0 +1,237 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// TestDriveStatusEnum is the status of a test drive booking
+var TestDriveStatusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "TestDriveStatus",
+	Values: graphql.EnumValueConfigMap{
+		"PENDING":   &graphql.EnumValueConfig{Value: models.TestDrivePending},
+		"CONFIRMED": &graphql.EnumValueConfig{Value: models.TestDriveConfirmed},
+		"CANCELLED": &graphql.EnumValueConfig{Value: models.TestDriveCancelled},
+	},
+})
+
+func testDriveField(get func(models.TestDrive) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(models.TestDrive)), nil
+	}
+}
+
+// TestDriveType is a booked test drive; TestDrive.car is attached in InitSchema
+var TestDriveType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TestDrive",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"carId": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Int),
+			Resolve: testDriveField(func(td models.TestDrive) interface{} { return td.CarID }),
+		},
+		"userId": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.Int),
+			Resolve: testDriveField(func(td models.TestDrive) interface{} { return td.UserID }),
+		},
+		"start":  &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"end":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"status": &graphql.Field{Type: graphql.NewNonNull(TestDriveStatusEnum)},
+		"createdAt": &graphql.Field{
+			Type:    graphql.NewNonNull(graphql.DateTime),
+			Resolve: testDriveField(func(td models.TestDrive) interface{} { return td.CreatedAt }),
+		},
+	},
+})
+
+// testDriveCarField resolves TestDrive.car through the request's CarLoader; null once the car is deleted
+func testDriveCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			thunk := res.carLoader(p.Context).Load(p.Source.(models.TestDrive).CarID)
+			return func() (interface{}, error) {
+				car, err := thunk()
+				if errors.Is(err, repository.ErrNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return car, nil
+			}, nil
+		},
+	}
+}
+
+// customer returns the ID of the signed-in user, of any role
+func customer(ctx context.Context) (int, error) {
+	if err := middleware.Authorize(ctx, middleware.RoleUser, middleware.RoleAdmin); err != nil {
+		return 0, err
+	}
+	userID, _ := ctx.Value(middleware.UserIDKey).(int)
+	return userID, nil
+}
+
+// testDriveError gives booking failures a code: NOT_FOUND for missing cars and bookings,
+// CONFLICT for overlapping slots and INVALID_TRANSITION for status changes. Other errors
+// pass through.
+func testDriveError(err error, carID int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFoundError("car %d not found", carID)
+	case errors.Is(err, repository.ErrTestDriveNotFound):
+		return notFoundError("%s", err.Error())
+	case errors.Is(err, repository.ErrSlotTaken), errors.Is(err, repository.ErrDoubleBooked):
+		return &codedError{code: CodeConflict, message: err.Error(), extra: map[string]interface{}{"field": "start"}}
+	case errors.Is(err, repository.ErrTestDriveStatus):
+		return &codedError{code: CodeInvalidTransition, message: err.Error()}
+	}
+	return err
+}
+
+// myTestDrivesField lists the signed-in customer's bookings, soonest first
+func myTestDrivesField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(TestDriveType))),
+		Args: graphql.FieldConfigArgument{
+			"includePast": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			filter := repository.TestDriveFilter{UserID: &userID}
+			if includePast, _ := p.Args["includePast"].(bool); !includePast {
+				now := time.Now()
+				filter.From = &now
+			}
+			return res.TestDrives.Bookings.List(p.Context, filter)
+		},
+	}
+}
+
+// testDrivesField lists bookings for admins, e.g. a car's schedule for a week
+func testDrivesField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(TestDriveType))),
+		Args: graphql.FieldConfigArgument{
+			"carId":  &graphql.ArgumentConfig{Type: graphql.Int},
+			"status": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(TestDriveStatusEnum))},
+			// Bookings overlapping [from, to) are returned
+			"from": &graphql.ArgumentConfig{Type: graphql.DateTime},
+			"to":   &graphql.ArgumentConfig{Type: graphql.DateTime},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			filter := repository.TestDriveFilter{Statuses: parseStatuses(p.Args["status"])}
+			if carID, ok := p.Args["carId"].(int); ok {
+				filter.CarID = &carID
+			}
+			if from, ok := p.Args["from"].(time.Time); ok {
+				filter.From = &from
+			}
+			if to, ok := p.Args["to"].(time.Time); ok {
+				filter.To = &to
+			}
+			return res.TestDrives.Bookings.List(p.Context, filter)
+		},
+	}
+}
+
+// testDriveFeedURLField returns the signed-in customer's iCalendar subscription URL
+func testDriveFeedURLField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.String),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			return res.TestDrives.FeedURL(userID), nil
+		},
+	}
+}
+
+// bookTestDriveField books a car for the signed-in customer
+func bookTestDriveField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: TestDriveType,
+		Args: graphql.FieldConfigArgument{
+			"carId":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"start":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.DateTime)},
+			"durationMinutes": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			carID, _ := p.Args["carId"].(int)
+			start, ok := p.Args["start"].(time.Time)
+			if !ok {
+				return nil, errors.New("start must be an RFC 3339 date-time")
+			}
+			minutes, _ := p.Args["durationMinutes"].(int)
+
+			td, err := res.TestDrives.Book(p.Context, userID, carID, start, time.Duration(minutes)*time.Minute)
+			if err != nil {
+				return nil, testDriveError(err, carID)
+			}
+			return td, nil
+		},
+	}
+}
+
+// confirmTestDriveField accepts a pending booking
+func confirmTestDriveField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: TestDriveType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			id, _ := p.Args["id"].(int)
+			td, err := res.TestDrives.Confirm(p.Context, id)
+			if err != nil {
+				return nil, testDriveError(err, 0)
+			}
+			return td, nil
+		},
+	}
+}
+
+// cancelTestDriveField cancels a booking; customers may only cancel their own
+func cancelTestDriveField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: TestDriveType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			userID, err := customer(p.Context)
+			if err != nil {
+				return nil, err
+			}
+			admin := middleware.Authorize(p.Context, middleware.RoleAdmin) == nil
+			id, _ := p.Args["id"].(int)
+			td, err := res.TestDrives.Cancel(p.Context, id, userID, admin)
+			if err != nil {
+				return nil, testDriveError(err, 0)
+			}
+			return td, nil
+		},
+	}
+}
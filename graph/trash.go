@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"car-service/middleware"
+	"car-service/repository"
+	"errors"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+)
+
+// trashedCarsField lists soft-deleted cars for admins, newest cars first
+func trashedCarsField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(CarType)),
+		Args: graphql.FieldConfigArgument{
+			"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultConnectionSize},
+			"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			limit, _ := p.Args["limit"].(int)
+			offset, _ := p.Args["offset"].(int)
+			if limit < 1 || limit > maxConnectionSize {
+				return nil, fmt.Errorf("limit must be between 1 and %d", maxConnectionSize)
+			}
+			if offset < 0 {
+				return nil, errors.New("offset must not be negative")
+			}
+			return res.Cars.List(p.Context, repository.ListOptions{
+				Filter: repository.CarFilter{Trashed: true},
+				Sort:   []repository.SortKey{{Field: "id", Desc: true}},
+				Limit:  limit,
+				Offset: offset,
+			})
+		},
+	}
+}
+
+// restoreCarField takes a car out of the trash
+func restoreCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: CarType,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return nil, err
+			}
+			id, _ := p.Args["id"].(int)
+			car, err := res.Cars.Restore(p.Context, id)
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, notFoundError("car %d is not in the trash", id)
+			}
+			if err != nil {
+				return nil, conflictError(err)
+			}
+			return car, nil
+		},
+	}
+}
+
+// purgeCarField permanently deletes a trashed car; live cars must be deleted first
+func purgeCarField(res *Resolver) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.Boolean,
+		Args: graphql.FieldConfigArgument{
+			"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if err := middleware.Authorize(p.Context, middleware.RoleAdmin); err != nil {
+				return false, err
+			}
+			id, _ := p.Args["id"].(int)
+			err := res.Cars.Purge(p.Context, id)
+			if errors.Is(err, repository.ErrNotFound) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+	}
+}
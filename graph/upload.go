@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+type uploadsKey struct{}
+
+// uploadPrefix marks the placeholder that stands in for a file in the JSON variables
+const uploadPrefix = "upload:"
+
+// UploadScalar is a file sent with the GraphQL multipart request spec
+// (https://github.com/jaydenseric/graphql-multipart-request-spec). Resolvers receive the
+// placeholder set by UploadMiddleware and open the file with openUpload.
+var UploadScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Upload",
+	Description: "A file part of a multipart GraphQL request",
+	Serialize:   func(value interface{}) interface{} { return nil },
+	ParseValue: func(value interface{}) interface{} {
+		if s, ok := value.(string); ok && strings.HasPrefix(s, uploadPrefix) {
+			return s
+		}
+		return nil
+	},
+	// Files can only arrive through variables
+	ParseLiteral: func(valueAST ast.Value) interface{} { return nil },
+})
+
+// UploadMiddleware turns a multipart GraphQL request (operations + map + file parts) into a
+// plain JSON request the graphql-go handler understands. Every file is replaced by a
+// placeholder in the variables and kept in the request context for the resolvers.
+func UploadMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			if err := r.ParseMultipartForm(32 << 20); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, "invalid multipart request: "+err.Error())
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+
+			var operations map[string]interface{}
+			if err := json.Unmarshal([]byte(r.FormValue("operations")), &operations); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, `"operations" must be a single JSON operation`)
+				return
+			}
+			var fileMap map[string][]string
+			if err := json.Unmarshal([]byte(r.FormValue("map")), &fileMap); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, `"map" must be a JSON object`)
+				return
+			}
+
+			files := map[string]*multipart.FileHeader{}
+			for name, paths := range fileMap {
+				headers := r.MultipartForm.File[name]
+				if len(headers) == 0 {
+					writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("missing file part %q", name))
+					return
+				}
+				placeholder := uploadPrefix + name
+				files[placeholder] = headers[0]
+				for _, path := range paths {
+					if err := setPath(operations, strings.Split(path, "."), placeholder); err != nil {
+						writeGraphQLError(w, http.StatusBadRequest, err.Error())
+						return
+					}
+				}
+			}
+
+			body, _ := json.Marshal(operations)
+			req := r.Clone(context.WithValue(r.Context(), uploadsKey{}, files))
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			req.Header.Set("Content-Type", "application/json")
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// setPath replaces the value at a map path such as variables.files.0 with value
+func setPath(root interface{}, path []string, value string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty map path")
+	}
+	key := path[0]
+	switch node := root.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			node[key] = value
+			return nil
+		}
+		return setPath(node[key], path[1:], value)
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(node) {
+			return fmt.Errorf("invalid map path segment %q", key)
+		}
+		if len(path) == 1 {
+			node[i] = value
+			return nil
+		}
+		return setPath(node[i], path[1:], value)
+	}
+	return fmt.Errorf("invalid map path segment %q", key)
+}
+
+// openUpload opens the file behind an Upload argument
+func openUpload(ctx context.Context, placeholder string) (multipart.File, error) {
+	files, _ := ctx.Value(uploadsKey{}).(map[string]*multipart.FileHeader)
+	fh, ok := files[placeholder]
+	if !ok {
+		return nil, fmt.Errorf("file %q was not uploaded", strings.TrimPrefix(placeholder, uploadPrefix))
+	}
+	return fh.Open()
+}
+
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
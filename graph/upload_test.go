@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"bytes"
+	"car-service/models"
+	"car-service/repository"
+	"car-service/storage"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graphql-go/handler"
+)
+
+func TestUploadCarImageMultipart(t *testing.T) {
+	cars := repository.NewMemoryCarRepository()
+	cars.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000, Color: "Red"})
+	store, err := storage.NewLocalBlobStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	res := &Resolver{Cars: cars, Media: storage.NewImageService(store, repository.NewMemoryCarImageRepository(), cars, 1<<20)}
+	schema, err := InitSchema(res)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	srv := UploadMiddleware(2 << 20)(res.LoaderMiddleware(handler.New(&handler.Config{Schema: &schema})))
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 64, 48)))
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("operations", `{"query": "mutation ($file: Upload!) { uploadCarImage(carId: 1, file: $file) { id } }", "variables": {"file": null}}`)
+	mw.WriteField("map", `{"0": ["variables.file"]}`)
+	part, _ := mw.CreateFormFile("0", "car.png")
+	part.Write(img.Bytes())
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", &body).WithContext(adminContext())
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if bytes.Contains(w.Body.Bytes(), []byte(`"errors"`)) {
+		t.Fatalf("Unexpected errors: %s", w.Body.String())
+	}
+
+	// The photo is now visible on the car
+	req = httptest.NewRequest(http.MethodPost, "/graphql",
+		bytes.NewBufferString(`{"query": "{ car(id: 1) { images { url width height primary } } }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+
+	var out struct {
+		Data struct {
+			Car struct {
+				Images []struct {
+					URL     string `json:"url"`
+					Width   int    `json:"width"`
+					Height  int    `json:"height"`
+					Primary bool   `json:"primary"`
+				} `json:"images"`
+			} `json:"car"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("Failed to decode response %s: %v", w.Body.String(), err)
+	}
+	images := out.Data.Car.Images
+	if len(images) != 1 || images[0].Width != 64 || images[0].Height != 48 || !images[0].Primary || images[0].URL == "" {
+		t.Errorf("Unexpected images: %+v", images)
+	}
+}
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"car-service/vin"
+
+	"github.com/graphql-go/graphql"
+)
+
+// VinDecodingType is what the offline decoder reads from a VIN
+var VinDecodingType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "VinDecoding",
+		Fields: graphql.Fields{
+			"vin":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"wmi":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"manufacturer": &graphql.Field{Type: graphql.String},
+			"make":         &graphql.Field{Type: graphql.String},
+			"country":      &graphql.Field{Type: graphql.String},
+			"region":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"modelYear": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					d, _ := p.Source.(vin.Decoded)
+					return d.ModelYear, nil
+				},
+			},
+		},
+	},
+)
+
+// decodeVinField decodes a VIN without touching the inventory. Blank strings mean the
+// bundled WMI table does not know the manufacturer.
+func decodeVinField() *graphql.Field {
+	return &graphql.Field{
+		Type: VinDecodingType,
+		Args: graphql.FieldConfigArgument{
+			"vin": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			raw, _ := p.Args["vin"].(string)
+			return vin.Decode(raw)
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"car-service/repository"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuditHandler serves the admin-only GET /audit endpoint
+type AuditHandler struct {
+	Repo repository.AuditRepository
+}
+
+// NewAuditHandler creates an AuditHandler using the given repository
+func NewAuditHandler(repo repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{Repo: repo}
+}
+
+// GetAudit lists audit events, newest first. Supports actor_id, action, entity, entity_id,
+// since/until (RFC 3339), limit and after (the cursor from the previous page's next link).
+func (h *AuditHandler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	q := r.URL.Query()
+	filter, err := parseAuditFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultPageSize
+	if l, err := optionalInt(q, "limit"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if l != nil {
+		if *l < 1 || *l > maxPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = *l
+	}
+	var afterID int64
+	if after := q.Get("after"); after != "" {
+		if afterID, err = repository.DecodeAuditCursor(after); err != nil {
+			http.Error(w, "invalid after cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := h.Repo.List(r.Context(), filter, limit+1, afterID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(events) > limit {
+		events = events[:limit]
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("after", repository.EncodeAuditCursor(events[len(events)-1].ID))
+		next.RawQuery = nq.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+func parseAuditFilter(q url.Values) (repository.AuditFilter, error) {
+	f := repository.AuditFilter{
+		Action: strings.TrimSpace(q.Get("action")),
+		Entity: strings.TrimSpace(q.Get("entity")),
+	}
+	var err error
+	if f.ActorID, err = optionalInt(q, "actor_id"); err != nil {
+		return f, err
+	}
+	if f.EntityID, err = optionalInt(q, "entity_id"); err != nil {
+		return f, err
+	}
+	for key, dst := range map[string]**time.Time{"since": &f.Since, "until": &f.Until} {
+		if val := q.Get(key); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+			}
+			*dst = &t
+		}
+	}
+	return f, nil
+}
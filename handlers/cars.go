@@ -1,52 +1,225 @@
 package handlers
 
 import (
-	"car-service/db"
 	"car-service/models"
+	"car-service/repository"
 	"car-service/utils"
-	"database/sql"
+	"car-service/vin"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
-func GetCars(w http.ResponseWriter, r *http.Request) {
+// CarHandler serves the REST /cars endpoints on top of a CarRepository
+type CarHandler struct {
+	Repo repository.CarRepository
+}
+
+// NewCarHandler creates a CarHandler using the given repository
+func NewCarHandler(repo repository.CarRepository) *CarHandler {
+	return &CarHandler{Repo: repo}
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// GetCars lists cars. Supports q (free-text search, best matches first unless sorted), make,
+// model, color, status (e.g. "available,reserved"), year_min, year_max, price_min, price_max,
+// mileage_max, sort (e.g. "price,-year"), limit and offset query parameters.
+func (h *CarHandler) GetCars(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	rows, err := db.DB.Query("SELECT id, make, model, year, price, color, mileage FROM cars")
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	total, err := h.Repo.Count(r.Context(), opts.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cars, err := h.Repo.List(r.Context(), opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var cars []models.Car
-	for rows.Next() {
-		var c models.Car
-		if err := rows.Scan(&c.ID, &c.Make, &c.Model, &c.Year, &c.Price, &c.Color, &c.Mileage); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		cars = append(cars, c)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if opts.Limit > 0 {
+		w.Header().Set("Link", paginationLinks(r.URL, opts.Limit, opts.Offset, total))
 	}
 	json.NewEncoder(w).Encode(cars)
 }
 
-func CreateCar(w http.ResponseWriter, r *http.Request) {
+// parseListOptions validates the GET /cars query parameters. The result is paged (limit
+// defaults to defaultPageSize) only when limit or offset is given.
+func parseListOptions(q url.Values) (repository.ListOptions, error) {
+	opts := repository.ListOptions{}
+	var err error
+
+	opts.Filter.Make = strings.TrimSpace(q.Get("make"))
+	opts.Filter.Model = strings.TrimSpace(q.Get("model"))
+	opts.Filter.Color = strings.TrimSpace(q.Get("color"))
+	opts.Filter.Search = strings.TrimSpace(q.Get("q"))
+	for _, status := range strings.Split(q.Get("status"), ",") {
+		if status = strings.ToLower(strings.TrimSpace(status)); status == "" {
+			continue
+		}
+		if !models.IsCarStatus(status) {
+			return opts, fmt.Errorf("status must be one of %s", strings.Join(models.CarStatuses, ", "))
+		}
+		opts.Filter.Statuses = append(opts.Filter.Statuses, status)
+	}
+
+	if opts.Filter.YearMin, err = optionalInt(q, "year_min"); err != nil {
+		return opts, err
+	}
+	if opts.Filter.YearMax, err = optionalInt(q, "year_max"); err != nil {
+		return opts, err
+	}
+	if opts.Filter.MileageMax, err = optionalInt(q, "mileage_max"); err != nil {
+		return opts, err
+	}
+	if opts.Filter.PriceMin, err = optionalFloat(q, "price_min"); err != nil {
+		return opts, err
+	}
+	if opts.Filter.PriceMax, err = optionalFloat(q, "price_max"); err != nil {
+		return opts, err
+	}
+	if f := opts.Filter; f.YearMin != nil && f.YearMax != nil && *f.YearMin > *f.YearMax {
+		return opts, errors.New("year_min must not be greater than year_max")
+	}
+	if f := opts.Filter; f.PriceMin != nil && f.PriceMax != nil && *f.PriceMin > *f.PriceMax {
+		return opts, errors.New("price_min must not be greater than price_max")
+	}
+
+	if opts.Sort, err = repository.ParseSort(q.Get("sort")); err != nil {
+		return opts, err
+	}
+
+	if limit, err := optionalInt(q, "limit"); err != nil {
+		return opts, err
+	} else if limit != nil {
+		if *limit < 1 || *limit > maxPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		opts.Limit = *limit
+	}
+	if offset, err := optionalInt(q, "offset"); err != nil {
+		return opts, err
+	} else if offset != nil {
+		if *offset < 0 {
+			return opts, errors.New("offset must not be negative")
+		}
+		opts.Offset = *offset
+		if opts.Limit == 0 {
+			opts.Limit = defaultPageSize
+		}
+	}
+
+	return opts, nil
+}
+
+func optionalInt(q url.Values, key string) (*int, error) {
+	val := q.Get(key)
+	if val == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", key)
+	}
+	return &n, nil
+}
+
+func optionalFloat(q url.Values, key string) (*float64, error) {
+	val := q.Get(key)
+	if val == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	return &f, nil
+}
+
+// paginationLinks builds an RFC 8288 Link header with first/prev/next/last pages
+func paginationLinks(u *url.URL, limit, offset, total int) string {
+	link := func(rel string, off int) string {
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("offset", strconv.Itoa(off))
+		next := *u
+		next.RawQuery = q.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", next.RequestURI(), rel)
+	}
+
+	lastOffset := 0
+	if total > 0 {
+		lastOffset = ((total - 1) / limit) * limit
+	}
+	links := []string{link("first", 0)}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("prev", prev))
+	}
+	if offset+limit < total {
+		links = append(links, link("next", offset+limit))
+	}
+	links = append(links, link("last", lastOffset))
+	return strings.Join(links, ", ")
+}
+
+// CreateCar adds a car. With ?autofill=true a blank make and year are filled in from the VIN,
+// and supplied values that disagree with it are rejected with 422 and the list of conflicts.
+func (h *CarHandler) CreateCar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var c models.Car
 	_ = json.NewDecoder(r.Body).Decode(&c)
+	c.VIN = utils.NormalizeVIN(c.VIN)
+
+	if r.URL.Query().Get("autofill") == "true" {
+		if err := vin.Autofill(&c); err != nil {
+			var mismatch *vin.MismatchError
+			if errors.As(err, &mismatch) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": mismatch.Error(), "conflicts": mismatch.Conflicts})
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	if err := utils.ValidateCar(c); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if c.Status != "" && !models.IsInitialStatus(c.Status) {
+		http.Error(w, "a new car must be draft or available", http.StatusBadRequest)
+		return
+	}
 
-	err := db.DB.QueryRow("INSERT INTO cars (make, model, year, price, color, mileage) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		c.Make, c.Model, c.Year, c.Price, c.Color, c.Mileage).Scan(&c.ID)
-
+	c, err := h.Repo.Create(r.Context(), c)
 	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateVIN) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -54,17 +227,14 @@ func CreateCar(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(c)
 }
 
-func GetCar(w http.ResponseWriter, r *http.Request) {
+func (h *CarHandler) GetCar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, _ := strconv.Atoi(params["id"])
 
-	var c models.Car
-	err := db.DB.QueryRow("SELECT id, make, model, year, price, color, mileage FROM cars WHERE id=$1", id).
-		Scan(&c.ID, &c.Make, &c.Model, &c.Year, &c.Price, &c.Color, &c.Mileage)
-
+	c, err := h.Repo.Get(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, repository.ErrNotFound) {
 			http.Error(w, "Car not found", http.StatusNotFound)
 			return
 		}
@@ -72,39 +242,269 @@ func GetCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", carETag(c))
+	if r.Header.Get("If-None-Match") == carETag(c) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	json.NewEncoder(w).Encode(c)
 }
 
-func UpdateCar(w http.ResponseWriter, r *http.Request) {
+// GetPriceHistory lists the prices a car has had, oldest first
+func (h *CarHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if _, err := h.Repo.Get(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	history, err := h.Repo.PriceHistory(r.Context(), []int{id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	changes := history[id]
+	if changes == nil {
+		changes = []models.PriceChange{}
+	}
+	json.NewEncoder(w).Encode(changes)
+}
+
+// UpdateCar replaces a car. An If-Match header holding the ETag from GET /cars/{id}
+// makes the update fail with 412 if someone else changed the car in the meantime.
+// Changing the price of a reserved car answers 409 unless ?override_reservation=true.
+func (h *CarHandler) UpdateCar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, _ := strconv.Atoi(params["id"])
 
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		http.Error(w, "If-Match does not match the current version", http.StatusPreconditionFailed)
+		return
+	}
+
 	var c models.Car
 	_ = json.NewDecoder(r.Body).Decode(&c)
+	c.ID = id
+	c.VIN = utils.NormalizeVIN(c.VIN)
 
-	_, err := db.DB.Exec("UPDATE cars SET make=$1, model=$2, year=$3, price=$4, color=$5, mileage=$6 WHERE id=$7",
-		c.Make, c.Model, c.Year, c.Price, c.Color, c.Mileage, id)
+	if err := utils.ValidateCar(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	c, err := h.Repo.Update(reservationContext(r), c, expectedVersion)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicateVIN) || errors.Is(err, repository.ErrCarReserved) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writeVersionConflict(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	c.ID = id
+	w.Header().Set("ETag", carETag(c))
+	json.NewEncoder(w).Encode(c)
+}
+
+// ChangeStatus moves a car along the inventory lifecycle. The body is {"status": "sold"};
+// If-Match works as in UpdateCar. A transition the lifecycle does not allow answers 409 with
+// the statuses the car may move to.
+func (h *CarHandler) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		http.Error(w, "If-Match does not match the current version", http.StatusPreconditionFailed)
+		return
+	}
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !models.IsCarStatus(body.Status) {
+		http.Error(w, fmt.Sprintf("body must be {\"status\": ...} with one of %s", strings.Join(models.CarStatuses, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	c, err := h.Repo.SetStatus(r.Context(), id, body.Status, expectedVersion)
+	if err != nil {
+		var transition *repository.StatusTransitionError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Car not found", http.StatusNotFound)
+		case errors.As(err, &transition):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   transition.Error(),
+				"from":    transition.From,
+				"to":      transition.To,
+				"allowed": transition.Allowed,
+			})
+		case errors.Is(err, repository.ErrOpenOrder):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case writeVersionConflict(w, err):
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", carETag(c))
 	json.NewEncoder(w).Encode(c)
 }
 
-func DeleteCar(w http.ResponseWriter, r *http.Request) {
+// DeleteCar moves a car to the trash, honouring If-Match and ?override_reservation like UpdateCar
+func (h *CarHandler) DeleteCar(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, _ := strconv.Atoi(params["id"])
 
-	_, err := db.DB.Exec("DELETE FROM cars WHERE id=$1", id)
+	expectedVersion, ok := ifMatchVersion(r)
+	if !ok {
+		http.Error(w, "If-Match does not match the current version", http.StatusPreconditionFailed)
+		return
+	}
+
+	err := h.Repo.Delete(reservationContext(r), id, expectedVersion)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrCarReserved) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if writeVersionConflict(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// GetTrashedCars lists soft-deleted cars, newest first. Supports limit and offset.
+func (h *CarHandler) GetTrashedCars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	opts, err := parseListOptions(url.Values{"limit": r.URL.Query()["limit"], "offset": r.URL.Query()["offset"]})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultPageSize
+	}
+	opts.Filter.Trashed = true
+	opts.Sort = []repository.SortKey{{Field: "id", Desc: true}}
+
+	total, err := h.Repo.Count(r.Context(), opts.Filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cars, err := h.Repo.List(r.Context(), opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Link", paginationLinks(r.URL, opts.Limit, opts.Offset, total))
+	json.NewEncoder(w).Encode(cars)
+}
+
+// RestoreCar takes a car out of the trash
+func (h *CarHandler) RestoreCar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	car, err := h.Repo.Restore(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found in trash", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrDuplicateVIN) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(car)
+}
+
+// PurgeCar permanently deletes a car that is already in the trash
+func (h *CarHandler) PurgeCar(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Repo.Purge(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found in trash", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
 }
+
+// carETag is the strong entity tag of a car: its version
+func carETag(c models.Car) string {
+	return fmt.Sprintf("\"%d\"", c.Version)
+}
+
+// ifMatchVersion returns the version required by the If-Match header, 0 when the header is
+// absent or "*". ok is false for tags this API never issues (weak, lists, garbage), which can
+// never match under the strong comparison If-Match requires.
+func ifMatchVersion(r *http.Request) (version int, ok bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, true
+	}
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// reservationContext lets the repository bypass the reservation checks when the request
+// carries ?override_reservation=true
+func reservationContext(r *http.Request) context.Context {
+	if override, _ := strconv.ParseBool(r.URL.Query().Get("override_reservation")); override {
+		return repository.WithReservationOverride(r.Context())
+	}
+	return r.Context()
+}
+
+// writeVersionConflict answers 412 with the current ETag if err is a version conflict
+func writeVersionConflict(w http.ResponseWriter, err error) bool {
+	var conflict *repository.VersionConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	w.Header().Set("ETag", carETag(models.Car{Version: conflict.Current}))
+	http.Error(w, conflict.Error(), http.StatusPreconditionFailed)
+	return true
+}
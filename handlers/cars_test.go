@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"car-service/booking"
+	"car-service/config"
+	"car-service/documents"
+	"car-service/middleware"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestHandler() *CarHandler {
+	repo := repository.NewMemoryCarRepository()
+	seed := []models.Car{
+		{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red", Mileage: 40000},
+		{Make: "Honda", Model: "Accord", Year: 2021, Price: 24000, Color: "Blue", Mileage: 12000},
+		{Make: "Toyota", Model: "Corolla", Year: 2021, Price: 19000, Color: "Red", Mileage: 8000},
+		{Make: "BMW", Model: "M3", Year: 2023, Price: 70000, Color: "Black", Mileage: 0},
+	}
+	for _, c := range seed {
+		repo.Create(context.Background(), c)
+	}
+	return NewCarHandler(repo)
+}
+
+func getCars(t *testing.T, h *CarHandler, query string) (*httptest.ResponseRecorder, []models.Car) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.GetCars(w, httptest.NewRequest(http.MethodGet, "/cars?"+query, nil))
+
+	var cars []models.Car
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&cars); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return w, cars
+}
+
+func TestGetCarsFilterAndSort(t *testing.T) {
+	h := newTestHandler()
+
+	_, cars := getCars(t, h, "make=honda&sort=-price")
+	if len(cars) != 2 || cars[0].Model != "Accord" || cars[1].Model != "Civic" {
+		t.Errorf("Expected Accord then Civic, got %+v", cars)
+	}
+
+	_, cars = getCars(t, h, "year_min=2021&price_max=30000&sort=year,-price")
+	if len(cars) != 2 || cars[0].Model != "Accord" {
+		t.Errorf("Expected Accord and Corolla sorted by price desc, got %+v", cars)
+	}
+
+	_, cars = getCars(t, h, "mileage_max=0")
+	if len(cars) != 1 || cars[0].Make != "BMW" {
+		t.Errorf("Expected only the BMW, got %+v", cars)
+	}
+
+	_, cars = getCars(t, h, "q=red+honda")
+	if len(cars) != 1 || cars[0].Model != "Civic" || cars[0].Match == nil {
+		t.Errorf("Expected the red Civic with a match, got %+v", cars)
+	}
+}
+
+func TestGetCarsPagination(t *testing.T) {
+	h := newTestHandler()
+
+	w, cars := getCars(t, h, "limit=2&offset=2")
+	if len(cars) != 2 {
+		t.Fatalf("Expected 2 cars, got %d", len(cars))
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "4" {
+		t.Errorf("Expected X-Total-Count 4, got %q", got)
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, `offset=0>; rel="prev"`) || strings.Contains(link, `rel="next"`) {
+		t.Errorf("Unexpected Link header: %s", link)
+	}
+}
+
+func TestGetCarsUnpagedByDefault(t *testing.T) {
+	repo := repository.NewMemoryCarRepository()
+	for i := 0; i < defaultPageSize+10; i++ {
+		repo.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 15000})
+	}
+	h := NewCarHandler(repo)
+
+	w, cars := getCars(t, h, "")
+	if len(cars) != defaultPageSize+10 {
+		t.Errorf("Expected all %d cars without limit or offset, got %d", defaultPageSize+10, len(cars))
+	}
+	if link := w.Header().Get("Link"); link != "" {
+		t.Errorf("Expected no Link header for an unpaged response, got %s", link)
+	}
+
+	w, cars = getCars(t, h, "offset=5")
+	if len(cars) != defaultPageSize {
+		t.Errorf("Expected a page of %d cars when only offset is given, got %d", defaultPageSize, len(cars))
+	}
+	if !strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("Expected a next link, got %s", w.Header().Get("Link"))
+	}
+}
+
+func TestGetCarsInvalidParams(t *testing.T) {
+	h := newTestHandler()
+	for _, query := range []string{"sort=password", "limit=0", "year_min=abc", "price_min=10&price_max=5", "offset=-1"} {
+		if w, _ := getCars(t, h, query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestUpdateCarIfMatch(t *testing.T) {
+	h := newTestHandler()
+	serve := func(method, target, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		switch method {
+		case http.MethodGet:
+			h.GetCar(w, req)
+		case http.MethodPut:
+			h.UpdateCar(w, req)
+		case http.MethodDelete:
+			h.DeleteCar(w, req)
+		}
+		return w
+	}
+	body := `{"make":"Honda","model":"Civic","year":2018,"price":14000,"color":"Red","mileage":41000}`
+
+	etag := serve(http.MethodGet, "/cars/1", "", "").Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("Expected ETag \"1\", got %q", etag)
+	}
+	if w := serve(http.MethodPut, "/cars/1", etag, body); w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected update to succeed with ETag \"2\", got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// The first ETag is stale now
+	if w := serve(http.MethodPut, "/cars/1", etag, body); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale If-Match on PUT, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/cars/1", etag, ""); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale If-Match on DELETE, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/cars/1", `W/"2"`, ""); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for weak If-Match, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/cars/1", `"2"`, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected delete with current ETag to succeed, got %d", w.Code)
+	}
+}
+
+func TestCreateCarAutofill(t *testing.T) {
+	h := newTestHandler()
+
+	w := httptest.NewRecorder()
+	body := `{"model": "Accord", "price": 4000, "color": "Black", "mileage": 150000, "vin": "1hgcm82633a004352"}`
+	h.CreateCar(w, httptest.NewRequest(http.MethodPost, "/cars?autofill=true", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var car models.Car
+	json.NewDecoder(w.Body).Decode(&car)
+	if car.Make != "Honda" || car.Year != 2003 || car.VIN != "1HGCM82633A004352" {
+		t.Errorf("Expected make and year from the VIN, got %+v", car)
+	}
+
+	w = httptest.NewRecorder()
+	body = `{"make": "Toyota", "model": "Accord", "year": 2003, "price": 4000, "vin": "JHMCM82613C004352"}`
+	h.CreateCar(w, httptest.NewRequest(http.MethodPost, "/cars?autofill=true", strings.NewReader(body)))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Conflicts []struct{ Field, Supplied, Decoded string }
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Conflicts) != 1 || resp.Conflicts[0].Field != "make" || resp.Conflicts[0].Decoded != "Honda" {
+		t.Errorf("Expected a make conflict, got %+v", resp.Conflicts)
+	}
+}
+
+func TestExportCars(t *testing.T) {
+	h := NewExportHandler(newTestHandler().Repo)
+
+	w := httptest.NewRecorder()
+	h.ExportCars(w, httptest.NewRequest(http.MethodGet, "/cars/export?make=honda&sort=price&columns=model,price", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Body.String(); got != "model,price\nCivic,15000\nAccord,24000\n" {
+		t.Errorf("Unexpected CSV:\n%s", got)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment; filename=\"cars-") || !strings.HasSuffix(cd, ".csv\"") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	for _, query := range []string{"format=pdf", "columns=owner", "year_min=x"} {
+		w := httptest.NewRecorder()
+		h.ExportCars(w, httptest.NewRequest(http.MethodGet, "/cars/export?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetPriceHistory(t *testing.T) {
+	h := newTestHandler()
+	car, _ := h.Repo.Get(context.Background(), 1)
+	car.Price = 14000
+	h.Repo.Update(context.Background(), car, 0)
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/cars/"+id+"/price-history", nil), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		h.GetPriceHistory(w, req)
+		return w
+	}
+
+	w := get("1")
+	var history []models.PriceChange
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(history) != 2 || history[1].OldPrice == nil || *history[1].OldPrice != 15000 || history[1].NewPrice != 14000 {
+		t.Errorf("Unexpected history %+v", history)
+	}
+	if w := get("99"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestChangeStatus(t *testing.T) {
+	h := newTestHandler()
+	change := func(id, body string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/cars/"+id+"/status", strings.NewReader(body)), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		h.ChangeStatus(w, req)
+		return w
+	}
+
+	if w := change("1", `{"status": "sold"}`); w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected 200 with ETag \"2\", got %d %s", w.Code, w.Body.String())
+	}
+	w := change("1", `{"status": "draft"}`)
+	var body struct {
+		From    string   `json:"from"`
+		Allowed []string `json:"allowed"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusConflict || body.From != "sold" || len(body.Allowed) != 2 {
+		t.Errorf("Expected 409 listing the allowed statuses, got %d %+v", w.Code, body)
+	}
+	if w := change("1", `{"status": "lost"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", w.Code)
+	}
+	if w := change("99", `{"status": "sold"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+
+	_, cars := getCars(t, h, "status=sold,reserved")
+	if len(cars) != 1 || cars[0].ID != 1 {
+		t.Errorf("Expected only the sold car, got %+v", cars)
+	}
+	if w, _ := getCars(t, h, "status=lost"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status filter, got %d", w.Code)
+	}
+}
+
+func TestReservedCarNeedsOverride(t *testing.T) {
+	h := newTestHandler()
+	h.Repo.Reserve(context.Background(), 1, 7, time.Now().Add(time.Hour), 0)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(method, target, strings.NewReader(body)), map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		if method == http.MethodPut {
+			h.UpdateCar(w, req)
+		} else {
+			h.DeleteCar(w, req)
+		}
+		return w
+	}
+	body := `{"make":"Honda","model":"Civic","year":2018,"price":14000,"color":"Red"}`
+
+	if w := serve(http.MethodPut, "/cars/1", body); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a price change, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/cars/1", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a delete, got %d", w.Code)
+	}
+	if w := serve(http.MethodPut, "/cars/1?override_reservation=true", body); w.Code != http.StatusOK {
+		t.Errorf("Expected the override to allow the price change, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, "/cars/1?override_reservation=true", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the override to allow the delete, got %d", w.Code)
+	}
+}
+
+func TestGetTestDriveFeed(t *testing.T) {
+	drives, err := booking.NewService(repository.NewMemoryTestDriveRepository(), newTestHandler().Repo, nil, config.Default().Bookings, "secret")
+	if err != nil {
+		t.Fatalf("Failed to create booking service: %v", err)
+	}
+	h := NewTestDriveHandler(drives)
+	get := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.GetFeed(w, httptest.NewRequest(http.MethodGet, "/test-drives/feed.ics?token="+url.QueryEscape(token), nil))
+		return w
+	}
+
+	w := get(drives.FeedToken(7))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("Expected a calendar, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Body.String(), "BEGIN:VCALENDAR\r\n") {
+		t.Errorf("Unexpected body:\n%s", w.Body.String())
+	}
+	for _, token := range []string{"", "7", "7.forged"} {
+		if w := get(token); w.Code != http.StatusNotFound {
+			t.Errorf("%q: expected 404, got %d", token, w.Code)
+		}
+	}
+}
+
+func TestGetInvoice(t *testing.T) {
+	h := newTestHandler()
+	orders := repository.NewMemoryOrderRepository(h.Repo.(*repository.MemoryCarRepository), "INV-")
+	order, err := orders.Create(context.Background(), models.Order{CarID: 1, BuyerID: 7, Price: 14500, Total: 14500})
+	if err != nil {
+		t.Fatalf("Create order failed: %v", err)
+	}
+	docs := documents.NewRenderer(repository.NewMemoryDocumentTemplateRepository(), config.Default().Documents)
+	invoices := NewOrderHandler(orders, docs)
+	get := func(userID int, role, query string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/orders/1/invoice?"+query, nil), map[string]string{"id": "1"})
+		if userID != 0 {
+			ctx := context.WithValue(context.WithValue(req.Context(), middleware.UserIDKey, userID), middleware.RoleKey, role)
+			req = req.WithContext(ctx)
+		}
+		w := httptest.NewRecorder()
+		invoices.GetInvoice(w, req)
+		return w
+	}
+
+	if w := get(7, middleware.RoleUser, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), order.InvoiceNumber) {
+		t.Errorf("Expected the buyer to get the HTML invoice, got %d", w.Code)
+	}
+	w := get(1, middleware.RoleAdmin, "format=pdf")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" ||
+		!strings.Contains(w.Header().Get("Content-Disposition"), "invoice-INV-000001.pdf") {
+		t.Errorf("Expected an admin to get the PDF invoice, got %d %v", w.Code, w.Header())
+	}
+	if w := get(8, middleware.RoleUser, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected another customer to get 404, got %d", w.Code)
+	}
+	if w := get(0, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", w.Code)
+	}
+
+	// The sold car keeps its status until the order is cancelled
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/cars/1/status", strings.NewReader(`{"status": "available"}`)), map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	h.ChangeStatus(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a car with an open order, got %d", w.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"car-service/documents"
+	"car-service/models"
+	"car-service/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// DocumentHandler serves window stickers, listing sheets and their templates
+type DocumentHandler struct {
+	Docs *documents.Renderer
+	Cars repository.CarRepository
+}
+
+// NewDocumentHandler creates a DocumentHandler rendering cars from the given repository
+func NewDocumentHandler(docs *documents.Renderer, cars repository.CarRepository) *DocumentHandler {
+	return &DocumentHandler{Docs: docs, Cars: cars}
+}
+
+// GetSticker renders the window sticker of one car. Supports format=html|pdf and
+// template=window_sticker|listing_sheet.
+func (h *DocumentHandler) GetSticker(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	car, err := h.Cars.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Car not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.render(w, r, fmt.Sprintf("car-%d", car.ID), []models.Car{car})
+}
+
+// GetStickers renders one multi-page document for the cars matching the GET /cars filters
+// (make, model, color, year_min, ... , sort, limit, offset). At most 200 cars per document.
+func (h *DocumentHandler) GetStickers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts, err := parseListOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("limit") == "" {
+		opts.Limit = maxPageSize
+	}
+
+	cars, err := h.Cars.List(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(cars) == 0 {
+		http.Error(w, "No cars match the filter", http.StatusNotFound)
+		return
+	}
+	h.render(w, r, "cars", cars)
+}
+
+// render writes the requested document, buffering it so template errors still produce a 500
+func (h *DocumentHandler) render(w http.ResponseWriter, r *http.Request, filename string, cars []models.Car) {
+	format, err := documents.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("template")
+	if name == "" {
+		name = documents.WindowSticker
+	}
+
+	var buf bytes.Buffer
+	if err := h.Docs.Render(r.Context(), &buf, name, format, cars); err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s-%s.%s\"", name, filename, format))
+	w.Write(buf.Bytes())
+}
+
+// ListTemplates returns the current template of every document
+func (h *DocumentHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	templates, err := h.Docs.List(r.Context())
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(templates)
+}
+
+// GetTemplate returns the current template of a document; builtin is true while it has no override
+func (h *DocumentHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	tpl, err := h.Docs.Template(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tpl)
+}
+
+// PutTemplate overrides a document template with {"html": "...", "pdf": "..."}.
+// An omitted field keeps its current template.
+func (h *DocumentHandler) PutTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+
+	var body struct {
+		HTML *string `json:"html"`
+		PDF  *string `json:"pdf"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	tpl, err := h.Docs.Template(r.Context(), name)
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	if body.HTML != nil {
+		tpl.HTML = *body.HTML
+	}
+	if body.PDF != nil {
+		tpl.PDF = *body.PDF
+	}
+
+	tpl, err = h.Docs.Save(r.Context(), tpl)
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tpl)
+}
+
+// DeleteTemplate drops the override of a document, restoring the built-in template
+func (h *DocumentHandler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.Docs.Reset(r.Context(), mux.Vars(r)["name"]); err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// writeDocumentError maps documents errors to HTTP status codes
+func writeDocumentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, documents.ErrUnknownTemplate):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, documents.ErrInvalidTemplate):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"car-service/exporter"
+	"car-service/repository"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ExportHandler serves GET /cars/export
+type ExportHandler struct {
+	Cars repository.CarRepository
+}
+
+// NewExportHandler creates an ExportHandler backed by the given repository
+func NewExportHandler(cars repository.CarRepository) *ExportHandler {
+	return &ExportHandler{Cars: cars}
+}
+
+// ExportCars streams the inventory as format=csv|ndjson|xlsx (default csv). It takes the same
+// filters and sort as GET /cars but is not paged unless limit is given; columns=make,model,price
+// picks and orders the columns.
+func (h *ExportHandler) ExportCars(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts, err := parseListOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Get("limit") == "" {
+		opts.Limit = 0
+	}
+	format, err := exporter.ParseFormat(q.Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	columns, err := exporter.ParseColumns(q.Get("columns"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 1. Headers go out with the first row, so a failure before it can still answer 500
+	out := &lazyHeaderWriter{ResponseWriter: w, header: map[string]string{
+		"Content-Type":        format.ContentType(),
+		"Content-Disposition": fmt.Sprintf("attachment; filename=\"cars-%s.%s\"", time.Now().UTC().Format("20060102-150405"), format),
+	}}
+	ew, err := exporter.NewWriter(out, format, columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// 2. Stream rows from the repository cursor
+	err = h.Cars.Each(r.Context(), opts, ew.Write)
+	if cerr := ew.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		return
+	}
+
+	// 3. Once rows are out the status is sent; abort the connection so the client sees a
+	// truncated download instead of a file that looks complete
+	if !out.started {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Export aborted after the response started: %v", err)
+	panic(http.ErrAbortHandler)
+}
+
+// lazyHeaderWriter sets its headers just before the first byte of the body is written
+type lazyHeaderWriter struct {
+	http.ResponseWriter
+	header  map[string]string
+	started bool
+}
+
+func (l *lazyHeaderWriter) Write(p []byte) (int, error) {
+	if !l.started {
+		l.started = true
+		for k, v := range l.header {
+			l.ResponseWriter.Header().Set(k, v)
+		}
+	}
+	return l.ResponseWriter.Write(p)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"car-service/repository"
+	"car-service/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// multipartOverhead is the room left for form fields and part headers on top of the image size limit
+const multipartOverhead = 1 << 20
+
+// ImageHandler serves the /cars/{id}/images endpoints
+type ImageHandler struct {
+	Media *storage.ImageService
+}
+
+// NewImageHandler creates an ImageHandler using the given image service
+func NewImageHandler(media *storage.ImageService) *ImageHandler {
+	return &ImageHandler{Media: media}
+}
+
+// ListImages returns the photos of a car in display order
+func (h *ImageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if _, err := h.Media.Cars.Get(r.Context(), id); err != nil {
+		writeImageError(w, err)
+		return
+	}
+	images, err := h.Media.List(r.Context(), id)
+	if err != nil {
+		writeImageError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(images)
+}
+
+// UploadImage accepts a multipart/form-data body with the file in the "image" field and an
+// optional primary=true field
+func (h *ImageHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.Media.MaxSize+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeImageError(w, storage.ErrImageTooLarge)
+			return
+		}
+		http.Error(w, "expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, `missing "image" file field`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	img, err := h.Media.Upload(r.Context(), id, file, r.FormValue("primary") == "true")
+	if err != nil {
+		writeImageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(img)
+}
+
+// DeleteImage removes a photo and its file
+func (h *ImageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	carID, imageID := imageVars(r)
+
+	if err := h.Media.Delete(r.Context(), carID, imageID); err != nil {
+		writeImageError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// SetPrimaryImage makes a photo the car's primary one
+func (h *ImageHandler) SetPrimaryImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	carID, imageID := imageVars(r)
+
+	if err := h.Media.SetPrimary(r.Context(), carID, imageID); err != nil {
+		writeImageError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"result": "success"})
+}
+
+// ReorderImages sets the display order from a {"image_ids": [...]} body listing every photo once
+func (h *ImageHandler) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var body struct {
+		ImageIDs []int `json:"image_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Media.Reorder(r.Context(), id, body.ImageIDs); err != nil {
+		writeImageError(w, err)
+		return
+	}
+	images, err := h.Media.List(r.Context(), id)
+	if err != nil {
+		writeImageError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(images)
+}
+
+func imageVars(r *http.Request) (carID, imageID int) {
+	vars := mux.Vars(r)
+	carID, _ = strconv.Atoi(vars["id"])
+	imageID, _ = strconv.Atoi(vars["imageId"])
+	return carID, imageID
+}
+
+// writeImageError maps image and repository errors to HTTP statuses
+func writeImageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "Car not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrImageNotFound):
+		http.Error(w, "Image not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrImageTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, storage.ErrUnsupportedImage):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, storage.ErrInvalidImage), errors.Is(err, repository.ErrInvalidImageOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
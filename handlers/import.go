@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"car-service/importer"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 10000
+)
+
+// ImportHandler serves POST /cars/import
+type ImportHandler struct {
+	Importer *importer.Importer
+}
+
+// NewImportHandler creates an ImportHandler using the given importer
+func NewImportHandler(imp *importer.Importer) *ImportHandler {
+	return &ImportHandler{Importer: imp}
+}
+
+// ImportCars loads a CSV (text/csv) or NDJSON (application/x-ndjson) body. Query parameters:
+// format=csv|ndjson overrides the Content-Type, dry_run=true only validates, key=vin|id updates
+// matching cars instead of creating new ones, mode=transaction|row (default transaction) and
+// map=make:Brand,year:Model Year renames CSV columns. Responds with an importer.Report; a
+// transaction that was rolled back because of bad rows answers 422.
+func (h *ImportHandler) ImportCars(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := importer.Options{
+		Key:    strings.ToLower(strings.TrimSpace(q.Get("key"))),
+		Mode:   importer.Mode(strings.ToLower(strings.TrimSpace(q.Get("mode")))),
+		DryRun: q.Get("dry_run") == "true",
+	}
+	if opts.Mode == "" {
+		opts.Mode = importer.ModeTransaction
+	}
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mapping, err := importer.ParseMapping(q.Get("map"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = importFormat(r.Header.Get("Content-Type"))
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []importer.Row
+	var ignored []string
+	switch format {
+	case "csv":
+		rows, ignored, err = importer.ParseCSV(r.Body, mapping, maxImportRows)
+	case "ndjson":
+		rows, err = importer.ParseNDJSON(r.Body, maxImportRows)
+	default:
+		http.Error(w, "send text/csv or application/x-ndjson, or set format=csv|ndjson", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		var parseErr *importer.ParseError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, "import file is larger than 32 MB", http.StatusRequestEntityTooLarge)
+		case errors.As(err, &parseErr):
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	report, err := h.Importer.Run(r.Context(), rows, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report.IgnoredColumns = ignored
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.DryRun && opts.Mode == importer.ModeTransaction && report.Failed > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// importFormat picks the import format from a Content-Type header
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return "csv"
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return "ndjson"
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"car-service/documents"
+	"car-service/middleware"
+	"car-service/repository"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// OrderHandler serves the invoices of sales orders. Orders themselves are managed through GraphQL.
+type OrderHandler struct {
+	Orders repository.OrderRepository
+	Docs   *documents.Renderer
+}
+
+// NewOrderHandler creates an OrderHandler rendering invoices with the given renderer
+func NewOrderHandler(orders repository.OrderRepository, docs *documents.Renderer) *OrderHandler {
+	return &OrderHandler{Orders: orders, Docs: docs}
+}
+
+// GetInvoice renders the invoice of an order as format=html|pdf. Admins may download any
+// invoice, customers only their own; other orders are reported as not found.
+func (h *OrderHandler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	format, err := documents.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	order, err := h.Orders.Get(r.Context(), id)
+	if err == nil && order.BuyerID != userID && middleware.Authorize(r.Context(), middleware.RoleAdmin) != nil {
+		err = repository.ErrOrderNotFound
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.Docs.RenderInvoice(r.Context(), &buf, format, order); err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"invoice-%s.%s\"", order.InvoiceNumber, format))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(buf.Bytes())
+}
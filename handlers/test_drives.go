@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"bytes"
+	"car-service/booking"
+	"log"
+	"net/http"
+)
+
+// TestDriveHandler serves the iCalendar feed of a customer's test drives. Calendar apps
+// cannot send a bearer token, so the feed is authenticated by the signed token in its URL.
+type TestDriveHandler struct {
+	Service *booking.Service
+}
+
+// NewTestDriveHandler creates a TestDriveHandler using the given booking service
+func NewTestDriveHandler(service *booking.Service) *TestDriveHandler {
+	return &TestDriveHandler{Service: service}
+}
+
+// GetFeed writes the test drives of the customer identified by ?token= as a .ics file
+func (h *TestDriveHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.Service.FeedUser(r.URL.Query().Get("token"))
+	if !ok {
+		http.Error(w, "Invalid feed token", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.Service.WriteFeed(r.Context(), &buf, userID); err != nil {
+		log.Printf("Failed to build test drive feed for user %d: %v", userID, err)
+		http.Error(w, "Failed to build calendar", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="test-drives.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,258 @@
+// Package importer loads inventory files (CSV or NDJSON) into the car repository, with
+// dry-run, upsert by a natural key and a per-line error report.
+package importer
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Mode controls how rows are written
+type Mode string
+
+const (
+	// ModeTransaction writes every row in one transaction, or none if any row fails
+	ModeTransaction Mode = "transaction"
+	// ModeRow writes each valid row on its own; failed rows are skipped
+	ModeRow Mode = "row"
+)
+
+// Options configures an import
+type Options struct {
+	// Key is the column that identifies existing cars: "vin", "id", or empty to always create
+	Key    string
+	Mode   Mode
+	DryRun bool
+}
+
+// Validate checks the key and mode
+func (o Options) Validate() error {
+	if o.Key != "" && o.Key != "vin" && o.Key != "id" {
+		return fmt.Errorf("key must be vin or id, got %q", o.Key)
+	}
+	if o.Mode != ModeTransaction && o.Mode != ModeRow {
+		return fmt.Errorf("mode must be transaction or row, got %q", o.Mode)
+	}
+	return nil
+}
+
+// LineError is one problem with one input line
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Report summarizes an import. Created and Updated count the rows written, or in a dry run
+// the rows that would be.
+type Report struct {
+	DryRun         bool        `json:"dry_run"`
+	Mode           Mode        `json:"mode"`
+	Key            string      `json:"key,omitempty"`
+	Total          int         `json:"total"`
+	Created        int         `json:"created"`
+	Updated        int         `json:"updated"`
+	Failed         int         `json:"failed"`
+	Committed      bool        `json:"committed"`
+	IgnoredColumns []string    `json:"ignored_columns,omitempty"`
+	Errors         []LineError `json:"errors"`
+}
+
+// Importer validates rows and writes them through a CarRepository
+type Importer struct {
+	Cars repository.CarRepository
+}
+
+// New creates an Importer writing to cars
+func New(cars repository.CarRepository) *Importer {
+	return &Importer{Cars: cars}
+}
+
+// Run validates and, unless opts.DryRun, writes the parsed rows
+func (imp *Importer) Run(ctx context.Context, rows []Row, opts Options) (Report, error) {
+	report := Report{DryRun: opts.DryRun, Mode: opts.Mode, Key: opts.Key, Total: len(rows), Errors: []LineError{}}
+
+	// 1. Resolve keys and validate every row before writing anything
+	cars, err := imp.prepare(ctx, rows, opts.Key)
+	if err != nil {
+		return report, err
+	}
+	valid := 0
+	for i := range rows {
+		for _, msg := range rows[i].Errors {
+			report.Errors = append(report.Errors, LineError{Line: rows[i].Line, Message: msg})
+		}
+		if len(rows[i].Errors) == 0 {
+			valid++
+		}
+	}
+	report.Failed = len(rows) - valid
+
+	count := func(car models.Car) {
+		if car.ID == 0 {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+	}
+
+	// 2. Dry run: report what would happen
+	if opts.DryRun {
+		for i := range rows {
+			if len(rows[i].Errors) == 0 {
+				count(cars[i])
+			}
+		}
+		return report, nil
+	}
+
+	// 3. Transaction mode: all rows or nothing
+	if opts.Mode == ModeTransaction {
+		if report.Failed > 0 || len(rows) == 0 {
+			return report, nil
+		}
+		if _, err := imp.Cars.SaveBatch(ctx, cars); err != nil {
+			var batchErr *repository.BatchError
+			if !errors.As(err, &batchErr) {
+				return report, err
+			}
+			report.Failed = 1
+			report.Errors = append(report.Errors, LineError{Line: rows[batchErr.Index].Line, Message: batchErr.Err.Error()})
+			return report, nil
+		}
+		for _, car := range cars {
+			count(car)
+		}
+		report.Committed = true
+		return report, nil
+	}
+
+	// 4. Row mode: each valid row on its own
+	for i, car := range cars {
+		if len(rows[i].Errors) > 0 {
+			continue
+		}
+		if car.ID == 0 {
+			_, err = imp.Cars.Create(ctx, car)
+		} else {
+			_, err = imp.Cars.Update(ctx, car, 0)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.Failed++
+			report.Errors = append(report.Errors, LineError{Line: rows[i].Line, Message: err.Error()})
+			continue
+		}
+		count(car)
+	}
+	report.Committed = report.Created+report.Updated > 0
+	return report, nil
+}
+
+// prepare turns rows into the cars to write: existing cars (found by key) merged with the
+// provided fields, new cars otherwise. Problems are appended to each row's Errors, including
+// VINs that would collide, so a dry run predicts the outcome of the real import.
+func (imp *Importer) prepare(ctx context.Context, rows []Row, key string) ([]models.Car, error) {
+	cars := make([]models.Car, len(rows))
+	seenIDs := map[int]int{}
+	seenVINs := map[string]int{}
+
+	for i := range rows {
+		row := &rows[i]
+		row.Car.VIN = utils.NormalizeVIN(row.Car.VIN)
+		if len(row.Errors) > 0 {
+			continue
+		}
+
+		// 1. Keys must be unique within the file
+		if key == "id" && row.Set["id"] {
+			if first, dup := seenIDs[row.Car.ID]; dup {
+				row.Errors = append(row.Errors, fmt.Sprintf("duplicate id %d, first seen on line %d", row.Car.ID, first))
+				continue
+			}
+			seenIDs[row.Car.ID] = row.Line
+		}
+		if row.Set["vin"] {
+			if first, dup := seenVINs[row.Car.VIN]; dup {
+				row.Errors = append(row.Errors, fmt.Sprintf("duplicate vin %s, first seen on line %d", row.Car.VIN, first))
+				continue
+			}
+			seenVINs[row.Car.VIN] = row.Line
+		}
+
+		// 2. Find the car the row updates, if any
+		car := row.Car
+		car.ID = 0
+		switch {
+		case key == "id" && row.Set["id"]:
+			existing, err := imp.Cars.Get(ctx, row.Car.ID)
+			if errors.Is(err, repository.ErrNotFound) {
+				row.Errors = append(row.Errors, fmt.Sprintf("no car with id %d", row.Car.ID))
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			car = merge(existing, row)
+		case key == "vin" && row.Set["vin"]:
+			existing, err := imp.Cars.GetByVIN(ctx, row.Car.VIN)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				car = merge(existing, row)
+			}
+		}
+
+		// 3. Without vin as the key, the VIN must not belong to another car
+		if key != "vin" && row.Set["vin"] {
+			other, err := imp.Cars.GetByVIN(ctx, car.VIN)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return nil, err
+			}
+			if err == nil && other.ID != car.ID {
+				row.Errors = append(row.Errors, fmt.Sprintf("%v: %s (car %d)", repository.ErrDuplicateVIN, car.VIN, other.ID))
+				continue
+			}
+		}
+
+		if err := utils.ValidateCar(car); err != nil {
+			row.Errors = append(row.Errors, err.Error())
+			continue
+		}
+		cars[i] = car
+	}
+	return cars, nil
+}
+
+// merge overwrites the fields of existing that the row provides
+func merge(existing models.Car, row *Row) models.Car {
+	car := existing
+	if row.Set["make"] {
+		car.Make = row.Car.Make
+	}
+	if row.Set["model"] {
+		car.Model = row.Car.Model
+	}
+	if row.Set["year"] {
+		car.Year = row.Car.Year
+	}
+	if row.Set["price"] {
+		car.Price = row.Car.Price
+	}
+	if row.Set["color"] {
+		car.Color = row.Car.Color
+	}
+	if row.Set["mileage"] {
+		car.Mileage = row.Car.Mileage
+	}
+	if row.Set["vin"] {
+		car.VIN = row.Car.VIN
+	}
+	return car
+}
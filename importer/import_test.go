@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"strings"
+	"testing"
+)
+
+const inventoryCSV = "\ufeffBrand,Model,Model Year,Price,Color,Mileage,VIN,Stock Notes\n" +
+	"Honda,Accord,2003,\"$4,000\",Black,\"150,000\",1hgcm82633a004352,trade-in\n" +
+	"Toyota,Corolla,2021,18999,Silver,24500,,\n" +
+	"\n" +
+	"Ford,F-150,2019,0,Blue,61000,,bad price\n"
+
+func parseInventory(t *testing.T, data string) []Row {
+	t.Helper()
+	mapping, err := ParseMapping("make:Brand, year:Model Year")
+	if err != nil {
+		t.Fatalf("ParseMapping failed: %v", err)
+	}
+	rows, ignored, err := ParseCSV(strings.NewReader(data), mapping, 100)
+	if err != nil {
+		t.Fatalf("ParseCSV failed: %v", err)
+	}
+	if len(ignored) != 1 || ignored[0] != "Stock Notes" {
+		t.Errorf("Expected Stock Notes to be ignored, got %v", ignored)
+	}
+	return rows
+}
+
+func TestParseCSV(t *testing.T) {
+	rows := parseInventory(t, inventoryCSV)
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows (blank line skipped), got %d", len(rows))
+	}
+	first := rows[0]
+	if first.Line != 2 || first.Car.Make != "Honda" || first.Car.Year != 2003 || first.Car.Price != 4000 || first.Car.Mileage != 150000 {
+		t.Errorf("Unexpected first row %+v", first)
+	}
+	if rows[1].Set["vin"] {
+		t.Error("An empty cell must not count as provided")
+	}
+	if rows[2].Line != 5 {
+		t.Errorf("Expected the last row on line 5, got %d", rows[2].Line)
+	}
+
+	if _, _, err := ParseCSV(strings.NewReader("a,b\n1,2\n"), nil, 10); err == nil {
+		t.Error("Expected an error for a header without known columns")
+	}
+	if _, _, err := ParseCSV(strings.NewReader("make\nA\nB\nC\n"), nil, 2); err == nil {
+		t.Error("Expected an error above the row limit")
+	}
+}
+
+func TestRunTransactionRollsBackOnErrors(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryCarRepository()
+	imp := New(repo)
+
+	report, err := imp.Run(ctx, parseInventory(t, inventoryCSV), Options{Mode: ModeTransaction})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Committed || report.Failed != 1 || len(report.Errors) != 1 || report.Errors[0].Line != 5 {
+		t.Fatalf("Expected one error on line 5 and nothing committed, got %+v", report)
+	}
+	if n, _ := repo.Count(ctx, repository.CarFilter{}); n != 0 {
+		t.Errorf("Expected no cars written, got %d", n)
+	}
+}
+
+func TestRunRowModeAndDryRun(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryCarRepository()
+	imp := New(repo)
+
+	report, _ := imp.Run(ctx, parseInventory(t, inventoryCSV), Options{Mode: ModeRow, DryRun: true})
+	if report.Created != 2 || report.Failed != 1 || report.Committed {
+		t.Errorf("Unexpected dry run report %+v", report)
+	}
+	if n, _ := repo.Count(ctx, repository.CarFilter{}); n != 0 {
+		t.Fatalf("A dry run must not write, got %d cars", n)
+	}
+
+	report, _ = imp.Run(ctx, parseInventory(t, inventoryCSV), Options{Mode: ModeRow})
+	if report.Created != 2 || report.Failed != 1 || !report.Committed {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if n, _ := repo.Count(ctx, repository.CarFilter{}); n != 2 {
+		t.Errorf("Expected the 2 valid rows written, got %d", n)
+	}
+}
+
+func TestRunUpsertByVIN(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryCarRepository()
+	existing, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2003, Price: 5000, Color: "Black", Mileage: 140000, VIN: "1HGCM82633A004352"})
+
+	ndjson := `{"vin": "1HGCM82633A004352", "price": 4500}
+{"vin": "1HGCM82633A004352", "price": 4400}
+{"make": "Mazda", "model": "3", "year": 2020, "price": 15000, "vin": "JM1BPAML3L1000000"}
+not json`
+	rows, err := ParseNDJSON(strings.NewReader(ndjson), 100)
+	if err != nil {
+		t.Fatalf("ParseNDJSON failed: %v", err)
+	}
+
+	report, _ := New(repo).Run(ctx, rows, Options{Key: "vin", Mode: ModeRow})
+	if report.Updated != 1 || report.Failed != 3 {
+		t.Fatalf("Expected 1 update and 3 failures, got %+v", report)
+	}
+	wantLines := []int{2, 3, 4} // duplicate key, bad check digit, invalid JSON
+	for i, e := range report.Errors {
+		if e.Line != wantLines[i] {
+			t.Errorf("Expected error %d on line %d, got %+v", i, wantLines[i], e)
+		}
+	}
+
+	car, _ := repo.Get(ctx, existing.ID)
+	if car.Price != 4500 || car.Mileage != 140000 || car.Version != 2 {
+		t.Errorf("Expected only the price to change, got %+v", car)
+	}
+}
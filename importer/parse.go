@@ -0,0 +1,249 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"car-service/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fields are the car fields an import can set, by their canonical column name
+var Fields = []string{"id", "make", "model", "year", "price", "color", "mileage", "vin"}
+
+// Row is one parsed input line. Set lists the fields the line provides: when a row updates an
+// existing car, only those fields change.
+type Row struct {
+	Line   int
+	Car    models.Car
+	Set    map[string]bool
+	Errors []string
+}
+
+// ParseError is a problem with the file as a whole (no header, unknown mapping, ...)
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// canonical reduces a header to lower case letters and digits, so "Model Year", "model_year"
+// and "ModelYear" all compare equal
+func canonical(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ParseMapping parses "make:Brand,year:Model Year" into field -> header. Fields not listed
+// are matched by name.
+func ParseMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		field, header, ok := strings.Cut(pair, ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(header) == "" || !isField(field) {
+			return nil, fmt.Errorf("invalid column mapping %q, expected field:Header with field one of %s", pair, strings.Join(Fields, ", "))
+		}
+		mapping[field] = strings.TrimSpace(header)
+	}
+	return mapping, nil
+}
+
+func isField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCSV reads a CSV file whose first line is a header. Columns are matched to fields by
+// name or through mapping; other columns are returned as ignored.
+func ParseCSV(r io.Reader, mapping map[string]string, maxRows int) (rows []Row, ignored []string, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, &ParseError{Msg: "the file is empty"}
+	}
+	if err != nil {
+		return nil, nil, &ParseError{Line: 1, Msg: err.Error()}
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Excel's UTF-8 BOM
+	}
+
+	// Resolve every field to a column index
+	byName := map[string]int{}
+	for i, h := range header {
+		byName[canonical(h)] = i
+	}
+	columns := map[string]int{}
+	for _, field := range Fields {
+		name := field
+		if h, ok := mapping[field]; ok {
+			name = h
+		}
+		if i, ok := byName[canonical(name)]; ok {
+			columns[field] = i
+		} else if _, mapped := mapping[field]; mapped {
+			return nil, nil, &ParseError{Line: 1, Msg: fmt.Sprintf("column %q mapped to %s is not in the header", name, field)}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, &ParseError{Line: 1, Msg: "the header has none of the columns " + strings.Join(Fields, ", ")}
+	}
+	used := map[int]bool{}
+	for _, i := range columns {
+		used[i] = true
+	}
+	for i, h := range header {
+		if !used[i] {
+			ignored = append(ignored, h)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, nil, &ParseError{Line: parseErr.Line, Msg: parseErr.Err.Error()}
+			}
+			return nil, nil, err
+		}
+		if isBlank(record) {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, nil, &ParseError{Line: line, Msg: fmt.Sprintf("too many rows, at most %d per import", maxRows)}
+		}
+
+		row := Row{Line: line, Set: map[string]bool{}}
+		for field, i := range columns {
+			if i < len(record) {
+				row.set(field, strings.TrimSpace(record[i]))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, ignored, nil
+}
+
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// set assigns a text value to a field; empty values are treated as not provided
+func (row *Row) set(field, value string) {
+	if value == "" {
+		return
+	}
+	var err error
+	switch field {
+	case "id":
+		row.Car.ID, err = strconv.Atoi(value)
+	case "make":
+		row.Car.Make = value
+	case "model":
+		row.Car.Model = value
+	case "year":
+		row.Car.Year, err = strconv.Atoi(value)
+	case "price":
+		// Accept spreadsheet formatting such as "$12,499.00"
+		row.Car.Price, err = strconv.ParseFloat(strings.NewReplacer("$", "", ",", "").Replace(value), 64)
+	case "color":
+		row.Car.Color = value
+	case "mileage":
+		row.Car.Mileage, err = strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+	case "vin":
+		row.Car.VIN = value
+	}
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("%s: %q is not a valid number", field, value))
+		return
+	}
+	row.Set[field] = true
+}
+
+// ParseNDJSON reads one JSON object per line, with the same field names as the REST API.
+// Blank lines are skipped.
+func ParseNDJSON(r io.Reader, maxRows int) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, &ParseError{Line: line, Msg: fmt.Sprintf("too many rows, at most %d per import", maxRows)}
+		}
+
+		row := Row{Line: line, Set: map[string]bool{}}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			row.Errors = append(row.Errors, "invalid JSON: "+err.Error())
+			rows = append(rows, row)
+			continue
+		}
+		for key, raw := range obj {
+			field := strings.ToLower(key)
+			if !isField(field) || string(raw) == "null" {
+				continue
+			}
+			var value interface{}
+			json.Unmarshal(raw, &value)
+			switch v := value.(type) {
+			case string:
+				row.set(field, strings.TrimSpace(v))
+			case float64:
+				row.set(field, strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				row.Errors = append(row.Errors, fmt.Sprintf("%s: expected a string or number", field))
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, &ParseError{Line: line + 1, Msg: "line is longer than 1 MB"}
+		}
+		return nil, err
+	}
+	return rows, nil
+}
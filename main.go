@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"car-service/booking"
+	"car-service/config"
 	"car-service/db"
+	"car-service/documents"
 	"car-service/graph"
 	"car-service/handlers"
+	"car-service/importer"
 	"car-service/middleware"
+	"car-service/repository"
+	"car-service/storage"
+	"car-service/utils"
 
 	"github.com/gorilla/mux"
 	"github.com/graphql-go/handler"
@@ -22,18 +32,40 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		duration := time.Since(start)
-		log.Printf("Method: %s, URL: %s, Duration: %s", r.Method, r.URL, duration)
+		log.Printf("Method: %s, URL: %s, Duration: %s, Request ID: %s", r.Method, r.URL, duration, middleware.RequestID(r.Context()))
 	})
 }
 
 func main() {
-	// Start pprof server on port 6060
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
+	// Start pprof server
 	go func() {
-		log.Println("Starting pprof server on :6060")
-		log.Println(http.ListenAndServe("0.0.0.0:6060", nil))
+		log.Printf("Starting pprof server on %s", cfg.Server.PprofAddr)
+		log.Println(http.ListenAndServe(cfg.Server.PprofAddr, nil))
 	}()
 
-	_, _ = db.InitDB() // Initialize DB (Skeleton)
+	_, _ = db.InitDB(cfg.DB) // Initialize DB (Skeleton)
+
+	// Apply pending migrations (advisory-locked, safe with several replicas)
+	migrator, err := db.NewMigrator(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if count, err := migrator.Up(context.Background()); err != nil {
+		log.Fatalf("Failed to apply migrations: %v", err)
+	} else if count > 0 {
+		log.Printf("Applied %d migration(s)", count)
+	}
+	carRepo := repository.NewPostgresCarRepository(db.DB)
 
 	// Reset Database on Startup (As requested)
 	// if err := db.ResetDB(); err != nil {
@@ -41,18 +73,93 @@ func main() {
 	// }
 
 	r := mux.NewRouter()
+	r.Use(middleware.RequestIDMiddleware)
 	r.Use(loggingMiddleware)
+	r.Use(middleware.ClientIPMiddleware(cfg.Server.TrustProxy))
+
+	tokens := utils.NewTokenManager(cfg.Auth)
+	authenticate := middleware.AuthMiddleware(tokens)
+	adminOnly := func(h http.HandlerFunc) http.Handler {
+		return authenticate(middleware.RequireRole(middleware.RoleAdmin)(h))
+	}
 
-	r.HandleFunc("/cars", handlers.GetCars).Methods("GET")
-	r.HandleFunc("/cars", handlers.CreateCar).Methods("POST")
-	r.HandleFunc("/cars/{id}", handlers.GetCar).Methods("GET")
-	r.HandleFunc("/cars/{id}", handlers.UpdateCar).Methods("PUT")
+	carHandler := handlers.NewCarHandler(carRepo)
+	r.HandleFunc("/cars", carHandler.GetCars).Methods("GET")
+	r.Handle("/cars/trash", adminOnly(carHandler.GetTrashedCars)).Methods("GET") // Before /cars/{id}
+	renderer := documents.NewRenderer(repository.NewPostgresDocumentTemplateRepository(db.DB), cfg.Documents)
+	documentHandler := handlers.NewDocumentHandler(renderer, carRepo)
+	r.Handle("/cars/stickers", adminOnly(documentHandler.GetStickers)).Methods("GET")                 // Before /cars/{id}
+	r.Handle("/cars/export", adminOnly(handlers.NewExportHandler(carRepo).ExportCars)).Methods("GET") // Before /cars/{id}
+	r.Handle("/cars", adminOnly(carHandler.CreateCar)).Methods("POST")
+	r.Handle("/cars/import", adminOnly(handlers.NewImportHandler(importer.New(carRepo)).ImportCars)).Methods("POST")
+	r.HandleFunc("/cars/{id}", carHandler.GetCar).Methods("GET")
+	r.Handle("/cars/{id}", adminOnly(carHandler.UpdateCar)).Methods("PUT")
+	r.Handle("/cars/{id}", adminOnly(carHandler.DeleteCar)).Methods("DELETE")
+	r.Handle("/cars/{id}/status", adminOnly(carHandler.ChangeStatus)).Methods("POST")
+	r.Handle("/cars/{id}/restore", adminOnly(carHandler.RestoreCar)).Methods("POST")
+	r.Handle("/cars/{id}/purge", adminOnly(carHandler.PurgeCar)).Methods("DELETE")
+	r.HandleFunc("/cars/{id}/price-history", carHandler.GetPriceHistory).Methods("GET")
 
-	// Protect DELETE route (Now handled by GraphQL or could be updated here if REST is still used)
-	r.HandleFunc("/cars/{id}", handlers.DeleteCar).Methods("DELETE")
+	// Window stickers and listing sheets, rendered from admin-editable templates
+	r.HandleFunc("/cars/{id}/sticker", documentHandler.GetSticker).Methods("GET")
+	r.Handle("/document-templates", adminOnly(documentHandler.ListTemplates)).Methods("GET")
+	r.Handle("/document-templates/{name}", adminOnly(documentHandler.GetTemplate)).Methods("GET")
+	r.Handle("/document-templates/{name}", adminOnly(documentHandler.PutTemplate)).Methods("PUT")
+	r.Handle("/document-templates/{name}", adminOnly(documentHandler.DeleteTemplate)).Methods("DELETE")
+
+	// Car photos: files on local disk served under MEDIA_BASE_URL, metadata in car_images
+	blobs, err := storage.NewLocalBlobStore(cfg.Storage.UploadDir, cfg.Storage.MediaBaseURL)
+	if err != nil {
+		log.Fatalf("Failed to initialise image storage: %v", err)
+	}
+	media := storage.NewImageService(blobs, repository.NewPostgresCarImageRepository(db.DB), carRepo, int64(cfg.Storage.MaxImageBytes))
+	if strings.HasPrefix(cfg.Storage.MediaBaseURL, "/") {
+		prefix := strings.TrimSuffix(cfg.Storage.MediaBaseURL, "/") + "/"
+		r.PathPrefix(prefix).Handler(http.StripPrefix(prefix, blobs.Handler())).Methods("GET", "HEAD")
+	}
+	go runTrashPurger(context.Background(), carRepo, media, cfg.Trash)
+	go runHoldSweeper(context.Background(), carRepo, cfg.Holds)
+
+	imageHandler := handlers.NewImageHandler(media)
+	r.HandleFunc("/cars/{id}/images", imageHandler.ListImages).Methods("GET")
+	r.Handle("/cars/{id}/images", adminOnly(imageHandler.UploadImage)).Methods("POST")
+	r.Handle("/cars/{id}/images/order", adminOnly(imageHandler.ReorderImages)).Methods("PUT")
+	r.Handle("/cars/{id}/images/{imageId}", adminOnly(imageHandler.DeleteImage)).Methods("DELETE")
+	r.Handle("/cars/{id}/images/{imageId}/primary", adminOnly(imageHandler.SetPrimaryImage)).Methods("PUT")
+
+	// Test drives: booked through GraphQL, subscribed to as a per-customer calendar feed
+	mailer := utils.NewMailer(cfg.SMTP)
+	testDrives, err := booking.NewService(repository.NewPostgresTestDriveRepository(db.DB), carRepo, mailer, cfg.Bookings, cfg.Auth.JWTSecret)
+	if err != nil {
+		log.Fatalf("Invalid booking configuration: %v", err)
+	}
+	r.HandleFunc("/test-drives/feed.ics", handlers.NewTestDriveHandler(testDrives).GetFeed).Methods("GET")
+
+	// Sales orders: created and paid through GraphQL, invoices downloadable by the buyer
+	orders := repository.NewPostgresOrderRepository(db.DB, cfg.Sales.InvoicePrefix)
+	r.Handle("/orders/{id}/invoice", authenticate(http.HandlerFunc(handlers.NewOrderHandler(orders, renderer).GetInvoice))).Methods("GET")
+
+	auditRepo := repository.NewPostgresAuditRepository(db.DB)
+	r.Handle("/audit", adminOnly(handlers.NewAuditHandler(auditRepo).GetAudit)).Methods("GET")
 
 	// GraphQL Endpoint
-	schema, err := graph.InitSchema()
+	resolver := &graph.Resolver{
+		Cars:       carRepo,
+		Sessions:   repository.NewPostgresSessionRepository(db.DB),
+		Throttle:   repository.NewPostgresLoginThrottleRepository(db.DB),
+		LoginCodes: repository.NewPostgresLoginCodeRepository(db.DB),
+		Audit:      auditRepo,
+		Media:      media,
+		TestDrives: testDrives,
+		Tokens:     tokens,
+		Mailer:     mailer,
+		Login:      cfg.Login,
+		Holds:      cfg.Holds,
+		Orders:     orders,
+		Documents:  renderer,
+		Sales:      cfg.Sales,
+	}
+	schema, err := graph.InitSchema(resolver)
 	if err != nil {
 		log.Fatalf("Failed to create GraphQL schema: %v", err)
 	}
@@ -62,8 +169,9 @@ func main() {
 		Pretty:   true,
 		GraphiQL: true,
 	})
-	r.Handle("/graphql", middleware.AuthMiddleware(h))
+	uploads := graph.UploadMiddleware(int64(cfg.Storage.MaxImageBytes) + 1<<20)
+	r.Handle("/graphql", authenticate(uploads(resolver.LoaderMiddleware(h))))
 
-	fmt.Println("Server starting...")
-	log.Fatal(http.ListenAndServe(":8000", r))
+	fmt.Printf("Server starting on %s...\n", cfg.Server.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Server.Addr, r))
 }
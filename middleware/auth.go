@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -16,59 +17,62 @@ const UserIDKey = contextKey("userID")
 const RoleKey = contextKey("role")
 
 // AuthMiddleware validates the JWT token in the Authorization header
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			// No token, proceed without user context (public access or handled by resolver)
-			next.ServeHTTP(w, r)
-			return
-		}
+func AuthMiddleware(tokens *utils.TokenManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				// No token, proceed without user context (public access or handled by resolver)
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		bearerToken := strings.Split(authHeader, " ")
-		if len(bearerToken) != 2 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"errors": [{"message": "Invalid Authorization header format"}]}`))
-			return
-		}
+			bearerToken := strings.Split(authHeader, " ")
+			if len(bearerToken) != 2 {
+				writeError(w, http.StatusUnauthorized, "Invalid Authorization header format")
+				return
+			}
 
-		tokenString := bearerToken[1]
-		token, err := utils.ValidateToken(tokenString)
-		if err != nil || !token.Valid {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"errors": [{"message": "Invalid or expired token"}]}`))
-			return
-		}
+			tokenString := bearerToken[1]
+			token, err := tokens.ValidateToken(tokenString)
+			if err != nil || !token.Valid {
+				writeError(w, http.StatusUnauthorized, "Invalid or expired token")
+				return
+			}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"errors": [{"message": "Invalid token claims"}]}`))
-			return
-		}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "Invalid token claims")
+				return
+			}
 
-		// Extract user_id safely
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(`{"errors": [{"message": "Invalid user ID in token"}]}`))
-			return
-		}
-		userID := int(userIDFloat)
+			// Extract user_id safely
+			userIDFloat, ok := claims["user_id"].(float64)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "Invalid user ID in token")
+				return
+			}
+			userID := int(userIDFloat)
 
-		// Extract role safely
-		role, ok := claims["role"].(string)
-		if !ok {
-			role = "user" // Default fallback
-		}
+			// Extract role safely
+			role, ok := claims["role"].(string)
+			if !ok {
+				role = RoleUser // Default fallback
+			}
 
-		// Add userID and role to context
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		ctx = context.WithValue(ctx, RoleKey, role)
-		next.ServeHTTP(w, r.WithContext(ctx))
+			// Add userID and role to context
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, RoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// writeError writes a GraphQL-style {"errors": [{"message": ...}]} body, used by both APIs
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
 	})
 }
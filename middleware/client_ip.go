@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const ClientIPKey = contextKey("clientIP")
+
+// ClientIPMiddleware stores the caller's IP in the request context.
+// X-Forwarded-For is only honoured when trustProxy is set, otherwise clients could spoof it.
+func ClientIPMiddleware(trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				ip = host
+			}
+			if trustProxy {
+				if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+					ip = strings.TrimSpace(strings.Split(fwd, ",")[0])
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), ClientIPKey, ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the IP stored by ClientIPMiddleware, or "unknown"
+func ClientIP(ctx context.Context) string {
+	if ip, ok := ctx.Value(ClientIPKey).(string); ok && ip != "" {
+		return ip
+	}
+	return "unknown"
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RoleAdmin is the role allowed to manage the inventory
+const RoleAdmin = "admin"
+
+// RoleUser is the role of customers who signed up through requestLogin
+const RoleUser = "user"
+
+var (
+	// ErrUnauthorized is returned when the request carries no valid token
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned when the caller's role is not allowed
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Authorize is the single role check shared by the REST router and the GraphQL resolvers.
+// It expects AuthMiddleware to have run and accepts the caller if their role is one of roles.
+func Authorize(ctx context.Context, roles ...string) error {
+	if _, ok := ctx.Value(UserIDKey).(int); !ok {
+		return ErrUnauthorized
+	}
+	role, _ := ctx.Value(RoleKey).(string)
+	for _, allowed := range roles {
+		if role == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %ss only", ErrForbidden, strings.Join(roles, "s or "))
+}
+
+// RequireRole rejects requests with 401 (no token) or 403 (wrong role) unless the caller has one of roles
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := Authorize(r.Context(), roles...)
+			if errors.Is(err, ErrUnauthorized) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
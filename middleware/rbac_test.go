@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := RequireRole(RoleAdmin)(ok)
+
+	cases := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"anonymous", context.Background(), http.StatusUnauthorized},
+		{"user", context.WithValue(context.WithValue(context.Background(), UserIDKey, 1), RoleKey, "user"), http.StatusForbidden},
+		{"admin", context.WithValue(context.WithValue(context.Background(), UserIDKey, 1), RoleKey, RoleAdmin), http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/cars", nil).WithContext(tc.ctx))
+		if rec.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, rec.Code)
+		}
+		if tc.status != http.StatusNoContent && rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected JSON error body, got %q", tc.name, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"car-service/config"
+	"car-service/db"
+)
+
+// runMigrate implements the `migrate status|up|down [steps]` subcommand
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: go run . migrate status|up|down [steps]")
+		return
+	}
+
+	if _, err := db.InitDB(cfg.DB); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	migrator, err := db.NewMigrator(db.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+		if err != nil {
+			log.Fatalf("Migration status check failed: %v", err)
+		}
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid step count: %s", args[1])
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", count)
+	default:
+		log.Fatalf("Unknown migrate command: %s", args[0])
+	}
+}
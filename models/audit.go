@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent is one append-only record of an inventory or role change.
+// Before and After hold only the fields that changed (null on create/delete respectively).
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	ActorID   *int            `json:"actor_id"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id"`
+	IP        string          `json:"ip"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Car struct {
 	ID      int     `json:"id"`
 	Make    string  `json:"make"`
@@ -8,4 +10,28 @@ type Car struct {
 	Price   float64 `json:"price"`
 	Color   string  `json:"color"`
 	Mileage int     `json:"mileage"`
+	VIN     string  `json:"vin,omitempty"`
+	// Status only changes through the transitions in car_status.go; writes of the other
+	// fields keep it
+	Status          string     `json:"status"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	StatusChangedBy *int       `json:"status_changed_by,omitempty"`
+	Version         int        `json:"version"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	// Match is set only on cars returned by a search; it is not stored
+	Match *SearchMatch `json:"match,omitempty"`
+}
+
+// SearchMatch explains why a car matched a search. Rank orders the cars of one result set,
+// higher first; it is not comparable across searches.
+type SearchMatch struct {
+	Rank       float64     `json:"rank"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Highlight is a field value with the matched words wrapped in <mark></mark>. The rest of the
+// value is HTML-escaped.
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
 }
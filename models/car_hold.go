@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Reasons a hold ended
+const (
+	// HoldExpired holds ran out and were released by the sweeper
+	HoldExpired = "expired"
+	// HoldReleased holds were given up by the customer or an admin
+	HoldReleased = "released"
+	// HoldStatusChanged holds ended because an admin moved the car out of reserved, e.g. sold it
+	HoldStatusChanged = "status_changed"
+)
+
+// CarHold is a customer's time-limited reservation of a car. While it is active the car is
+// reserved; it ends when it expires, is released or the car's status changes.
+type CarHold struct {
+	ID            int        `json:"id"`
+	CarID         int        `json:"car_id"`
+	UserID        int        `json:"user_id"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+	ReleaseReason string     `json:"release_reason,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CarImage is one photo of a car. Key locates the file in the blob store; URL is filled in
+// from the store when the image is returned to a client.
+type CarImage struct {
+	ID          int       `json:"id"`
+	CarID       int       `json:"car_id"`
+	Key         string    `json:"-"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int64     `json:"size"`
+	Position    int       `json:"position"`
+	Primary     bool      `json:"primary"`
+	CreatedAt   time.Time `json:"created_at"`
+}
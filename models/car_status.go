@@ -0,0 +1,48 @@
+package models
+
+// Inventory statuses of a car
+const (
+	StatusDraft     = "draft"
+	StatusAvailable = "available"
+	StatusReserved  = "reserved"
+	StatusSold      = "sold"
+)
+
+// CarStatuses lists every status in lifecycle order
+var CarStatuses = []string{StatusDraft, StatusAvailable, StatusReserved, StatusSold}
+
+// statusTransitions is the lifecycle draft → available → reserved → sold. A car may skip the
+// reservation, and each step can be rolled back: a listing is unpublished, a reservation
+// released, and a sale that falls through goes back to reserved or available.
+var statusTransitions = map[string][]string{
+	StatusDraft:     {StatusAvailable},
+	StatusAvailable: {StatusReserved, StatusSold, StatusDraft},
+	StatusReserved:  {StatusSold, StatusAvailable},
+	StatusSold:      {StatusReserved, StatusAvailable},
+}
+
+// IsCarStatus reports whether s is a known status
+func IsCarStatus(s string) bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// IsInitialStatus reports whether a new car may be created with status s
+func IsInitialStatus(s string) bool {
+	return s == StatusDraft || s == StatusAvailable
+}
+
+// AllowedTransitions lists the statuses a car in status from can move to
+func AllowedTransitions(from string) []string {
+	return append([]string(nil), statusTransitions[from]...)
+}
+
+// CanTransition reports whether a car may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
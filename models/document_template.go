@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// DocumentTemplate is an admin-edited override of a built-in printable document (e.g. the
+// window sticker). HTML is an html/template; PDF is a text/template in the layout language
+// described in the documents package.
+type DocumentTemplate struct {
+	Name      string    `json:"name"`
+	HTML      string    `json:"html"`
+	PDF       string    `json:"pdf"`
+	Builtin   bool      `json:"builtin"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	UpdatedBy *int      `json:"updated_by,omitempty"`
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Order statuses. An order is open from the sale on; cancelling it puts the car back on
+// sale but keeps the order and its invoice number.
+const (
+	OrderOpen      = "open"
+	OrderCancelled = "cancelled"
+)
+
+// OrderStatuses lists every order status
+var OrderStatuses = []string{OrderOpen, OrderCancelled}
+
+// Payment statuses, derived from the payments recorded against an order
+const (
+	PaymentUnpaid   = "unpaid"
+	PaymentPartial  = "partially_paid"
+	PaymentPaid     = "paid"
+	PaymentRefunded = "refunded"
+)
+
+// PaymentStatuses lists every payment status
+var PaymentStatuses = []string{PaymentUnpaid, PaymentPartial, PaymentPaid, PaymentRefunded}
+
+// Payment methods an admin can record
+const (
+	PaymentCash         = "cash"
+	PaymentCard         = "card"
+	PaymentBankTransfer = "bank_transfer"
+	PaymentFinancing    = "financing"
+	PaymentCheck        = "check"
+)
+
+// PaymentMethods lists every payment method
+var PaymentMethods = []string{PaymentCash, PaymentCard, PaymentBankTransfer, PaymentFinancing, PaymentCheck}
+
+// Line item kinds. Fees are fixed amounts; taxes are a percentage of the agreed price plus fees.
+const (
+	LineItemFee = "fee"
+	LineItemTax = "tax"
+)
+
+// LineItem is a fee or tax charged on top of the agreed price
+type LineItem struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// Rate is the tax percentage, e.g. 8.25; unset for fees
+	Rate   *float64 `json:"rate,omitempty"`
+	Amount float64  `json:"amount"`
+}
+
+// Payment is money received for an order, recorded by an admin. Refunds have a negative amount.
+type Payment struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"order_id"`
+	Amount     float64   `json:"amount"`
+	Method     string    `json:"method"`
+	Reference  string    `json:"reference,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+	RecordedBy *int      `json:"recorded_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Order is the sale of a car to a buyer. The vehicle description, VIN and mileage are copied
+// at the time of sale so the invoice stays the same if the car is edited or purged later.
+type Order struct {
+	ID            int    `json:"id"`
+	InvoiceNumber string `json:"invoice_number"`
+	// CarID is 0 once the car has been purged
+	CarID   int    `json:"car_id"`
+	Vehicle string `json:"vehicle"`
+	VIN     string `json:"vin,omitempty"`
+	Mileage int    `json:"mileage"`
+	BuyerID int    `json:"buyer_id"`
+	// BuyerEmail is printed on the invoice; it is read from the users table
+	BuyerEmail    string     `json:"-"`
+	Price         float64    `json:"price"`
+	LineItems     []LineItem `json:"line_items"`
+	Total         float64    `json:"total"`
+	AmountPaid    float64    `json:"amount_paid"`
+	Status        string     `json:"status"`
+	PaymentStatus string     `json:"payment_status"`
+	DueAt         time.Time  `json:"due_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CreatedBy     *int       `json:"created_by,omitempty"`
+	CancelledAt   *time.Time `json:"cancelled_at,omitempty"`
+	// Payments are oldest first
+	Payments []Payment `json:"payments"`
+}
+
+// Cents converts an amount to whole cents, the unit all order arithmetic is done in
+func Cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// Subtotal is the agreed price plus fees
+func (o Order) Subtotal() float64 {
+	cents := Cents(o.Price)
+	for _, item := range o.LineItems {
+		if item.Kind == LineItemFee {
+			cents += Cents(item.Amount)
+		}
+	}
+	return fromCents(cents)
+}
+
+// Balance is what the buyer still owes
+func (o Order) Balance() float64 {
+	return fromCents(Cents(o.Total) - Cents(o.AmountPaid))
+}
+
+// PriceItems computes the tax amounts from their rates and the order total, rounding each tax to the cent
+func (o *Order) PriceItems() {
+	subtotal := Cents(o.Subtotal())
+	total := subtotal
+	for i, item := range o.LineItems {
+		if item.Kind == LineItemTax && item.Rate != nil {
+			o.LineItems[i].Amount = fromCents(int64(math.Round(float64(subtotal) * *item.Rate / 100)))
+		}
+		if item.Kind == LineItemTax {
+			total += Cents(o.LineItems[i].Amount)
+		}
+	}
+	o.Total = fromCents(total)
+}
+
+// PaymentStatusOf derives the payment status of an order from the net amount paid
+func PaymentStatusOf(total, paid float64, refunded bool) string {
+	switch {
+	case Cents(paid) <= 0 && refunded:
+		return PaymentRefunded
+	case Cents(paid) <= 0:
+		return PaymentUnpaid
+	case Cents(paid) < Cents(total):
+		return PaymentPartial
+	}
+	return PaymentPaid
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// PriceChange records one price a car was given. OldPrice is nil for the price it was listed at.
+type PriceChange struct {
+	ID        int64     `json:"id"`
+	CarID     int       `json:"car_id"`
+	OldPrice  *float64  `json:"old_price"`
+	NewPrice  float64   `json:"new_price"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy *int      `json:"changed_by,omitempty"`
+}
+
+// PriceDrop is a car whose price fell below what it cost at the start of a period
+type PriceDrop struct {
+	Car           Car       `json:"car"`
+	PreviousPrice float64   `json:"previous_price"`
+	Amount        float64   `json:"amount"`
+	Percent       float64   `json:"percent"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
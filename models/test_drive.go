@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Test drive booking statuses. A booking starts pending until an admin confirms it;
+// cancelled is final and frees the slot.
+const (
+	TestDrivePending   = "pending"
+	TestDriveConfirmed = "confirmed"
+	TestDriveCancelled = "cancelled"
+)
+
+// TestDriveStatuses lists every booking status
+var TestDriveStatuses = []string{TestDrivePending, TestDriveConfirmed, TestDriveCancelled}
+
+// testDriveTransitions maps a booking status to the statuses it can move to
+var testDriveTransitions = map[string][]string{
+	TestDrivePending:   {TestDriveConfirmed, TestDriveCancelled},
+	TestDriveConfirmed: {TestDriveCancelled},
+}
+
+// TestDriveSources returns the statuses a booking can move to status from
+func TestDriveSources(status string) []string {
+	var from []string
+	for _, s := range TestDriveStatuses {
+		for _, to := range testDriveTransitions[s] {
+			if to == status {
+				from = append(from, s)
+			}
+		}
+	}
+	return from
+}
+
+// TestDrive is a customer's booking of a car for the half-open interval [Start, End)
+type TestDrive struct {
+	ID     int `json:"id"`
+	CarID  int `json:"car_id"`
+	UserID int `json:"user_id"`
+	// UserEmail is where confirmations are sent; it is read from the users table
+	UserEmail string    `json:"-"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
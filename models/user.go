@@ -11,9 +11,10 @@ type User struct {
 
 // VerificationCode represents an OTP for email login
 type VerificationCode struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Code      string    `json:"code"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	CodeHash   string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
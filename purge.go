@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"car-service/config"
+	"car-service/repository"
+	"car-service/storage"
+)
+
+// runTrashPurger permanently deletes cars that have been in the trash longer than the
+// retention period, once at startup and then every purge interval, until ctx is done.
+// It also removes the photos left behind by purged cars.
+// Running it on several replicas is safe: each trashed row is only deleted once.
+func runTrashPurger(ctx context.Context, cars repository.CarRepository, media *storage.ImageService, cfg config.TrashConfig) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		count, err := cars.PurgeTrashed(ctx, time.Now().Add(-cfg.Retention))
+		if err != nil {
+			log.Printf("Trash purge failed: %v", err)
+		} else if count > 0 {
+			log.Printf("Purged %d car(s) from the trash", count)
+		}
+		if count, err := media.RemoveOrphans(ctx); err != nil {
+			log.Printf("Photo cleanup failed: %v", err)
+		} else if count > 0 {
+			log.Printf("Removed %d photo(s) of purged cars", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runHoldSweeper releases expired car holds every sweep interval until ctx is done, making
+// the cars available again. Like runTrashPurger it is safe to run on several replicas.
+func runHoldSweeper(ctx context.Context, cars repository.CarRepository, cfg config.HoldsConfig) {
+	ticker := time.NewTicker(cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := cars.ReleaseExpiredHolds(ctx, time.Now()); err != nil {
+			log.Printf("Hold sweep failed: %v", err)
+		} else if count > 0 {
+			log.Printf("Released %d expired hold(s)", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
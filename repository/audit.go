@@ -0,0 +1,280 @@
+package repository
+
+import (
+	"bytes"
+	"car-service/middleware"
+	"car-service/models"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audit actions and entities
+const (
+	ActionCarCreate  = "car.create"
+	ActionCarUpdate  = "car.update"
+	ActionCarDelete  = "car.delete"
+	ActionCarRestore = "car.restore"
+	ActionCarPurge   = "car.purge"
+	ActionCarStatus  = "car.status"
+	ActionCarReserve = "car.reserve"
+	ActionCarRelease = "car.release"
+	ActionRoleChange = "user.role_change"
+
+	ActionOrderCreate  = "order.create"
+	ActionOrderPayment = "order.payment"
+	ActionOrderCancel  = "order.cancel"
+
+	EntityCar   = "car"
+	EntityUser  = "user"
+	EntityOrder = "order"
+)
+
+// AuditFilter narrows an audit log listing; zero values match everything
+type AuditFilter struct {
+	ActorID  *int
+	Action   string
+	Entity   string
+	EntityID *int
+	Since    *time.Time
+	Until    *time.Time
+}
+
+// AuditRepository reads the audit log, newest first. Events are written by the
+// repositories themselves, inside the transaction of the change they describe.
+type AuditRepository interface {
+	// List returns up to limit events older than the afterID cursor (0 starts at the newest)
+	List(ctx context.Context, filter AuditFilter, limit int, afterID int64) ([]models.AuditEvent, error)
+}
+
+// NewAuditEvent describes a change made on behalf of the request in ctx.
+// before/after are snapshots of the entity; only the fields that differ are kept.
+func NewAuditEvent(ctx context.Context, action, entity string, entityID int, before, after interface{}) (models.AuditEvent, error) {
+	ev := models.AuditEvent{
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		RequestID: middleware.RequestID(ctx),
+		ActorID:   actorID(ctx),
+	}
+	if ip, ok := ctx.Value(middleware.ClientIPKey).(string); ok {
+		ev.IP = ip
+	}
+
+	var err error
+	ev.Before, ev.After, err = auditDiff(before, after)
+	return ev, err
+}
+
+// newCarAuditEvent is NewAuditEvent for a car; a nil snapshot means the car did not exist on that side
+func newCarAuditEvent(ctx context.Context, action string, id int, before, after *models.Car) (models.AuditEvent, error) {
+	var b, a interface{}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	return NewAuditEvent(ctx, action, EntityCar, id, b, a)
+}
+
+// auditDiff marshals both snapshots and, when both exist, drops the top-level fields that are equal
+func auditDiff(before, after interface{}) (json.RawMessage, json.RawMessage, error) {
+	if before == nil || after == nil {
+		var b, a json.RawMessage
+		var err error
+		if before != nil {
+			b, err = json.Marshal(before)
+		}
+		if after != nil && err == nil {
+			a, err = json.Marshal(after)
+		}
+		return b, a, err
+	}
+
+	bm, err := toFieldMap(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	am, err := toFieldMap(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range bm {
+		if bytes.Equal(v, am[k]) {
+			delete(bm, k)
+			delete(am, k)
+		}
+	}
+	b, err := json.Marshal(bm)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := json.Marshal(am)
+	return b, a, err
+}
+
+func toFieldMap(v interface{}) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]json.RawMessage{}
+	return m, json.Unmarshal(raw, &m)
+}
+
+// execer is satisfied by *sql.DB, *sql.Tx and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// InsertAudit appends an event using ex, normally the transaction of the change being audited
+func InsertAudit(ctx context.Context, ex execer, ev models.AuditEvent) error {
+	_, err := ex.ExecContext(ctx,
+		`INSERT INTO audit_events (actor_id, action, entity, entity_id, before, after, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ev.ActorID, ev.Action, ev.Entity, ev.EntityID, nullJSON(ev.Before), nullJSON(ev.After), ev.RequestID, ev.IP)
+	return err
+}
+
+func nullJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// EncodeAuditCursor returns the opaque cursor of an audit event
+func EncodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("audit:" + strconv.FormatInt(id, 10)))
+}
+
+// DecodeAuditCursor is the inverse of EncodeAuditCursor
+func DecodeAuditCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !bytes.HasPrefix(raw, []byte("audit:")) {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw[len("audit:"):]), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// PostgresAuditRepository reads the audit_events table
+type PostgresAuditRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresAuditRepository creates an AuditRepository backed by the given connection pool
+func NewPostgresAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{db: db}
+}
+
+func (r *PostgresAuditRepository) List(ctx context.Context, filter AuditFilter, limit int, afterID int64) ([]models.AuditEvent, error) {
+	b := &queryBuilder{}
+	if filter.ActorID != nil {
+		b.conds = append(b.conds, "actor_id = "+b.arg(*filter.ActorID))
+	}
+	if filter.Action != "" {
+		b.conds = append(b.conds, "action = "+b.arg(filter.Action))
+	}
+	if filter.Entity != "" {
+		b.conds = append(b.conds, "entity = "+b.arg(filter.Entity))
+	}
+	if filter.EntityID != nil {
+		b.conds = append(b.conds, "entity_id = "+b.arg(*filter.EntityID))
+	}
+	if filter.Since != nil {
+		b.conds = append(b.conds, "created_at >= "+b.arg(*filter.Since))
+	}
+	if filter.Until != nil {
+		b.conds = append(b.conds, "created_at < "+b.arg(*filter.Until))
+	}
+	if afterID > 0 {
+		b.conds = append(b.conds, "id < "+b.arg(afterID))
+	}
+
+	query := `SELECT id, actor_id, action, entity, entity_id, before, after, request_id, ip, created_at
+		FROM audit_events` + b.where() + " ORDER BY id DESC LIMIT " + b.arg(limit)
+	rows, err := r.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var ev models.AuditEvent
+		var actorID sql.NullInt64
+		var before, after []byte
+		err := rows.Scan(&ev.ID, &actorID, &ev.Action, &ev.Entity, &ev.EntityID, &before, &after, &ev.RequestID, &ev.IP, &ev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			ev.ActorID = &id
+		}
+		ev.Before, ev.After = before, after
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// MemoryAuditRepository keeps audit events in a slice, for tests and local runs without Postgres
+type MemoryAuditRepository struct {
+	mu     sync.RWMutex
+	events []models.AuditEvent
+}
+
+// NewMemoryAuditRepository creates an empty in-memory audit log
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+// Append stores an event, assigning its ID and timestamp
+func (r *MemoryAuditRepository) Append(ev models.AuditEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ev.ID = int64(len(r.events) + 1)
+	ev.CreatedAt = time.Now()
+	r.events = append(r.events, ev)
+}
+
+func (r *MemoryAuditRepository) List(ctx context.Context, filter AuditFilter, limit int, afterID int64) ([]models.AuditEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []models.AuditEvent{}
+	for _, ev := range r.events {
+		if afterID > 0 && ev.ID >= afterID {
+			continue
+		}
+		if filter.ActorID != nil && (ev.ActorID == nil || *ev.ActorID != *filter.ActorID) {
+			continue
+		}
+		if (filter.Action != "" && ev.Action != filter.Action) || (filter.Entity != "" && ev.Entity != filter.Entity) {
+			continue
+		}
+		if filter.EntityID != nil && ev.EntityID != *filter.EntityID {
+			continue
+		}
+		if (filter.Since != nil && ev.CreatedAt.Before(*filter.Since)) || (filter.Until != nil && !ev.CreatedAt.Before(*filter.Until)) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID > events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("car not found")
+
+// ErrDuplicateVIN is returned when another live car already has the VIN being written
+var ErrDuplicateVIN = errors.New("a car with this VIN already exists")
+
+// VersionConflictError is returned when a write expected a version the car no longer has
+type VersionConflictError struct {
+	Current int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("car was modified concurrently, current version is %d", e.Current)
+}
+
+// checkVersion enforces expectedVersion against the stored car; 0 skips the check
+func checkVersion(car models.Car, expectedVersion int) error {
+	if expectedVersion != 0 && car.Version != expectedVersion {
+		return &VersionConflictError{Current: car.Version}
+	}
+	return nil
+}
+
+// StatusTransitionError is returned when a car cannot move from its status to the requested one
+type StatusTransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *StatusTransitionError) Error() string {
+	if e.From == e.To {
+		return fmt.Sprintf("car is already %s", e.To)
+	}
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("cannot change status from %s to %s", e.From, e.To)
+	}
+	return fmt.Sprintf("cannot change status from %s to %s; allowed: %s", e.From, e.To, strings.Join(e.Allowed, ", "))
+}
+
+// checkTransition enforces the status lifecycle of models.CanTransition
+func checkTransition(car models.Car, to string) error {
+	if !models.CanTransition(car.Status, to) {
+		return &StatusTransitionError{From: car.Status, To: to, Allowed: models.AllowedTransitions(car.Status)}
+	}
+	return nil
+}
+
+// CarFilter narrows a car listing. Empty strings and nil pointers mean "no constraint".
+type CarFilter struct {
+	Make       string
+	Model      string
+	Color      string
+	YearMin    *int
+	YearMax    *int
+	PriceMin   *float64
+	PriceMax   *float64
+	MileageMax *int
+	// Statuses keeps cars in any of the listed statuses
+	Statuses []string
+	// Search is free text; every term must match make, model, color, year or VIN by prefix
+	// or with a small typo. Without a Sort, a search lists the best matches first.
+	Search string
+	// Trashed selects soft-deleted cars instead of live ones
+	Trashed bool
+}
+
+// BatchError reports which car of a SaveBatch failed; nothing of the batch was written
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("car %d of the batch: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// SortKey orders a listing by one whitelisted field
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ListOptions controls filtering, ordering and paging. A zero Limit means no limit.
+// After and Before are keyset boundaries (exclusive) in the Sort order; FromEnd takes the
+// Limit rows closest to the end of the range, still returned in Sort order.
+type ListOptions struct {
+	Filter  CarFilter
+	Sort    []SortKey
+	Limit   int
+	Offset  int
+	After   *models.Car
+	Before  *models.Car
+	FromEnd bool
+}
+
+// sortColumns whitelists the fields a listing may be sorted by
+var sortColumns = map[string]string{
+	"id":      "id",
+	"make":    "make",
+	"model":   "model",
+	"year":    "year",
+	"price":   "price",
+	"color":   "color",
+	"mileage": "mileage",
+}
+
+// ParseSort parses "price,-year" into sort keys, rejecting fields outside the whitelist
+func ParseSort(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: part}
+		if strings.HasPrefix(part, "-") {
+			key = SortKey{Field: part[1:], Desc: true}
+		}
+		if _, ok := sortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q", key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// CarRepository is the storage contract shared by the REST handlers and the GraphQL resolvers
+type CarRepository interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Car, error)
+	// Each calls fn for every car List would return, stopping at the first error fn returns.
+	// Unlike List it does not hold the whole result in memory. FromEnd is not supported.
+	Each(ctx context.Context, opts ListOptions, fn func(models.Car) error) error
+	Count(ctx context.Context, filter CarFilter) (int, error)
+	Get(ctx context.Context, id int) (models.Car, error)
+	GetMany(ctx context.Context, ids []int) ([]models.Car, error)
+	// GetByVIN returns the live car with the given (normalized) VIN
+	GetByVIN(ctx context.Context, vin string) (models.Car, error)
+	Create(ctx context.Context, car models.Car) (models.Car, error)
+	// Update replaces a car and increments its version. A non-zero expectedVersion makes the
+	// write fail with *VersionConflictError unless the stored car still has that version.
+	Update(ctx context.Context, car models.Car, expectedVersion int) (models.Car, error)
+	// Delete moves a car to the trash; it disappears from every other query.
+	// expectedVersion works as in Update.
+	// Update fails with ErrCarReserved if it changes the price of a reserved car, and Delete if
+	// the car is reserved, unless ctx comes from WithReservationOverride.
+	Delete(ctx context.Context, id int, expectedVersion int) error
+	// Create, Update and Restore fail with ErrDuplicateVIN if another live car has the same VIN.
+	// SetStatus moves a car to another status, recording who did it and when. Transitions
+	// outside the lifecycle fail with *StatusTransitionError; expectedVersion works as in Update.
+	// Moving a car out of reserved ends its active hold.
+	SetStatus(ctx context.Context, id int, status string, expectedVersion int) (models.Car, error)
+	// Restore takes a car out of the trash
+	Restore(ctx context.Context, id int) (models.Car, error)
+	// Purge permanently removes a trashed car
+	Purge(ctx context.Context, id int) error
+	// PurgeTrashed permanently removes every car trashed before cutoff and returns how many
+	PurgeTrashed(ctx context.Context, cutoff time.Time) (int, error)
+	// SaveBatch creates the cars with a zero ID and updates the others, all in one transaction.
+	// If any car fails, nothing is written and the error is a *BatchError.
+	SaveBatch(ctx context.Context, cars []models.Car) ([]models.Car, error)
+	// PriceHistory returns the prices each car has had, oldest first. Creating a car and
+	// every write that changes its price add an entry.
+	PriceHistory(ctx context.Context, carIDs []int) (map[int][]models.PriceChange, error)
+	// RecentPriceDrops returns live cars now at least minPercent cheaper than before their
+	// first price change since the given time, biggest drop first
+	RecentPriceDrops(ctx context.Context, since time.Time, minPercent float64, limit int) ([]models.PriceDrop, error)
+	// Reserve holds an available car for a customer until the given time and marks it
+	// reserved. It fails with ErrCarReserved if the car is already reserved, ErrNotReservable
+	// if it is not available and ErrHoldLimit if the customer already holds maxPerUser cars.
+	Reserve(ctx context.Context, carID, userID int, until time.Time, maxPerUser int) (models.Car, error)
+	// ReleaseHold ends the car's active hold and makes it available again. A non-zero
+	// holderID only releases a hold of that customer; otherwise the error is ErrNoHold.
+	ReleaseHold(ctx context.Context, carID, holderID int) (models.Car, error)
+	// ActiveHolds returns the active hold of each given car that has one
+	ActiveHolds(ctx context.Context, carIDs []int) (map[int]models.CarHold, error)
+	// ReleaseExpiredHolds ends every hold that expired by now, makes the cars available
+	// again and returns how many holds it released
+	ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error)
+}
@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrImageNotFound is returned when the image does not exist or belongs to another car
+	ErrImageNotFound = errors.New("image not found")
+	// ErrInvalidImageOrder is returned when a reorder does not list every image of the car exactly once
+	ErrInvalidImageOrder = errors.New("image order must list every image of the car exactly once")
+)
+
+// CarImageRepository stores the photo metadata of cars; the files live in a storage.BlobStore
+type CarImageRepository interface {
+	// ListByCars returns the images of every given car, ordered by position
+	ListByCars(ctx context.Context, carIDs []int) (map[int][]models.CarImage, error)
+	// Add appends an image to its car. The first image of a car always becomes primary.
+	Add(ctx context.Context, img models.CarImage, primary bool) (models.CarImage, error)
+	// Delete removes an image and returns it; a new primary is picked if needed
+	Delete(ctx context.Context, carID, imageID int) (models.CarImage, error)
+	SetPrimary(ctx context.Context, carID, imageID int) error
+	// Reorder sets the positions of a car's images to the order of imageIDs
+	Reorder(ctx context.Context, carID int, imageIDs []int) error
+	// DeleteOrphans removes the images of purged cars and returns their blob keys
+	DeleteOrphans(ctx context.Context) ([]string, error)
+}
+
+const carImageColumns = "id, car_id, blob_key, content_type, width, height, size_bytes, position, is_primary, created_at"
+
+func scanCarImage(row scanner) (models.CarImage, error) {
+	var img models.CarImage
+	err := row.Scan(&img.ID, &img.CarID, &img.Key, &img.ContentType, &img.Width, &img.Height,
+		&img.Size, &img.Position, &img.Primary, &img.CreatedAt)
+	return img, err
+}
+
+// PostgresCarImageRepository stores image metadata in the car_images table
+type PostgresCarImageRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresCarImageRepository creates a CarImageRepository backed by the given connection pool
+func NewPostgresCarImageRepository(db *sql.DB) *PostgresCarImageRepository {
+	return &PostgresCarImageRepository{db: db}
+}
+
+func (r *PostgresCarImageRepository) ListByCars(ctx context.Context, carIDs []int) (map[int][]models.CarImage, error) {
+	ids64 := make([]int64, len(carIDs))
+	for i, id := range carIDs {
+		ids64[i] = int64(id)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+carImageColumns+" FROM car_images WHERE car_id = ANY($1) ORDER BY car_id, position, id", pq.Array(ids64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[int][]models.CarImage{}
+	for rows.Next() {
+		img, err := scanCarImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images[img.CarID] = append(images[img.CarID], img)
+	}
+	return images, rows.Err()
+}
+
+// lockCarImages locks the live car so concurrent changes to its images are serialized
+func lockCarImages(ctx context.Context, tx *sql.Tx, carID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, "SELECT id FROM cars WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", carID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresCarImageRepository) Add(ctx context.Context, img models.CarImage, primary bool) (models.CarImage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.CarImage{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCarImages(ctx, tx, img.CarID); err != nil {
+		return models.CarImage{}, err
+	}
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(MAX(position), 0) + 1 FROM car_images WHERE car_id=$1", img.CarID).
+		Scan(&count, &img.Position)
+	if err != nil {
+		return models.CarImage{}, err
+	}
+
+	img.Primary = primary || count == 0
+	if img.Primary {
+		if _, err := tx.ExecContext(ctx, "UPDATE car_images SET is_primary = FALSE WHERE car_id=$1 AND is_primary", img.CarID); err != nil {
+			return models.CarImage{}, err
+		}
+	}
+	err = tx.QueryRowContext(ctx, `INSERT INTO car_images (car_id, blob_key, content_type, width, height, size_bytes, position, is_primary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`,
+		img.CarID, img.Key, img.ContentType, img.Width, img.Height, img.Size, img.Position, img.Primary).
+		Scan(&img.ID, &img.CreatedAt)
+	if err != nil {
+		return models.CarImage{}, err
+	}
+	return img, tx.Commit()
+}
+
+func (r *PostgresCarImageRepository) Delete(ctx context.Context, carID, imageID int) (models.CarImage, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.CarImage{}, err
+	}
+	defer tx.Rollback()
+
+	img, err := scanCarImage(tx.QueryRowContext(ctx,
+		"DELETE FROM car_images WHERE id=$1 AND car_id=$2 RETURNING "+carImageColumns, imageID, carID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.CarImage{}, ErrImageNotFound
+	}
+	if err != nil {
+		return models.CarImage{}, err
+	}
+	if img.Primary {
+		_, err := tx.ExecContext(ctx, `UPDATE car_images SET is_primary = TRUE WHERE id =
+			(SELECT id FROM car_images WHERE car_id=$1 ORDER BY position, id LIMIT 1)`, carID)
+		if err != nil {
+			return models.CarImage{}, err
+		}
+	}
+	return img, tx.Commit()
+}
+
+func (r *PostgresCarImageRepository) SetPrimary(ctx context.Context, carID, imageID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCarImages(ctx, tx, carID); err != nil {
+		return err
+	}
+	// Clear first: the partial unique index is checked row by row
+	if _, err := tx.ExecContext(ctx, "UPDATE car_images SET is_primary = FALSE WHERE car_id=$1 AND is_primary", carID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE car_images SET is_primary = TRUE WHERE id=$1 AND car_id=$2", imageID, carID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrImageNotFound
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresCarImageRepository) Reorder(ctx context.Context, carID int, imageIDs []int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCarImages(ctx, tx, carID); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM car_images WHERE car_id=$1", carID)
+	if err != nil {
+		return err
+	}
+	var existing []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing = append(existing, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !sameIDs(existing, imageIDs) {
+		return ErrInvalidImageOrder
+	}
+
+	ids64 := make([]int64, len(imageIDs))
+	for i, id := range imageIDs {
+		ids64[i] = int64(id)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE car_images ci SET position = o.position
+		FROM unnest($1::int[]) WITH ORDINALITY AS o(id, position)
+		WHERE ci.id = o.id AND ci.car_id = $2`, pq.Array(ids64), carID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresCarImageRepository) DeleteOrphans(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "DELETE FROM car_images WHERE car_id IS NULL RETURNING blob_key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// sameIDs reports whether want is a permutation of have
+func sameIDs(have, want []int) bool {
+	if len(have) != len(want) {
+		return false
+	}
+	seen := map[int]bool{}
+	for _, id := range have {
+		seen[id] = true
+	}
+	for _, id := range want {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+// MemoryCarImageRepository keeps image metadata in a map, for tests and local runs without Postgres.
+// It does not check that the car exists.
+type MemoryCarImageRepository struct {
+	mu     sync.Mutex
+	images map[int][]models.CarImage
+	nextID int
+}
+
+// NewMemoryCarImageRepository creates an empty in-memory CarImageRepository
+func NewMemoryCarImageRepository() *MemoryCarImageRepository {
+	return &MemoryCarImageRepository{images: map[int][]models.CarImage{}, nextID: 1}
+}
+
+func (r *MemoryCarImageRepository) ListByCars(ctx context.Context, carIDs []int) (map[int][]models.CarImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := map[int][]models.CarImage{}
+	for _, id := range carIDs {
+		if imgs := r.images[id]; len(imgs) > 0 {
+			sorted := append([]models.CarImage(nil), imgs...)
+			sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Position < sorted[j].Position })
+			result[id] = sorted
+		}
+	}
+	return result, nil
+}
+
+func (r *MemoryCarImageRepository) Add(ctx context.Context, img models.CarImage, primary bool) (models.CarImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imgs := r.images[img.CarID]
+	img.ID = r.nextID
+	r.nextID++
+	img.Position = 1
+	for _, other := range imgs {
+		if other.Position >= img.Position {
+			img.Position = other.Position + 1
+		}
+	}
+	img.Primary = primary || len(imgs) == 0
+	if img.Primary {
+		for i := range imgs {
+			imgs[i].Primary = false
+		}
+	}
+	img.CreatedAt = time.Now()
+	r.images[img.CarID] = append(imgs, img)
+	return img, nil
+}
+
+func (r *MemoryCarImageRepository) Delete(ctx context.Context, carID, imageID int) (models.CarImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imgs := r.images[carID]
+	for i, img := range imgs {
+		if img.ID != imageID {
+			continue
+		}
+		imgs = append(imgs[:i], imgs[i+1:]...)
+		if img.Primary && len(imgs) > 0 {
+			first := 0
+			for j := range imgs {
+				if imgs[j].Position < imgs[first].Position {
+					first = j
+				}
+			}
+			imgs[first].Primary = true
+		}
+		r.images[carID] = imgs
+		return img, nil
+	}
+	return models.CarImage{}, ErrImageNotFound
+}
+
+func (r *MemoryCarImageRepository) SetPrimary(ctx context.Context, carID, imageID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imgs := r.images[carID]
+	found := false
+	for _, img := range imgs {
+		found = found || img.ID == imageID
+	}
+	if !found {
+		return ErrImageNotFound
+	}
+	for i := range imgs {
+		imgs[i].Primary = imgs[i].ID == imageID
+	}
+	return nil
+}
+
+func (r *MemoryCarImageRepository) Reorder(ctx context.Context, carID int, imageIDs []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imgs := r.images[carID]
+	existing := make([]int, len(imgs))
+	for i, img := range imgs {
+		existing[i] = img.ID
+	}
+	if !sameIDs(existing, imageIDs) {
+		return ErrInvalidImageOrder
+	}
+	position := map[int]int{}
+	for i, id := range imageIDs {
+		position[id] = i + 1
+	}
+	for i := range imgs {
+		imgs[i].Position = position[imgs[i].ID]
+	}
+	return nil
+}
+
+// DeleteOrphans is a no-op: the in-memory repository does not track purged cars
+func (r *MemoryCarImageRepository) DeleteOrphans(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"car-service/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or belongs to a different ordering
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type cursorPayload struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	ID     int               `json:"id"`
+}
+
+// FormatSort is the inverse of ParseSort
+func FormatSort(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Field
+		if k.Desc {
+			parts[i] = "-" + k.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// EncodeCursor returns an opaque keyset cursor pointing at car within the given ordering
+func EncodeCursor(car models.Car, keys []SortKey) string {
+	payload := cursorPayload{Sort: FormatSort(keys), ID: car.ID}
+	for _, k := range keys {
+		raw, _ := json.Marshal(fieldValue(car, k.Field))
+		payload.Values = append(payload.Values, raw)
+	}
+	data, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor turns a cursor back into the boundary row it was created from.
+// It fails if the cursor was issued for a different ordering.
+func DecodeCursor(cursor string, keys []SortKey) (models.Car, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.Car{}, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return models.Car{}, ErrInvalidCursor
+	}
+	if payload.Sort != FormatSort(keys) || len(payload.Values) != len(keys) {
+		return models.Car{}, ErrInvalidCursor
+	}
+
+	car := models.Car{ID: payload.ID}
+	for i, k := range keys {
+		if err := json.Unmarshal(payload.Values[i], fieldPointer(&car, k.Field)); err != nil {
+			return models.Car{}, ErrInvalidCursor
+		}
+	}
+	return car, nil
+}
+
+func fieldValue(car models.Car, field string) interface{} {
+	switch field {
+	case "make":
+		return car.Make
+	case "model":
+		return car.Model
+	case "year":
+		return car.Year
+	case "price":
+		return car.Price
+	case "color":
+		return car.Color
+	case "mileage":
+		return car.Mileage
+	}
+	return car.ID
+}
+
+func fieldPointer(car *models.Car, field string) interface{} {
+	switch field {
+	case "make":
+		return &car.Make
+	case "model":
+		return &car.Model
+	case "year":
+		return &car.Year
+	case "price":
+		return &car.Price
+	case "color":
+		return &car.Color
+	case "mileage":
+		return &car.Mileage
+	}
+	return &car.ID
+}
+
+func reverseCars(cars []models.Car) {
+	for i, j := 0, len(cars)-1; i < j; i, j = i+1, j-1 {
+		cars[i], cars[j] = cars[j], cars[i]
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"car-service/middleware"
+	"car-service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTemplateNotFound is returned when no override is stored for a document template
+var ErrTemplateNotFound = errors.New("document template not found")
+
+// DocumentTemplateRepository stores admin overrides of the built-in document templates
+type DocumentTemplateRepository interface {
+	Get(ctx context.Context, name string) (models.DocumentTemplate, error)
+	// Save inserts or replaces an override, recording the acting user from ctx
+	Save(ctx context.Context, tpl models.DocumentTemplate) (models.DocumentTemplate, error)
+	// Delete removes an override so the built-in template applies again
+	Delete(ctx context.Context, name string) error
+}
+
+// PostgresDocumentTemplateRepository stores overrides in the document_templates table
+type PostgresDocumentTemplateRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresDocumentTemplateRepository creates a DocumentTemplateRepository backed by the given connection pool
+func NewPostgresDocumentTemplateRepository(db *sql.DB) *PostgresDocumentTemplateRepository {
+	return &PostgresDocumentTemplateRepository{db: db}
+}
+
+func (r *PostgresDocumentTemplateRepository) Get(ctx context.Context, name string) (models.DocumentTemplate, error) {
+	var tpl models.DocumentTemplate
+	var updatedBy sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		"SELECT name, html, pdf, updated_at, updated_by FROM document_templates WHERE name = $1", name).
+		Scan(&tpl.Name, &tpl.HTML, &tpl.PDF, &tpl.UpdatedAt, &updatedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tpl, ErrTemplateNotFound
+	}
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		tpl.UpdatedBy = &id
+	}
+	return tpl, err
+}
+
+func (r *PostgresDocumentTemplateRepository) Save(ctx context.Context, tpl models.DocumentTemplate) (models.DocumentTemplate, error) {
+	tpl.UpdatedBy = actorID(ctx)
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO document_templates (name, html, pdf, updated_at, updated_by)
+		VALUES ($1, $2, $3, NOW(), $4)
+		ON CONFLICT (name) DO UPDATE
+		SET html = EXCLUDED.html, pdf = EXCLUDED.pdf, updated_at = EXCLUDED.updated_at, updated_by = EXCLUDED.updated_by
+		RETURNING updated_at`,
+		tpl.Name, tpl.HTML, tpl.PDF, tpl.UpdatedBy).Scan(&tpl.UpdatedAt)
+	return tpl, err
+}
+
+func (r *PostgresDocumentTemplateRepository) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM document_templates WHERE name = $1", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// actorID returns the authenticated user of ctx, if any
+func actorID(ctx context.Context) *int {
+	if userID, ok := ctx.Value(middleware.UserIDKey).(int); ok {
+		return &userID
+	}
+	return nil
+}
+
+// MemoryDocumentTemplateRepository keeps overrides in a map, for tests and local runs without Postgres
+type MemoryDocumentTemplateRepository struct {
+	mu        sync.Mutex
+	templates map[string]models.DocumentTemplate
+}
+
+// NewMemoryDocumentTemplateRepository creates an empty in-memory DocumentTemplateRepository
+func NewMemoryDocumentTemplateRepository() *MemoryDocumentTemplateRepository {
+	return &MemoryDocumentTemplateRepository{templates: map[string]models.DocumentTemplate{}}
+}
+
+func (r *MemoryDocumentTemplateRepository) Get(ctx context.Context, name string) (models.DocumentTemplate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tpl, ok := r.templates[name]
+	if !ok {
+		return tpl, ErrTemplateNotFound
+	}
+	return tpl, nil
+}
+
+func (r *MemoryDocumentTemplateRepository) Save(ctx context.Context, tpl models.DocumentTemplate) (models.DocumentTemplate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tpl.UpdatedAt = time.Now()
+	tpl.UpdatedBy = actorID(ctx)
+	r.templates[tpl.Name] = tpl
+	return tpl, nil
+}
+
+func (r *MemoryDocumentTemplateRepository) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.templates[name]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(r.templates, name)
+	return nil
+}
@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrCarReserved is returned when a reserved car is reserved again, or its price changed
+	// or the car deleted without WithReservationOverride
+	ErrCarReserved = errors.New("car is reserved")
+	// ErrNotReservable is returned when reserving a car that is not available
+	ErrNotReservable = errors.New("only available cars can be reserved")
+	// ErrHoldLimit is returned when a customer already holds as many cars as allowed
+	ErrHoldLimit = errors.New("hold limit reached")
+	// ErrNoHold is returned when releasing a car without an active hold (of that customer)
+	ErrNoHold = errors.New("car has no active hold")
+)
+
+type reservationOverrideKey struct{}
+
+// WithReservationOverride lets Update change the price of a reserved car and Delete remove one
+func WithReservationOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reservationOverrideKey{}, true)
+}
+
+// checkReserved protects reserved cars from price changes and deletion; after is nil for a delete
+func checkReserved(ctx context.Context, before models.Car, after *models.Car) error {
+	if before.Status != models.StatusReserved || ctx.Value(reservationOverrideKey{}) != nil {
+		return nil
+	}
+	if after == nil {
+		return fmt.Errorf("%w: override the reservation to delete it", ErrCarReserved)
+	}
+	if after.Price != before.Price {
+		return fmt.Errorf("%w: override the reservation to change its price", ErrCarReserved)
+	}
+	return nil
+}
+
+// checkReservable allows holds on available cars only
+func checkReservable(car models.Car) error {
+	switch car.Status {
+	case models.StatusAvailable:
+		return nil
+	case models.StatusReserved:
+		return ErrCarReserved
+	}
+	return ErrNotReservable
+}
+
+const holdColumns = "id, car_id, user_id, expires_at, created_at"
+
+// Reserve locks the customer's user row before counting their holds, so that two concurrent
+// reservations cannot both slip under the limit
+func (r *PostgresCarRepository) Reserve(ctx context.Context, carID, userID int, until time.Time, maxPerUser int) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	// 1. Enforce the per-customer limit
+	var locked int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return models.Car{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.Car{}, err
+	}
+	var held int
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM car_holds WHERE user_id = $1 AND released_at IS NULL", userID).Scan(&held)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if maxPerUser > 0 && held >= maxPerUser {
+		return models.Car{}, fmt.Errorf("%w: you can hold at most %d car(s) at a time", ErrHoldLimit, maxPerUser)
+	}
+
+	// 2. Hold the car and mark it reserved
+	before, err := lockCar(ctx, tx, carID, false)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if err := checkReservable(before); err != nil {
+		return models.Car{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO car_holds (car_id, user_id, expires_at) VALUES ($1, $2, $3)", carID, userID, until); err != nil {
+		return models.Car{}, err
+	}
+	car, err := statusTx(ctx, tx, before, models.StatusReserved, ActionCarReserve)
+	if err != nil {
+		return models.Car{}, err
+	}
+	return car, tx.Commit()
+}
+
+// releaseHoldTx ends the car's active hold, if any (and if it belongs to holderID when non-zero)
+func releaseHoldTx(ctx context.Context, tx *sql.Tx, carID, holderID int, reason string) (bool, error) {
+	result, err := tx.ExecContext(ctx,
+		"UPDATE car_holds SET released_at = NOW(), release_reason = $3 WHERE car_id = $1 AND released_at IS NULL AND ($2 = 0 OR user_id = $2)",
+		carID, holderID, reason)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresCarRepository) ReleaseHold(ctx context.Context, carID, holderID int) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockCar(ctx, tx, carID, false)
+	if err != nil {
+		return models.Car{}, err
+	}
+	released, err := releaseHoldTx(ctx, tx, carID, holderID, models.HoldReleased)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if !released {
+		return models.Car{}, ErrNoHold
+	}
+	car := before
+	if before.Status == models.StatusReserved {
+		if car, err = statusTx(ctx, tx, before, models.StatusAvailable, ActionCarRelease); err != nil {
+			return models.Car{}, err
+		}
+	}
+	return car, tx.Commit()
+}
+
+func (r *PostgresCarRepository) ActiveHolds(ctx context.Context, carIDs []int) (map[int]models.CarHold, error) {
+	ids64 := make([]int64, len(carIDs))
+	for i, id := range carIDs {
+		ids64[i] = int64(id)
+	}
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+holdColumns+" FROM car_holds WHERE car_id = ANY($1) AND released_at IS NULL", pq.Array(ids64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds := map[int]models.CarHold{}
+	for rows.Next() {
+		var h models.CarHold
+		if err := rows.Scan(&h.ID, &h.CarID, &h.UserID, &h.ExpiresAt, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		holds[h.CarID] = h
+	}
+	return holds, rows.Err()
+}
+
+// ReleaseExpiredHolds releases each car in its own transaction, locking the car before its
+// hold like every other write, so it can run on several replicas and alongside admins
+func (r *PostgresCarRepository) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT car_id FROM car_holds WHERE released_at IS NULL AND expires_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	var carIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		carIDs = append(carIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range carIDs {
+		ok, err := r.expireHold(ctx, id, now)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+func (r *PostgresCarRepository) expireHold(ctx context.Context, carID int, now time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Trashed cars are released too, so that they come back available if restored
+	before, err := scanCar(tx.QueryRowContext(ctx, "SELECT "+carColumns+" FROM cars WHERE id=$1 FOR UPDATE", carID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx,
+		"UPDATE car_holds SET released_at = NOW(), release_reason = $2 WHERE car_id = $1 AND released_at IS NULL AND expires_at <= $3",
+		carID, models.HoldExpired, now)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Released by someone else in the meantime
+		return false, nil
+	}
+	if before.Status == models.StatusReserved {
+		if _, err := statusTx(ctx, tx, before, models.StatusAvailable, ActionCarRelease); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+func (r *MemoryCarRepository) Reserve(ctx context.Context, carID, userID int, until time.Time, maxPerUser int) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := 0
+	for _, h := range r.holds {
+		if h.ReleasedAt == nil && h.UserID == userID {
+			held++
+		}
+	}
+	if maxPerUser > 0 && held >= maxPerUser {
+		return models.Car{}, fmt.Errorf("%w: you can hold at most %d car(s) at a time", ErrHoldLimit, maxPerUser)
+	}
+	before, ok := r.cars[carID]
+	if !ok || before.DeletedAt != nil {
+		return models.Car{}, ErrNotFound
+	}
+	if err := checkReservable(before); err != nil {
+		return models.Car{}, err
+	}
+	r.nextHoldID++
+	r.holds = append(r.holds, models.CarHold{ID: r.nextHoldID, CarID: carID, UserID: userID, ExpiresAt: until, CreatedAt: time.Now()})
+	return r.setStatus(ctx, before, models.StatusReserved, ActionCarReserve)
+}
+
+// releaseHold is releaseHoldTx for the in-memory repository; the caller holds r.mu
+func (r *MemoryCarRepository) releaseHold(carID, holderID int, reason string, expiredBy *time.Time) bool {
+	for i, h := range r.holds {
+		if h.ReleasedAt != nil || h.CarID != carID || (holderID != 0 && h.UserID != holderID) {
+			continue
+		}
+		if expiredBy != nil && h.ExpiresAt.After(*expiredBy) {
+			return false
+		}
+		now := time.Now()
+		r.holds[i].ReleasedAt, r.holds[i].ReleaseReason = &now, reason
+		return true
+	}
+	return false
+}
+
+func (r *MemoryCarRepository) ReleaseHold(ctx context.Context, carID, holderID int) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cars[carID]
+	if !ok || before.DeletedAt != nil {
+		return models.Car{}, ErrNotFound
+	}
+	if !r.releaseHold(carID, holderID, models.HoldReleased, nil) {
+		return models.Car{}, ErrNoHold
+	}
+	if before.Status != models.StatusReserved {
+		return before, nil
+	}
+	return r.setStatus(ctx, before, models.StatusAvailable, ActionCarRelease)
+}
+
+func (r *MemoryCarRepository) ActiveHolds(ctx context.Context, carIDs []int) (map[int]models.CarHold, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[int]bool, len(carIDs))
+	for _, id := range carIDs {
+		wanted[id] = true
+	}
+	holds := map[int]models.CarHold{}
+	for _, h := range r.holds {
+		if h.ReleasedAt == nil && wanted[h.CarID] {
+			holds[h.CarID] = h
+		}
+	}
+	return holds, nil
+}
+
+func (r *MemoryCarRepository) ReleaseExpiredHolds(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	released := 0
+	for _, h := range r.holds {
+		if h.ReleasedAt != nil || h.ExpiresAt.After(now) || !r.releaseHold(h.CarID, 0, models.HoldExpired, &now) {
+			continue
+		}
+		released++
+		if before, ok := r.cars[h.CarID]; ok && before.Status == models.StatusReserved {
+			if _, err := r.setStatus(ctx, before, models.StatusAvailable, ActionCarRelease); err != nil {
+				return released, err
+			}
+		}
+	}
+	return released, nil
+}
@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrUserNotFound is returned when no user has the given email or ID
+var ErrUserNotFound = errors.New("user not found")
+
+// CodeLimits bounds how often login codes can be requested and guessed
+type CodeLimits struct {
+	MaxAttempts    int           // failed guesses a code absorbs before it stops matching
+	MaxOutstanding int           // unused codes a user may hold at once
+	ResendCooldown time.Duration // minimum gap between two codes for the same user
+}
+
+// CodeRequestError is returned by Issue when the user must wait before requesting another code
+type CodeRequestError struct {
+	Wait   time.Duration
+	Reason string
+}
+
+func (e *CodeRequestError) Error() string {
+	return fmt.Sprintf("%s (retry in %s)", e.Reason, e.Wait.Round(time.Second))
+}
+
+// LoginCode is an unused, hashed login code
+type LoginCode struct {
+	ID        int
+	Hash      string
+	ExpiresAt time.Time
+}
+
+// LoginCodeRepository stores the hashed one-time codes of the email login
+type LoginCodeRepository interface {
+	// Issue registers the user on first use and stores a new code for them, hashed by hash.
+	// Expired codes are dropped first; the limits are checked with the user row locked.
+	Issue(ctx context.Context, email string, limits CodeLimits, expiresAt time.Time, hash func(userID int) string) (int, error)
+	// User returns the ID and role of the user with the given email
+	User(ctx context.Context, email string) (int, string, error)
+	// Codes returns the user's unused codes that have attempts left
+	Codes(ctx context.Context, userID, maxAttempts int) ([]LoginCode, error)
+	// RecordFailure counts a failed guess against every unused, unexpired code of the user
+	RecordFailure(ctx context.Context, userID int) error
+	// Consume marks a code used; false if another request consumed it first
+	Consume(ctx context.Context, codeID int) (bool, error)
+}
+
+// checkCodeLimits enforces the resend cooldown and the outstanding code limit
+func checkCodeLimits(limits CodeLimits, outstanding int, lastSent time.Time) error {
+	if !lastSent.IsZero() && time.Since(lastSent) < limits.ResendCooldown {
+		return &CodeRequestError{Wait: limits.ResendCooldown - time.Since(lastSent), Reason: "please wait before requesting another code"}
+	}
+	if outstanding >= limits.MaxOutstanding {
+		return &CodeRequestError{Wait: limits.ResendCooldown, Reason: "too many active codes, use one of the codes already sent"}
+	}
+	return nil
+}
+
+// PostgresLoginCodeRepository stores codes in the verification_codes table
+type PostgresLoginCodeRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresLoginCodeRepository creates a LoginCodeRepository backed by the given connection pool
+func NewPostgresLoginCodeRepository(db *sql.DB) *PostgresLoginCodeRepository {
+	return &PostgresLoginCodeRepository{db: db}
+}
+
+func (r *PostgresLoginCodeRepository) Issue(ctx context.Context, email string, limits CodeLimits, expiresAt time.Time, hash func(userID int) string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The upsert (default role 'user') also locks the user row, serialising concurrent requests for the same email
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO users (email) VALUES ($1) ON CONFLICT (email) DO UPDATE SET email=EXCLUDED.email RETURNING id", email).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM verification_codes WHERE user_id=$1 AND expires_at <= NOW()", userID); err != nil {
+		return 0, err
+	}
+	var outstanding int
+	var lastSent sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		"SELECT COUNT(*), MAX(created_at) FROM verification_codes WHERE user_id=$1 AND consumed_at IS NULL AND failed_attempts < $2",
+		userID, limits.MaxAttempts).Scan(&outstanding, &lastSent)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkCodeLimits(limits, outstanding, lastSent.Time); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO verification_codes (user_id, code_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hash(userID), expiresAt); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+func (r *PostgresLoginCodeRepository) User(ctx context.Context, email string) (int, string, error) {
+	var userID int
+	var role string
+	err := r.db.QueryRowContext(ctx, "SELECT id, role FROM users WHERE email=$1", email).Scan(&userID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrUserNotFound
+	}
+	return userID, role, err
+}
+
+func (r *PostgresLoginCodeRepository) Codes(ctx context.Context, userID, maxAttempts int) ([]LoginCode, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, code_hash, expires_at FROM verification_codes WHERE user_id=$1 AND consumed_at IS NULL AND failed_attempts < $2",
+		userID, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []LoginCode
+	for rows.Next() {
+		var c LoginCode
+		if err := rows.Scan(&c.ID, &c.Hash, &c.ExpiresAt); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+func (r *PostgresLoginCodeRepository) RecordFailure(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE verification_codes SET failed_attempts = failed_attempts + 1 WHERE user_id=$1 AND consumed_at IS NULL AND expires_at > NOW()", userID)
+	return err
+}
+
+func (r *PostgresLoginCodeRepository) Consume(ctx context.Context, codeID int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE verification_codes SET consumed_at = NOW() WHERE id=$1 AND consumed_at IS NULL", codeID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// MemoryLoginCodeRepository keeps users and codes in memory, for tests and local runs without Postgres.
+// New users get the role "user"; Roles overrides it by email.
+type MemoryLoginCodeRepository struct {
+	mu     sync.Mutex
+	users  map[string]int
+	codes  []*memoryCode
+	nextID int
+	Roles  map[string]string
+}
+
+type memoryCode struct {
+	LoginCode
+	userID         int
+	createdAt      time.Time
+	failedAttempts int
+	consumed       bool
+}
+
+// NewMemoryLoginCodeRepository creates an empty in-memory LoginCodeRepository
+func NewMemoryLoginCodeRepository() *MemoryLoginCodeRepository {
+	return &MemoryLoginCodeRepository{users: map[string]int{}, Roles: map[string]string{}}
+}
+
+func (r *MemoryLoginCodeRepository) Issue(ctx context.Context, email string, limits CodeLimits, expiresAt time.Time, hash func(userID int) string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.users[email]
+	if !ok {
+		userID = len(r.users) + 1
+		r.users[email] = userID
+	}
+
+	now := time.Now()
+	live := r.codes[:0]
+	outstanding, lastSent := 0, time.Time{}
+	for _, c := range r.codes {
+		if c.userID == userID && !c.ExpiresAt.After(now) {
+			continue
+		}
+		live = append(live, c)
+		if c.userID == userID && !c.consumed && c.failedAttempts < limits.MaxAttempts {
+			outstanding++
+			if c.createdAt.After(lastSent) {
+				lastSent = c.createdAt
+			}
+		}
+	}
+	r.codes = live
+	if err := checkCodeLimits(limits, outstanding, lastSent); err != nil {
+		return 0, err
+	}
+
+	r.nextID++
+	r.codes = append(r.codes, &memoryCode{
+		LoginCode: LoginCode{ID: r.nextID, Hash: hash(userID), ExpiresAt: expiresAt},
+		userID:    userID,
+		createdAt: now,
+	})
+	return userID, nil
+}
+
+func (r *MemoryLoginCodeRepository) User(ctx context.Context, email string) (int, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.users[email]
+	if !ok {
+		return 0, "", ErrUserNotFound
+	}
+	if role, ok := r.Roles[email]; ok {
+		return userID, role, nil
+	}
+	return userID, "user", nil
+}
+
+func (r *MemoryLoginCodeRepository) Codes(ctx context.Context, userID, maxAttempts int) ([]LoginCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var codes []LoginCode
+	for _, c := range r.codes {
+		if c.userID == userID && !c.consumed && c.failedAttempts < maxAttempts {
+			codes = append(codes, c.LoginCode)
+		}
+	}
+	return codes, nil
+}
+
+func (r *MemoryLoginCodeRepository) RecordFailure(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range r.codes {
+		if c.userID == userID && !c.consumed && c.ExpiresAt.After(now) {
+			c.failedAttempts++
+		}
+	}
+	return nil
+}
+
+func (r *MemoryLoginCodeRepository) Consume(ctx context.Context, codeID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.codes {
+		if c.ID == codeID && !c.consumed {
+			c.consumed = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Throttle scopes
+const (
+	ScopeVerifyEmail = "verify_email"
+	ScopeVerifyIP    = "verify_ip"
+	ScopeRequestIP   = "request_ip"
+)
+
+// LockoutPolicy decides when repeated attempts lock a key out, and for how long
+type LockoutPolicy struct {
+	Threshold int           // attempts allowed before the first lockout
+	Base      time.Duration // first lockout; doubles with every further attempt
+	Max       time.Duration // cap on a single lockout
+	Window    time.Duration // counters restart after this long without attempts
+}
+
+// LockoutDuration returns how long a key is locked after its n-th attempt (zero when not locked)
+func (p LockoutPolicy) LockoutDuration(attempts int) time.Duration {
+	if attempts < p.Threshold {
+		return 0
+	}
+	d := p.Base
+	for i := p.Threshold; i < attempts && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
+
+// LoginThrottleRepository stores attempt counters per (scope, key)
+type LoginThrottleRepository interface {
+	// LockedUntil returns the end of the current lockout, or the zero time when the key is not locked
+	LockedUntil(ctx context.Context, scope, key string) (time.Time, error)
+	// Record counts one attempt and applies the policy, returning the resulting lockout end (zero if none)
+	Record(ctx context.Context, scope, key string, policy LockoutPolicy) (time.Time, error)
+	// Reset clears the counter for a key, e.g. after a successful login
+	Reset(ctx context.Context, scope, key string) error
+}
+
+// PostgresLoginThrottleRepository persists counters in the login_throttles table,
+// so lockouts survive restarts and are shared by every replica
+type PostgresLoginThrottleRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresLoginThrottleRepository creates a LoginThrottleRepository backed by the given connection pool
+func NewPostgresLoginThrottleRepository(db *sql.DB) *PostgresLoginThrottleRepository {
+	return &PostgresLoginThrottleRepository{db: db}
+}
+
+func (r *PostgresLoginThrottleRepository) LockedUntil(ctx context.Context, scope, key string) (time.Time, error) {
+	var until sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT locked_until FROM login_throttles WHERE scope=$1 AND key=$2 AND locked_until > NOW()", scope, key).
+		Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until.Time, err
+}
+
+func (r *PostgresLoginThrottleRepository) Record(ctx context.Context, scope, key string, policy LockoutPolicy) (time.Time, error) {
+	var attempts int
+	err := r.db.QueryRowContext(ctx, `INSERT INTO login_throttles (scope, key, attempts, updated_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			attempts = CASE WHEN login_throttles.updated_at < NOW() - make_interval(secs => $3)
+				THEN 1 ELSE login_throttles.attempts + 1 END,
+			updated_at = NOW()
+		RETURNING attempts`, scope, key, policy.Window.Seconds()).Scan(&attempts)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	lockout := policy.LockoutDuration(attempts)
+	if lockout == 0 {
+		return time.Time{}, nil
+	}
+	until := time.Now().Add(lockout)
+	_, err = r.db.ExecContext(ctx, "UPDATE login_throttles SET locked_until=$3 WHERE scope=$1 AND key=$2", scope, key, until)
+	return until, err
+}
+
+func (r *PostgresLoginThrottleRepository) Reset(ctx context.Context, scope, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_throttles WHERE scope=$1 AND key=$2", scope, key)
+	return err
+}
+
+// MemoryLoginThrottleRepository keeps attempt counters in a map, for tests and local runs without Postgres
+type MemoryLoginThrottleRepository struct {
+	mu       sync.Mutex
+	counters map[[2]string]*memoryThrottle
+}
+
+type memoryThrottle struct {
+	attempts    int
+	updatedAt   time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryLoginThrottleRepository creates an empty in-memory LoginThrottleRepository
+func NewMemoryLoginThrottleRepository() *MemoryLoginThrottleRepository {
+	return &MemoryLoginThrottleRepository{counters: map[[2]string]*memoryThrottle{}}
+}
+
+func (r *MemoryLoginThrottleRepository) LockedUntil(ctx context.Context, scope, key string) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.counters[[2]string{scope, key}]; ok && c.lockedUntil.After(time.Now()) {
+		return c.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (r *MemoryLoginThrottleRepository) Record(ctx context.Context, scope, key string, policy LockoutPolicy) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	c, ok := r.counters[[2]string{scope, key}]
+	if !ok {
+		c = &memoryThrottle{}
+		r.counters[[2]string{scope, key}] = c
+	}
+	if c.updatedAt.Before(now.Add(-policy.Window)) {
+		c.attempts = 0
+	}
+	c.attempts++
+	c.updatedAt = now
+
+	lockout := policy.LockoutDuration(c.attempts)
+	if lockout == 0 {
+		return time.Time{}, nil
+	}
+	c.lockedUntil = now.Add(lockout)
+	return c.lockedUntil, nil
+}
+
+func (r *MemoryLoginThrottleRepository) Reset(ctx context.Context, scope, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.counters, [2]string{scope, key})
+	return nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, Base: time.Minute, Max: 10 * time.Minute, Window: time.Hour}
+
+	cases := map[int]time.Duration{
+		1:  0,
+		2:  0,
+		3:  time.Minute,
+		4:  2 * time.Minute,
+		5:  4 * time.Minute,
+		6:  8 * time.Minute,
+		7:  10 * time.Minute,
+		50: 10 * time.Minute,
+	}
+	for attempts, want := range cases {
+		if got := policy.LockoutDuration(attempts); got != want {
+			t.Errorf("Attempt %d: expected lockout %v, got %v", attempts, want, got)
+		}
+	}
+}
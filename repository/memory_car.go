@@ -0,0 +1,437 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCarRepository keeps cars in a map. It is meant for tests and local runs without Postgres.
+type MemoryCarRepository struct {
+	mu     sync.RWMutex
+	cars   map[int]models.Car
+	nextID int
+	// prices holds the price history by car ID
+	prices      map[int][]models.PriceChange
+	nextPriceID int64
+	// holds lists every hold, oldest first; an active hold has no ReleasedAt
+	holds      []models.CarHold
+	nextHoldID int
+	// openOrders holds the IDs of cars with an open order, maintained by MemoryOrderRepository
+	openOrders map[int]bool
+	// Audit, when set, receives an event for every change
+	Audit *MemoryAuditRepository
+}
+
+// NewMemoryCarRepository creates an empty in-memory CarRepository
+func NewMemoryCarRepository() *MemoryCarRepository {
+	return &MemoryCarRepository{cars: make(map[int]models.Car), nextID: 1, prices: make(map[int][]models.PriceChange)}
+}
+
+func (r *MemoryCarRepository) List(ctx context.Context, opts ListOptions) ([]models.Car, error) {
+	cars := []models.Car{}
+	for _, c := range r.filtered(opts.Filter) {
+		if opts.After != nil && !lessCar(*opts.After, c, opts.Sort) {
+			continue
+		}
+		if opts.Before != nil && !lessCar(c, *opts.Before, opts.Sort) {
+			continue
+		}
+		cars = append(cars, c)
+	}
+	sort.SliceStable(cars, func(i, j int) bool { return lessCar(cars[i], cars[j], opts.Sort) })
+	if terms := SearchTerms(opts.Filter.Search); len(terms) > 0 {
+		for i, c := range cars {
+			rank, _ := matchSearch(c, terms)
+			cars[i].Match = newSearchMatch(c, terms, rank)
+		}
+		if len(opts.Sort) == 0 {
+			// Best match first, ties by id as sorted above
+			sort.SliceStable(cars, func(i, j int) bool { return cars[i].Match.Rank > cars[j].Match.Rank })
+		}
+	}
+
+	if opts.FromEnd {
+		reverseCars(cars)
+	}
+	if opts.Offset > 0 {
+		if opts.Offset >= len(cars) {
+			return []models.Car{}, nil
+		}
+		cars = cars[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(cars) {
+		cars = cars[:opts.Limit]
+	}
+	if opts.FromEnd {
+		reverseCars(cars)
+	}
+	return cars, nil
+}
+
+func (r *MemoryCarRepository) Each(ctx context.Context, opts ListOptions, fn func(models.Car) error) error {
+	cars, err := r.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	for _, c := range cars {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryCarRepository) Count(ctx context.Context, filter CarFilter) (int, error) {
+	return len(r.filtered(filter)), nil
+}
+
+func (r *MemoryCarRepository) filtered(f CarFilter) []models.Car {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cars := make([]models.Car, 0, len(r.cars))
+	for _, c := range r.cars {
+		if matchesFilter(c, f) {
+			cars = append(cars, c)
+		}
+	}
+	return cars
+}
+
+func matchesFilter(c models.Car, f CarFilter) bool {
+	switch {
+	case f.Trashed != (c.DeletedAt != nil),
+		f.Make != "" && !strings.EqualFold(c.Make, f.Make),
+		f.Model != "" && !strings.EqualFold(c.Model, f.Model),
+		f.Color != "" && !strings.EqualFold(c.Color, f.Color),
+		f.YearMin != nil && c.Year < *f.YearMin,
+		f.YearMax != nil && c.Year > *f.YearMax,
+		f.PriceMin != nil && c.Price < *f.PriceMin,
+		f.PriceMax != nil && c.Price > *f.PriceMax,
+		f.MileageMax != nil && c.Mileage > *f.MileageMax,
+		len(f.Statuses) > 0 && !containsString(f.Statuses, c.Status):
+		return false
+	}
+	_, ok := matchSearch(c, SearchTerms(f.Search))
+	return ok
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lessCar mirrors the Postgres ORDER BY: each sort key in turn, then id
+func lessCar(a, b models.Car, keys []SortKey) bool {
+	for _, k := range keys {
+		cmp := compareField(a, b, k.Field)
+		if cmp == 0 {
+			continue
+		}
+		if k.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return a.ID < b.ID
+}
+
+func compareField(a, b models.Car, field string) int {
+	switch field {
+	case "make":
+		return strings.Compare(a.Make, b.Make)
+	case "model":
+		return strings.Compare(a.Model, b.Model)
+	case "color":
+		return strings.Compare(a.Color, b.Color)
+	case "year":
+		return a.Year - b.Year
+	case "mileage":
+		return a.Mileage - b.Mileage
+	case "price":
+		switch {
+		case a.Price < b.Price:
+			return -1
+		case a.Price > b.Price:
+			return 1
+		}
+		return 0
+	case "id":
+		return a.ID - b.ID
+	}
+	return 0
+}
+
+func (r *MemoryCarRepository) Get(ctx context.Context, id int) (models.Car, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.cars[id]
+	if !ok || c.DeletedAt != nil {
+		return models.Car{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (r *MemoryCarRepository) GetMany(ctx context.Context, ids []int) ([]models.Car, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cars := []models.Car{}
+	for _, id := range ids {
+		if c, ok := r.cars[id]; ok && c.DeletedAt == nil {
+			cars = append(cars, c)
+		}
+	}
+	return cars, nil
+}
+
+func (r *MemoryCarRepository) GetByVIN(ctx context.Context, vin string) (models.Car, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.cars {
+		if vin != "" && c.VIN == vin && c.DeletedAt == nil {
+			return c, nil
+		}
+	}
+	return models.Car{}, ErrNotFound
+}
+
+// checkVIN mirrors the partial unique index on cars.vin: live cars other than id must not share vin
+func (r *MemoryCarRepository) checkVIN(id int, vin string) error {
+	if vin == "" {
+		return nil
+	}
+	for _, c := range r.cars {
+		if c.ID != id && c.VIN == vin && c.DeletedAt == nil {
+			return fmt.Errorf("%w: %s", ErrDuplicateVIN, vin)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryCarRepository) Create(ctx context.Context, car models.Car) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	car, err := r.create(car)
+	if err != nil {
+		return models.Car{}, err
+	}
+	r.recordPrice(ctx, nil, car)
+	return car, r.audit(ctx, ActionCarCreate, car.ID, nil, &car)
+}
+
+func (r *MemoryCarRepository) create(car models.Car) (models.Car, error) {
+	if err := r.checkVIN(0, car.VIN); err != nil {
+		return models.Car{}, err
+	}
+	car.ID = r.nextID
+	car.Version = 1
+	if car.Status == "" {
+		car.Status = models.StatusAvailable
+	}
+	car.StatusChangedAt, car.StatusChangedBy = nil, nil
+	r.nextID++
+	r.cars[car.ID] = car
+	return car, nil
+}
+
+func (r *MemoryCarRepository) Update(ctx context.Context, car models.Car, expectedVersion int) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, car, err := r.update(ctx, car, expectedVersion)
+	if err != nil {
+		return models.Car{}, err
+	}
+	r.recordPrice(ctx, &before, car)
+	return car, r.audit(ctx, ActionCarUpdate, car.ID, &before, &car)
+}
+
+func (r *MemoryCarRepository) update(ctx context.Context, car models.Car, expectedVersion int) (before, after models.Car, err error) {
+	before, ok := r.cars[car.ID]
+	if !ok || before.DeletedAt != nil {
+		return before, models.Car{}, ErrNotFound
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return before, models.Car{}, err
+	}
+	if err := checkReserved(ctx, before, &car); err != nil {
+		return before, models.Car{}, err
+	}
+	if err := r.checkVIN(car.ID, car.VIN); err != nil {
+		return before, models.Car{}, err
+	}
+	car.Status, car.StatusChangedAt, car.StatusChangedBy = before.Status, before.StatusChangedAt, before.StatusChangedBy
+	car.Version = before.Version + 1
+	r.cars[car.ID] = car
+	return before, car, nil
+}
+
+// SaveBatch applies the cars in order and rolls the map back if one fails; audit events and
+// price history are only recorded once the whole batch succeeded
+func (r *MemoryCarRepository) SaveBatch(ctx context.Context, cars []models.Car) ([]models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot, nextID := make(map[int]models.Car, len(r.cars)), r.nextID
+	for id, c := range r.cars {
+		snapshot[id] = c
+	}
+
+	saved := make([]models.Car, len(cars))
+	befores := make([]*models.Car, len(cars))
+	for i, car := range cars {
+		var err error
+		if car.ID == 0 {
+			car, err = r.create(car)
+		} else {
+			var before models.Car
+			before, car, err = r.update(ctx, car, 0)
+			befores[i] = &before
+		}
+		if err != nil {
+			r.cars, r.nextID = snapshot, nextID
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		saved[i] = car
+	}
+
+	for i := range saved {
+		action := ActionCarCreate
+		if befores[i] != nil {
+			action = ActionCarUpdate
+		}
+		r.recordPrice(ctx, befores[i], saved[i])
+		if err := r.audit(ctx, action, saved[i].ID, befores[i], &saved[i]); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+func (r *MemoryCarRepository) Delete(ctx context.Context, id int, expectedVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cars[id]
+	if !ok || before.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return err
+	}
+	if err := checkReserved(ctx, before, nil); err != nil {
+		return err
+	}
+	now := time.Now()
+	trashed := before
+	trashed.DeletedAt = &now
+	r.cars[id] = trashed
+	return r.audit(ctx, ActionCarDelete, id, &before, nil)
+}
+
+func (r *MemoryCarRepository) SetStatus(ctx context.Context, id int, status string, expectedVersion int) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cars[id]
+	if !ok || before.DeletedAt != nil {
+		return models.Car{}, ErrNotFound
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return models.Car{}, err
+	}
+	if err := checkTransition(before, status); err != nil {
+		return models.Car{}, err
+	}
+	if before.Status == models.StatusSold && r.openOrders[id] {
+		return models.Car{}, ErrOpenOrder
+	}
+	if before.Status == models.StatusReserved {
+		r.releaseHold(id, 0, models.HoldStatusChanged, nil)
+	}
+	return r.setStatus(ctx, before, status, ActionCarStatus)
+}
+
+// setStatus is statusTx for the in-memory repository; the caller holds r.mu
+func (r *MemoryCarRepository) setStatus(ctx context.Context, before models.Car, status, action string) (models.Car, error) {
+	now := time.Now()
+	car := before
+	car.Status, car.StatusChangedAt, car.StatusChangedBy = status, &now, actorID(ctx)
+	car.Version++
+	r.cars[car.ID] = car
+	return car, r.audit(ctx, action, car.ID, &before, &car)
+}
+
+func (r *MemoryCarRepository) Restore(ctx context.Context, id int) (models.Car, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cars[id]
+	if !ok || before.DeletedAt == nil {
+		return models.Car{}, ErrNotFound
+	}
+	if err := r.checkVIN(id, before.VIN); err != nil {
+		return models.Car{}, err
+	}
+	car := before
+	car.DeletedAt = nil
+	r.cars[id] = car
+	return car, r.audit(ctx, ActionCarRestore, id, &before, &car)
+}
+
+func (r *MemoryCarRepository) Purge(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cars[id]
+	if !ok || before.DeletedAt == nil {
+		return ErrNotFound
+	}
+	delete(r.cars, id)
+	delete(r.prices, id)
+	return r.audit(ctx, ActionCarPurge, id, &before, nil)
+}
+
+func (r *MemoryCarRepository) PurgeTrashed(ctx context.Context, cutoff time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, c := range r.cars {
+		if c.DeletedAt == nil || !c.DeletedAt.Before(cutoff) {
+			continue
+		}
+		delete(r.cars, id)
+		delete(r.prices, id)
+		if err := r.audit(ctx, ActionCarPurge, id, &c, nil); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (r *MemoryCarRepository) audit(ctx context.Context, action string, id int, before, after *models.Car) error {
+	if r.Audit == nil {
+		return nil
+	}
+	ev, err := newCarAuditEvent(ctx, action, id, before, after)
+	if err != nil {
+		return err
+	}
+	r.Audit.Append(ev)
+	return nil
+}
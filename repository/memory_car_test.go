@@ -0,0 +1,385 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	repo.Audit = NewMemoryAuditRepository()
+	car, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000, Color: "Red"})
+
+	if err := repo.Delete(ctx, car.ID, 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(ctx, car.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected trashed car to be hidden from Get, got %v", err)
+	}
+	if n, _ := repo.Count(ctx, CarFilter{}); n != 0 {
+		t.Errorf("Expected no live cars, got %d", n)
+	}
+	if trashed, _ := repo.List(ctx, ListOptions{Filter: CarFilter{Trashed: true}}); len(trashed) != 1 || trashed[0].DeletedAt == nil {
+		t.Fatalf("Expected the car in the trash, got %+v", trashed)
+	}
+
+	if _, err := repo.Restore(ctx, car.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := repo.Get(ctx, car.ID); err != nil {
+		t.Errorf("Expected restored car to be visible, got %v", err)
+	}
+	if err := repo.Purge(ctx, car.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected live cars to refuse purge, got %v", err)
+	}
+
+	repo.Delete(ctx, car.ID, 0)
+	if n, _ := repo.PurgeTrashed(ctx, time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("Expected recently trashed car to be kept, purged %d", n)
+	}
+	if n, _ := repo.PurgeTrashed(ctx, time.Now().Add(time.Second)); n != 1 {
+		t.Errorf("Expected 1 purged car, got %d", n)
+	}
+
+	events, _ := repo.Audit.List(ctx, AuditFilter{}, 10, 0)
+	want := []string{ActionCarPurge, ActionCarDelete, ActionCarRestore, ActionCarDelete, ActionCarCreate}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d audit events, got %d", len(want), len(events))
+	}
+	for i, action := range want {
+		if events[i].Action != action {
+			t.Errorf("Event %d: expected %s, got %s", i, action, events[i].Action)
+		}
+	}
+}
+
+func TestUniqueVIN(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	const vin = "1HGCM82633A004352"
+	first, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2003, Price: 4000, VIN: vin})
+
+	if _, err := repo.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2003, Price: 4000, VIN: vin}); !errors.Is(err, ErrDuplicateVIN) {
+		t.Fatalf("Expected ErrDuplicateVIN, got %v", err)
+	}
+	other, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000})
+	other.VIN = vin
+	if _, err := repo.Update(ctx, other, 0); !errors.Is(err, ErrDuplicateVIN) {
+		t.Fatalf("Expected ErrDuplicateVIN on update, got %v", err)
+	}
+	if _, err := repo.Update(ctx, first, 0); err != nil {
+		t.Fatalf("A car must keep its own VIN, got %v", err)
+	}
+	if found, err := repo.GetByVIN(ctx, vin); err != nil || found.ID != first.ID {
+		t.Fatalf("Expected GetByVIN to find car %d, got %+v, %v", first.ID, found, err)
+	}
+
+	// A trashed car frees its VIN, and cannot be restored while another car holds it
+	repo.Delete(ctx, first.ID, 0)
+	if _, err := repo.Update(ctx, other, 0); err != nil {
+		t.Fatalf("Expected the VIN to be free after delete, got %v", err)
+	}
+	if _, err := repo.Restore(ctx, first.ID); !errors.Is(err, ErrDuplicateVIN) {
+		t.Fatalf("Expected ErrDuplicateVIN on restore, got %v", err)
+	}
+}
+
+func TestSaveBatchRollsBack(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	repo.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2003, Price: 5000, VIN: "1HGCM82633A004352"})
+
+	_, err := repo.SaveBatch(ctx, []models.Car{
+		{Make: "Mazda", Model: "3", Year: 2020, Price: 15000},
+		{Make: "Honda", Model: "Accord", Year: 2003, Price: 5000, VIN: "1HGCM82633A004352"},
+	})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(err, ErrDuplicateVIN) {
+		t.Fatalf("Expected a duplicate VIN at index 1, got %v", err)
+	}
+	if n, _ := repo.Count(ctx, CarFilter{}); n != 1 {
+		t.Errorf("Expected the batch to be rolled back, got %d cars", n)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	for _, c := range []models.Car{
+		{Make: "Honda", Model: "Civic", Year: 2018, Price: 15000, Color: "Red"},
+		{Make: "Honda", Model: "Civic Type R", Year: 2021, Price: 38000, Color: "Blue"},
+		{Make: "Toyota", Model: "Corolla", Year: 2021, Price: 19000, Color: "Red"},
+		{Make: "Mazda", Model: "MX-5 <RF>", Year: 2020, Price: 26000, Color: "Redwood"},
+	} {
+		repo.Create(ctx, c)
+	}
+
+	search := func(q string) []models.Car {
+		t.Helper()
+		cars, err := repo.List(ctx, ListOptions{Filter: CarFilter{Search: q}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return cars
+	}
+
+	cars := search("red civic")
+	if len(cars) != 1 || cars[0].ID != 1 {
+		t.Fatalf("Expected only the red Civic, got %+v", cars)
+	}
+	want := []models.Highlight{{Field: "model", Snippet: "<mark>Civic</mark>"}, {Field: "color", Snippet: "<mark>Red</mark>"}}
+	if got := cars[0].Match.Highlights; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Unexpected highlights %+v", got)
+	}
+
+	// A typo still matches; the exact word ranks above a prefix
+	if cars := search("Civc"); len(cars) != 2 {
+		t.Errorf("Expected both Civics for a typo, got %+v", cars)
+	}
+	if cars := search("red"); len(cars) != 3 || cars[2].Color != "Redwood" {
+		t.Errorf("Expected Redwood, a prefix match, ranked last, got %+v", cars)
+	}
+	if cars := search("rf"); len(cars) != 1 || cars[0].Match.Highlights[0].Snippet != "MX-5 &lt;<mark>RF</mark>&gt;" {
+		t.Errorf("Expected an escaped snippet, got %+v", cars)
+	}
+	if n, _ := repo.Count(ctx, CarFilter{Search: "2021 toyota"}); n != 1 {
+		t.Errorf("Expected Count to apply the search, got %d", n)
+	}
+	if cars := search("ferrari"); len(cars) != 0 {
+		t.Errorf("Expected no match, got %+v", cars)
+	}
+}
+
+func TestPriceHistoryAndDrops(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	civic, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 20000, Color: "Red"})
+	m3, _ := repo.Create(ctx, models.Car{Make: "BMW", Model: "M3", Year: 2023, Price: 70000, Color: "Black"})
+	since := time.Now()
+
+	civic.Price = 18000
+	civic, _ = repo.Update(ctx, civic, 0)
+	civic.Color = "Blue" // Not a price change
+	civic, _ = repo.Update(ctx, civic, 0)
+	civic.Price = 17000
+	repo.Update(ctx, civic, 0)
+	m3.Price = 69000
+	repo.SaveBatch(ctx, []models.Car{m3})
+
+	history, _ := repo.PriceHistory(ctx, []int{civic.ID, m3.ID, 99})
+	if got := history[civic.ID]; len(got) != 3 || got[0].OldPrice != nil || *got[1].OldPrice != 20000 || got[2].NewPrice != 17000 {
+		t.Fatalf("Unexpected Civic history %+v", got)
+	}
+	if len(history[m3.ID]) != 2 || len(history[99]) != 0 {
+		t.Errorf("Unexpected history %+v", history)
+	}
+
+	drops, _ := repo.RecentPriceDrops(ctx, since, 0, 10)
+	if len(drops) != 2 || drops[0].Car.ID != civic.ID || drops[0].PreviousPrice != 20000 || drops[0].Amount != 3000 || drops[0].Percent != 15 {
+		t.Fatalf("Expected the Civic's 15%% drop first, got %+v", drops)
+	}
+	if drops, _ := repo.RecentPriceDrops(ctx, since, 5, 10); len(drops) != 1 {
+		t.Errorf("Expected minPercent to leave out the M3, got %+v", drops)
+	}
+	if drops, _ := repo.RecentPriceDrops(ctx, time.Now(), 0, 10); len(drops) != 0 {
+		t.Errorf("Expected no drops after the last change, got %+v", drops)
+	}
+
+	repo.Delete(ctx, civic.ID, 0)
+	repo.Purge(ctx, civic.ID)
+	if history, _ := repo.PriceHistory(ctx, []int{civic.ID}); len(history) != 0 {
+		t.Errorf("Expected purging to drop the history, got %+v", history)
+	}
+}
+
+func TestStatusTransitions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	car, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 20000, Color: "Red", Status: models.StatusDraft})
+	repo.Create(ctx, models.Car{Make: "BMW", Model: "M3", Year: 2023, Price: 70000, Color: "Black"})
+
+	var transition *StatusTransitionError
+	if _, err := repo.SetStatus(ctx, car.ID, models.StatusSold, 0); !errors.As(err, &transition) ||
+		len(transition.Allowed) != 1 || transition.Allowed[0] != models.StatusAvailable {
+		t.Fatalf("Expected draft -> sold to be refused, got %v", err)
+	}
+	for _, status := range []string{models.StatusAvailable, models.StatusReserved, models.StatusSold, models.StatusAvailable} {
+		if car, err := repo.SetStatus(ctx, car.ID, status, 0); err != nil || car.Status != status || car.StatusChangedAt == nil {
+			t.Fatalf("Expected the move to %s, got %+v, %v", status, car, err)
+		}
+	}
+	if _, err := repo.SetStatus(ctx, car.ID, models.StatusAvailable, 0); !errors.As(err, &transition) {
+		t.Errorf("Expected available -> available to be refused, got %v", err)
+	}
+	if _, err := repo.SetStatus(ctx, car.ID, models.StatusReserved, 1); !errors.As(err, new(*VersionConflictError)) {
+		t.Errorf("Expected a version conflict, got %v", err)
+	}
+
+	// Other writes keep the status
+	car, _ = repo.Get(ctx, car.ID)
+	car.Status, car.Price = models.StatusSold, 19000
+	if car, _ := repo.Update(ctx, car, 0); car.Status != models.StatusAvailable {
+		t.Errorf("Expected Update to keep the status, got %q", car.Status)
+	}
+
+	if n, _ := repo.Count(ctx, CarFilter{Statuses: []string{models.StatusAvailable, models.StatusReserved}}); n != 2 {
+		t.Errorf("Expected 2 available or reserved cars, got %d", n)
+	}
+	if n, _ := repo.Count(ctx, CarFilter{Statuses: []string{models.StatusSold}}); n != 0 {
+		t.Errorf("Expected no sold cars, got %d", n)
+	}
+}
+
+func TestReservationHolds(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCarRepository()
+	civic, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 20000, Color: "Red"})
+	accord, _ := repo.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2020, Price: 24000, Color: "Blue"})
+	corolla, _ := repo.Create(ctx, models.Car{Make: "Toyota", Model: "Corolla", Year: 2021, Price: 19000, Color: "Red"})
+	now := time.Now()
+
+	car, err := repo.Reserve(ctx, civic.ID, 7, now.Add(48*time.Hour), 1)
+	if err != nil || car.Status != models.StatusReserved {
+		t.Fatalf("Expected a reserved car, got %+v, %v", car, err)
+	}
+	if _, err := repo.Reserve(ctx, civic.ID, 8, now.Add(time.Hour), 1); !errors.Is(err, ErrCarReserved) {
+		t.Errorf("Expected a second hold to be refused, got %v", err)
+	}
+	if _, err := repo.Reserve(ctx, accord.ID, 7, now.Add(time.Hour), 1); !errors.Is(err, ErrHoldLimit) {
+		t.Errorf("Expected the hold limit to apply, got %v", err)
+	}
+	holds, _ := repo.ActiveHolds(ctx, []int{civic.ID, accord.ID})
+	if len(holds) != 1 || holds[civic.ID].UserID != 7 {
+		t.Errorf("Expected one hold by user 7, got %+v", holds)
+	}
+
+	// Price changes and deletes need the override; other edits do not
+	car.Price = 18000
+	if _, err := repo.Update(ctx, car, 0); !errors.Is(err, ErrCarReserved) {
+		t.Errorf("Expected a price change to be refused, got %v", err)
+	}
+	if err := repo.Delete(ctx, civic.ID, 0); !errors.Is(err, ErrCarReserved) {
+		t.Errorf("Expected the delete to be refused, got %v", err)
+	}
+	car.Price, car.Mileage = 20000, 12000
+	if _, err := repo.Update(ctx, car, 0); err != nil {
+		t.Errorf("Expected a mileage change to be allowed, got %v", err)
+	}
+	car, _ = repo.Get(ctx, civic.ID)
+	car.Price = 18000
+	if car, err := repo.Update(WithReservationOverride(ctx), car, 0); err != nil || car.Status != models.StatusReserved {
+		t.Errorf("Expected the override to allow the price change, got %+v, %v", car, err)
+	}
+
+	// Only the holder (or anyone, for holder 0) releases
+	if _, err := repo.ReleaseHold(ctx, civic.ID, 8); !errors.Is(err, ErrNoHold) {
+		t.Errorf("Expected another customer's release to fail, got %v", err)
+	}
+	if car, err := repo.ReleaseHold(ctx, civic.ID, 7); err != nil || car.Status != models.StatusAvailable {
+		t.Errorf("Expected the car back on sale, got %+v, %v", car, err)
+	}
+
+	// Expired holds are swept
+	repo.Reserve(ctx, accord.ID, 7, now.Add(time.Hour), 1)
+	repo.Reserve(ctx, corolla.ID, 8, now.Add(3*time.Hour), 1)
+	if n, err := repo.ReleaseExpiredHolds(ctx, now.Add(2*time.Hour)); err != nil || n != 1 {
+		t.Errorf("Expected one expired hold, got %d, %v", n, err)
+	}
+	if car, _ := repo.Get(ctx, accord.ID); car.Status != models.StatusAvailable {
+		t.Errorf("Expected the expired car back on sale, got %q", car.Status)
+	}
+
+	// Selling a reserved car ends its hold
+	repo.SetStatus(ctx, corolla.ID, models.StatusSold, 0)
+	if holds, _ := repo.ActiveHolds(ctx, []int{corolla.ID}); len(holds) != 0 {
+		t.Errorf("Expected the sale to end the hold, got %+v", holds)
+	}
+	if _, err := repo.Reserve(ctx, corolla.ID, 7, now.Add(time.Hour), 1); !errors.Is(err, ErrNotReservable) {
+		t.Errorf("Expected a sold car not to be reservable, got %v", err)
+	}
+}
+
+func TestSalesOrders(t *testing.T) {
+	ctx := context.Background()
+	cars := NewMemoryCarRepository()
+	cars.Audit = NewMemoryAuditRepository()
+	civic, _ := cars.Create(ctx, models.Car{Make: "Honda", Model: "Civic", Year: 2018, Price: 20000, Color: "Red", VIN: "JH4KA7561PC008269"})
+	accord, _ := cars.Create(ctx, models.Car{Make: "Honda", Model: "Accord", Year: 2020, Price: 24000, Color: "Blue"})
+	orders := NewMemoryOrderRepository(cars, "INV-")
+	orders.Emails = map[int]string{7: "seven@example.com", 8: "eight@example.com"}
+
+	if _, err := orders.Create(ctx, models.Order{CarID: civic.ID, BuyerID: 9, Price: 19500}); !errors.Is(err, ErrBuyerNotFound) {
+		t.Errorf("Expected an unknown buyer to be refused, got %v", err)
+	}
+	if _, err := cars.Reserve(ctx, accord.ID, 7, time.Now().Add(time.Hour), 1); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	if _, err := orders.Create(ctx, models.Order{CarID: accord.ID, BuyerID: 8, Price: 23000}); !errors.Is(err, ErrCarReserved) {
+		t.Errorf("Expected a car reserved by another customer to be refused, got %v", err)
+	}
+
+	// Failed sales do not use up invoice numbers
+	order, err := orders.Create(ctx, models.Order{CarID: civic.ID, BuyerID: 8, Price: 19500, Total: 19500})
+	if err != nil || order.InvoiceNumber != "INV-000001" || order.VIN != civic.VIN || order.BuyerEmail != "eight@example.com" {
+		t.Fatalf("Unexpected order %+v, %v", order, err)
+	}
+	if car, _ := cars.Get(ctx, civic.ID); car.Status != models.StatusSold {
+		t.Errorf("Expected the car to be sold, got %s", car.Status)
+	}
+	if _, err := orders.Create(ctx, models.Order{CarID: civic.ID, BuyerID: 7, Price: 19500}); !errors.Is(err, ErrCarNotForSale) {
+		t.Errorf("Expected a sold car to be refused, got %v", err)
+	}
+	if _, err := cars.SetStatus(ctx, civic.ID, models.StatusAvailable, 0); !errors.Is(err, ErrOpenOrder) {
+		t.Errorf("Expected the open order to block the status change, got %v", err)
+	}
+
+	// The holder can buy a reserved car, which releases the hold
+	held, err := orders.Create(ctx, models.Order{CarID: accord.ID, BuyerID: 7, Price: 23000, Total: 23000})
+	if err != nil || held.InvoiceNumber != "INV-000002" {
+		t.Fatalf("Expected the holder's order to succeed, got %+v, %v", held, err)
+	}
+	if holds, _ := cars.ActiveHolds(ctx, []int{accord.ID}); len(holds) != 0 {
+		t.Errorf("Expected the hold to be released, got %+v", holds)
+	}
+
+	payment := models.Payment{OrderID: order.ID, Method: models.PaymentCard, ReceivedAt: time.Now()}
+	payment.Amount = 20000
+	if _, err := orders.RecordPayment(ctx, payment); !errors.Is(err, ErrPaymentAmount) {
+		t.Errorf("Expected an overpayment to be refused, got %v", err)
+	}
+	payment.Amount = 5000
+	if order, err = orders.RecordPayment(ctx, payment); err != nil || order.PaymentStatus != models.PaymentPartial || order.Balance() != 14500 {
+		t.Errorf("Expected a partial payment, got %+v, %v", order, err)
+	}
+	if _, err := orders.Cancel(ctx, order.ID); !errors.Is(err, ErrOrderPaid) {
+		t.Errorf("Expected a paid order to need a refund first, got %v", err)
+	}
+	payment.Amount = -5000
+	if order, err = orders.RecordPayment(ctx, payment); err != nil || order.PaymentStatus != models.PaymentRefunded || len(order.Payments) != 2 {
+		t.Errorf("Expected a refund, got %+v, %v", order, err)
+	}
+
+	if order, err = orders.Cancel(ctx, order.ID); err != nil || order.Status != models.OrderCancelled || order.InvoiceNumber != "INV-000001" {
+		t.Errorf("Unexpected cancelled order %+v, %v", order, err)
+	}
+	if car, _ := cars.Get(ctx, civic.ID); car.Status != models.StatusAvailable {
+		t.Errorf("Expected the car to be back on sale, got %s", car.Status)
+	}
+	if _, err := orders.Cancel(ctx, order.ID); !errors.Is(err, ErrOrderCancelled) {
+		t.Errorf("Expected a second cancel to fail, got %v", err)
+	}
+
+	buyer := 7
+	mine, _ := orders.List(ctx, OrderFilter{BuyerID: &buyer})
+	if len(mine) != 1 || mine[0].ID != held.ID {
+		t.Errorf("Expected buyer 7 to have one order, got %+v", mine)
+	}
+	events, _ := cars.Audit.List(ctx, AuditFilter{Entity: EntityOrder}, 10, 0)
+	if len(events) != 5 {
+		t.Errorf("Expected 5 order audit events, got %d", len(events))
+	}
+}
@@ -0,0 +1,583 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrOrderNotFound is returned when the order does not exist
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrBuyerNotFound is returned when selling to a user that does not exist
+	ErrBuyerNotFound = errors.New("buyer not found")
+	// ErrCarNotForSale is returned when selling a draft or already sold car
+	ErrCarNotForSale = errors.New("only available or reserved cars can be sold")
+	// ErrOrderCancelled is returned when paying for or cancelling a cancelled order
+	ErrOrderCancelled = errors.New("order is cancelled")
+	// ErrOrderPaid is returned when cancelling an order that still has money paid on it
+	ErrOrderPaid = errors.New("order has payments; refund them before cancelling")
+	// ErrPaymentAmount is returned for payments above the balance and refunds above the amount paid
+	ErrPaymentAmount = errors.New("invalid payment amount")
+	// ErrOpenOrder is returned when moving a sold car out of sold while its order is open
+	ErrOpenOrder = errors.New("car has an open order; cancel the order to put it back on sale")
+)
+
+// OrderFilter narrows an order listing; zero values match everything
+type OrderFilter struct {
+	BuyerID         *int
+	CarID           *int
+	Statuses        []string
+	PaymentStatuses []string
+}
+
+// OrderRepository stores sales orders and their payments. Selling a car, numbering its
+// invoice and marking the car sold happen in one transaction.
+type OrderRepository interface {
+	// Create sells order.CarID to order.BuyerID. The car must be available, or reserved by
+	// the buyer (any buyer with WithReservationOverride); it becomes sold and its hold ends.
+	// The line items must already be priced. The order gets the next invoice number.
+	Create(ctx context.Context, order models.Order) (models.Order, error)
+	Get(ctx context.Context, id int) (models.Order, error)
+	// List returns the matching orders, newest first
+	List(ctx context.Context, filter OrderFilter) ([]models.Order, error)
+	// RecordPayment adds a payment, or a refund when p.Amount is negative, to an open order
+	RecordPayment(ctx context.Context, p models.Payment) (models.Order, error)
+	// Cancel cancels an order without money paid on it and puts the car back on sale
+	Cancel(ctx context.Context, id int) (models.Order, error)
+}
+
+// checkSellable allows selling available cars, and reserved cars to their holder (holderID)
+func checkSellable(ctx context.Context, car models.Car, holderID, buyerID int) error {
+	switch car.Status {
+	case models.StatusAvailable:
+		return nil
+	case models.StatusReserved:
+		if holderID == buyerID || ctx.Value(reservationOverrideKey{}) != nil {
+			return nil
+		}
+		return fmt.Errorf("%w: override the reservation to sell it to another customer", ErrCarReserved)
+	}
+	return ErrCarNotForSale
+}
+
+// applyPayment checks p against the order and updates its amount paid and payment status
+func applyPayment(order *models.Order, p models.Payment) error {
+	if order.Status == models.OrderCancelled {
+		return ErrOrderCancelled
+	}
+	amount := models.Cents(p.Amount)
+	switch {
+	case amount == 0:
+		return fmt.Errorf("%w: the amount must not be 0", ErrPaymentAmount)
+	case amount > 0 && amount > models.Cents(order.Balance()):
+		return fmt.Errorf("%w: the balance is %.2f", ErrPaymentAmount, order.Balance())
+	case amount < 0 && -amount > models.Cents(order.AmountPaid):
+		return fmt.Errorf("%w: only %.2f has been paid", ErrPaymentAmount, order.AmountPaid)
+	}
+	refunded := amount < 0 || order.PaymentStatus == models.PaymentRefunded
+	order.AmountPaid = float64(models.Cents(order.AmountPaid)+amount) / 100
+	order.PaymentStatus = models.PaymentStatusOf(order.Total, order.AmountPaid, refunded)
+	return nil
+}
+
+func vehicle(car models.Car) string {
+	return fmt.Sprintf("%d %s %s", car.Year, car.Make, car.Model)
+}
+
+const orderColumns = `o.id, o.invoice_number, COALESCE(o.car_id, 0), o.vehicle, o.vin, o.mileage, o.buyer_id, u.email,
+	o.price, o.line_items, o.total, o.amount_paid, o.status, o.payment_status, o.due_at, o.created_at, o.created_by, o.cancelled_at`
+
+const orderFrom = " FROM orders o JOIN users u ON u.id = o.buyer_id"
+
+func scanOrder(row scanner) (models.Order, error) {
+	var o models.Order
+	var items []byte
+	var createdBy sql.NullInt64
+	var cancelledAt sql.NullTime
+	err := row.Scan(&o.ID, &o.InvoiceNumber, &o.CarID, &o.Vehicle, &o.VIN, &o.Mileage, &o.BuyerID, &o.BuyerEmail,
+		&o.Price, &items, &o.Total, &o.AmountPaid, &o.Status, &o.PaymentStatus, &o.DueAt, &o.CreatedAt, &createdBy, &cancelledAt)
+	if err != nil {
+		return o, err
+	}
+	if createdBy.Valid {
+		by := int(createdBy.Int64)
+		o.CreatedBy = &by
+	}
+	if cancelledAt.Valid {
+		o.CancelledAt = &cancelledAt.Time
+	}
+	return o, json.Unmarshal(items, &o.LineItems)
+}
+
+// PostgresOrderRepository stores orders in the orders and order_payments tables
+type PostgresOrderRepository struct {
+	db            *sql.DB
+	invoicePrefix string
+}
+
+// NewPostgresOrderRepository creates an OrderRepository numbering invoices as invoicePrefix
+// followed by the zero-padded sequence number
+func NewPostgresOrderRepository(db *sql.DB, invoicePrefix string) *PostgresOrderRepository {
+	return &PostgresOrderRepository{db: db, invoicePrefix: invoicePrefix}
+}
+
+func orderAuditTx(ctx context.Context, tx *sql.Tx, action string, before, after *models.Order) error {
+	ev, err := newOrderAuditEvent(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	return InsertAudit(ctx, tx, ev)
+}
+
+func newOrderAuditEvent(ctx context.Context, action string, before, after *models.Order) (models.AuditEvent, error) {
+	if before == nil {
+		return NewAuditEvent(ctx, action, EntityOrder, after.ID, nil, after)
+	}
+	return NewAuditEvent(ctx, action, EntityOrder, before.ID, before, after)
+}
+
+func (r *PostgresOrderRepository) Create(ctx context.Context, order models.Order) (models.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1", order.BuyerID).Scan(&order.BuyerEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, ErrBuyerNotFound
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// 1. Lock the car, then check who may buy it
+	before, err := lockCar(ctx, tx, order.CarID, false)
+	if err != nil {
+		return models.Order{}, err
+	}
+	var holderID int
+	if before.Status == models.StatusReserved {
+		err := tx.QueryRowContext(ctx,
+			"SELECT user_id FROM car_holds WHERE car_id = $1 AND released_at IS NULL", order.CarID).Scan(&holderID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return models.Order{}, err
+		}
+	}
+	if err := checkSellable(ctx, before, holderID, order.BuyerID); err != nil {
+		return models.Order{}, err
+	}
+
+	// 2. Take the next invoice number; the counter row stays locked until commit
+	var seq int
+	if err := tx.QueryRowContext(ctx,
+		"UPDATE invoice_counter SET last_number = last_number + 1 RETURNING last_number").Scan(&seq); err != nil {
+		return models.Order{}, err
+	}
+	order.InvoiceNumber = fmt.Sprintf("%s%06d", r.invoicePrefix, seq)
+	order.Vehicle, order.VIN, order.Mileage = vehicle(before), before.VIN, before.Mileage
+	order.Status, order.PaymentStatus, order.AmountPaid = models.OrderOpen, models.PaymentUnpaid, 0
+	order.CreatedBy, order.Payments = actorID(ctx), []models.Payment{}
+	if order.LineItems == nil {
+		order.LineItems = []models.LineItem{}
+	}
+	items, err := json.Marshal(order.LineItems)
+	if err != nil {
+		return models.Order{}, err
+	}
+	err = tx.QueryRowContext(ctx, `INSERT INTO orders
+		(invoice_seq, invoice_number, car_id, vehicle, vin, mileage, buyer_id, price, line_items, total, due_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created_at`,
+		seq, order.InvoiceNumber, order.CarID, order.Vehicle, order.VIN, order.Mileage, order.BuyerID,
+		order.Price, items, order.Total, order.DueAt, order.CreatedBy).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	// 3. Mark the car sold
+	if before.Status == models.StatusReserved {
+		if _, err := releaseHoldTx(ctx, tx, order.CarID, 0, models.HoldStatusChanged); err != nil {
+			return models.Order{}, err
+		}
+	}
+	if _, err := statusTx(ctx, tx, before, models.StatusSold, ActionCarStatus); err != nil {
+		return models.Order{}, err
+	}
+	if err := orderAuditTx(ctx, tx, ActionOrderCreate, nil, &order); err != nil {
+		return models.Order{}, err
+	}
+	return order, tx.Commit()
+}
+
+func (r *PostgresOrderRepository) Get(ctx context.Context, id int) (models.Order, error) {
+	return getOrder(ctx, r.db, id, false)
+}
+
+// queryer is what getOrder needs from *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getOrder reads an order with its payments; lock takes a row lock on the order for the transaction
+func getOrder(ctx context.Context, q queryer, id int, lock bool) (models.Order, error) {
+	query := "SELECT " + orderColumns + orderFrom + " WHERE o.id = $1"
+	if lock {
+		query += " FOR UPDATE OF o"
+	}
+	order, err := scanOrder(q.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+	payments, err := listPayments(ctx, q, []int{id})
+	if err != nil {
+		return models.Order{}, err
+	}
+	order.Payments = payments[id]
+	if order.Payments == nil {
+		order.Payments = []models.Payment{}
+	}
+	return order, nil
+}
+
+func listPayments(ctx context.Context, q queryer, orderIDs []int) (map[int][]models.Payment, error) {
+	ids64 := make([]int64, len(orderIDs))
+	for i, id := range orderIDs {
+		ids64[i] = int64(id)
+	}
+	rows, err := q.QueryContext(ctx, `SELECT id, order_id, amount, method, reference, received_at, recorded_by, created_at
+		FROM order_payments WHERE order_id = ANY($1) ORDER BY id`, pq.Array(ids64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := map[int][]models.Payment{}
+	for rows.Next() {
+		var p models.Payment
+		var recordedBy sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.Amount, &p.Method, &p.Reference, &p.ReceivedAt, &recordedBy, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		if recordedBy.Valid {
+			by := int(recordedBy.Int64)
+			p.RecordedBy = &by
+		}
+		payments[p.OrderID] = append(payments[p.OrderID], p)
+	}
+	return payments, rows.Err()
+}
+
+func (r *PostgresOrderRepository) List(ctx context.Context, filter OrderFilter) ([]models.Order, error) {
+	var b queryBuilder
+	if filter.BuyerID != nil {
+		b.conds = append(b.conds, "o.buyer_id = "+b.arg(*filter.BuyerID))
+	}
+	if filter.CarID != nil {
+		b.conds = append(b.conds, "o.car_id = "+b.arg(*filter.CarID))
+	}
+	if len(filter.Statuses) > 0 {
+		b.conds = append(b.conds, "o.status = ANY("+b.arg(pq.Array(filter.Statuses))+")")
+	}
+	if len(filter.PaymentStatuses) > 0 {
+		b.conds = append(b.conds, "o.payment_status = ANY("+b.arg(pq.Array(filter.PaymentStatuses))+")")
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+orderColumns+orderFrom+b.where()+" ORDER BY o.id DESC", b.args...)
+	if err != nil {
+		return nil, err
+	}
+	orders := []models.Order{}
+	var ids []int
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, o)
+		ids = append(ids, o.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	payments, err := listPayments(ctx, r.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range orders {
+		orders[i].Payments = payments[o.ID]
+		if orders[i].Payments == nil {
+			orders[i].Payments = []models.Payment{}
+		}
+	}
+	return orders, nil
+}
+
+func (r *PostgresOrderRepository) RecordPayment(ctx context.Context, p models.Payment) (models.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getOrder(ctx, tx, p.OrderID, true)
+	if err != nil {
+		return models.Order{}, err
+	}
+	order := before
+	if err := applyPayment(&order, p); err != nil {
+		return models.Order{}, err
+	}
+	p.RecordedBy = actorID(ctx)
+	err = tx.QueryRowContext(ctx, `INSERT INTO order_payments (order_id, amount, method, reference, received_at, recorded_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		p.OrderID, p.Amount, p.Method, p.Reference, p.ReceivedAt, p.RecordedBy).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET amount_paid = $1, payment_status = $2 WHERE id = $3",
+		order.AmountPaid, order.PaymentStatus, order.ID); err != nil {
+		return models.Order{}, err
+	}
+	order.Payments = append(append([]models.Payment{}, before.Payments...), p)
+	if err := orderAuditTx(ctx, tx, ActionOrderPayment, &before, &order); err != nil {
+		return models.Order{}, err
+	}
+	return order, tx.Commit()
+}
+
+// Cancel locks the car before the order, like Create
+func (r *PostgresOrderRepository) Cancel(ctx context.Context, id int) (models.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer tx.Rollback()
+
+	var carID sql.NullInt64
+	err = tx.QueryRowContext(ctx, "SELECT car_id FROM orders WHERE id = $1", id).Scan(&carID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return models.Order{}, err
+	}
+	// Trashed cars are put back on sale too, ready for a restore
+	var car models.Car
+	carFound := false
+	if carID.Valid {
+		car, err = scanCar(tx.QueryRowContext(ctx, "SELECT "+carColumns+" FROM cars WHERE id = $1 FOR UPDATE", carID.Int64))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return models.Order{}, err
+		}
+		carFound = err == nil
+	}
+
+	before, err := getOrder(ctx, tx, id, true)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if before.Status == models.OrderCancelled {
+		return models.Order{}, ErrOrderCancelled
+	}
+	if models.Cents(before.AmountPaid) > 0 {
+		return models.Order{}, ErrOrderPaid
+	}
+	order := before
+	order.Status = models.OrderCancelled
+	var cancelledAt time.Time
+	if err := tx.QueryRowContext(ctx, "UPDATE orders SET status = $1, cancelled_at = NOW() WHERE id = $2 RETURNING cancelled_at",
+		order.Status, id).Scan(&cancelledAt); err != nil {
+		return models.Order{}, err
+	}
+	order.CancelledAt = &cancelledAt
+
+	if carFound && car.Status == models.StatusSold {
+		if _, err := statusTx(ctx, tx, car, models.StatusAvailable, ActionCarStatus); err != nil {
+			return models.Order{}, err
+		}
+	}
+	if err := orderAuditTx(ctx, tx, ActionOrderCancel, &before, &order); err != nil {
+		return models.Order{}, err
+	}
+	return order, tx.Commit()
+}
+
+// MemoryOrderRepository keeps orders in a slice. It sells the cars of a MemoryCarRepository
+// and shares its lock, so a sale is as atomic as in Postgres.
+type MemoryOrderRepository struct {
+	cars          *MemoryCarRepository
+	invoicePrefix string
+	orders        []models.Order
+	lastInvoice   int
+	nextPaymentID int
+	// Emails maps buyer IDs to the addresses printed on invoices; when set, other buyers do not exist
+	Emails map[int]string
+}
+
+// NewMemoryOrderRepository creates an empty in-memory OrderRepository selling the given cars
+func NewMemoryOrderRepository(cars *MemoryCarRepository, invoicePrefix string) *MemoryOrderRepository {
+	return &MemoryOrderRepository{cars: cars, invoicePrefix: invoicePrefix}
+}
+
+// audit records an order event in the car repository's audit log; the caller holds cars.mu
+func (r *MemoryOrderRepository) audit(ctx context.Context, action string, before, after *models.Order) error {
+	if r.cars.Audit == nil {
+		return nil
+	}
+	ev, err := newOrderAuditEvent(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+	r.cars.Audit.Append(ev)
+	return nil
+}
+
+func copyOrder(o models.Order) models.Order {
+	o.LineItems = append([]models.LineItem{}, o.LineItems...)
+	o.Payments = append([]models.Payment{}, o.Payments...)
+	return o
+}
+
+func (r *MemoryOrderRepository) Create(ctx context.Context, order models.Order) (models.Order, error) {
+	r.cars.mu.Lock()
+	defer r.cars.mu.Unlock()
+
+	if r.Emails != nil {
+		email, ok := r.Emails[order.BuyerID]
+		if !ok {
+			return models.Order{}, ErrBuyerNotFound
+		}
+		order.BuyerEmail = email
+	}
+	before, ok := r.cars.cars[order.CarID]
+	if !ok || before.DeletedAt != nil {
+		return models.Order{}, ErrNotFound
+	}
+	holderID := 0
+	for _, h := range r.cars.holds {
+		if h.CarID == order.CarID && h.ReleasedAt == nil {
+			holderID = h.UserID
+		}
+	}
+	if err := checkSellable(ctx, before, holderID, order.BuyerID); err != nil {
+		return models.Order{}, err
+	}
+
+	order.ID = len(r.orders) + 1
+	order.Vehicle, order.VIN, order.Mileage = vehicle(before), before.VIN, before.Mileage
+	order.Status, order.PaymentStatus, order.AmountPaid = models.OrderOpen, models.PaymentUnpaid, 0
+	order.CreatedBy, order.CreatedAt, order.Payments = actorID(ctx), time.Now(), []models.Payment{}
+	order = copyOrder(order)
+
+	if before.Status == models.StatusReserved {
+		r.cars.releaseHold(order.CarID, 0, models.HoldStatusChanged, nil)
+	}
+	if _, err := r.cars.setStatus(ctx, before, models.StatusSold, ActionCarStatus); err != nil {
+		return models.Order{}, err
+	}
+	// The number is only taken once nothing can fail, so numbers stay gapless
+	r.lastInvoice++
+	order.InvoiceNumber = fmt.Sprintf("%s%06d", r.invoicePrefix, r.lastInvoice)
+	if r.cars.openOrders == nil {
+		r.cars.openOrders = map[int]bool{}
+	}
+	r.cars.openOrders[order.CarID] = true
+	r.orders = append(r.orders, order)
+	return copyOrder(order), r.audit(ctx, ActionOrderCreate, nil, &order)
+}
+
+func (r *MemoryOrderRepository) Get(ctx context.Context, id int) (models.Order, error) {
+	r.cars.mu.RLock()
+	defer r.cars.mu.RUnlock()
+
+	if id < 1 || id > len(r.orders) {
+		return models.Order{}, ErrOrderNotFound
+	}
+	return copyOrder(r.orders[id-1]), nil
+}
+
+func (r *MemoryOrderRepository) List(ctx context.Context, filter OrderFilter) ([]models.Order, error) {
+	r.cars.mu.RLock()
+	defer r.cars.mu.RUnlock()
+
+	orders := []models.Order{}
+	for _, o := range r.orders {
+		if filter.BuyerID != nil && o.BuyerID != *filter.BuyerID {
+			continue
+		}
+		if filter.CarID != nil && o.CarID != *filter.CarID {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !containsString(filter.Statuses, o.Status) {
+			continue
+		}
+		if len(filter.PaymentStatuses) > 0 && !containsString(filter.PaymentStatuses, o.PaymentStatus) {
+			continue
+		}
+		orders = append(orders, copyOrder(o))
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID > orders[j].ID })
+	return orders, nil
+}
+
+func (r *MemoryOrderRepository) RecordPayment(ctx context.Context, p models.Payment) (models.Order, error) {
+	r.cars.mu.Lock()
+	defer r.cars.mu.Unlock()
+
+	if p.OrderID < 1 || p.OrderID > len(r.orders) {
+		return models.Order{}, ErrOrderNotFound
+	}
+	before := copyOrder(r.orders[p.OrderID-1])
+	order := copyOrder(before)
+	if err := applyPayment(&order, p); err != nil {
+		return models.Order{}, err
+	}
+	r.nextPaymentID++
+	p.ID, p.RecordedBy, p.CreatedAt = r.nextPaymentID, actorID(ctx), time.Now()
+	order.Payments = append(order.Payments, p)
+	r.orders[p.OrderID-1] = order
+	return copyOrder(order), r.audit(ctx, ActionOrderPayment, &before, &order)
+}
+
+func (r *MemoryOrderRepository) Cancel(ctx context.Context, id int) (models.Order, error) {
+	r.cars.mu.Lock()
+	defer r.cars.mu.Unlock()
+
+	if id < 1 || id > len(r.orders) {
+		return models.Order{}, ErrOrderNotFound
+	}
+	before := copyOrder(r.orders[id-1])
+	if before.Status == models.OrderCancelled {
+		return models.Order{}, ErrOrderCancelled
+	}
+	if models.Cents(before.AmountPaid) > 0 {
+		return models.Order{}, ErrOrderPaid
+	}
+	order := copyOrder(before)
+	now := time.Now()
+	order.Status, order.CancelledAt = models.OrderCancelled, &now
+	r.orders[id-1] = order
+	delete(r.cars.openOrders, order.CarID)
+
+	if car, ok := r.cars.cars[order.CarID]; ok && car.Status == models.StatusSold {
+		if _, err := r.cars.setStatus(ctx, car, models.StatusAvailable, ActionCarStatus); err != nil {
+			return models.Order{}, err
+		}
+	}
+	return copyOrder(order), r.audit(ctx, ActionOrderCancel, &before, &order)
+}
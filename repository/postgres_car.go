@@ -0,0 +1,591 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const carColumns = "id, make, model, year, price, color, mileage, vin, status, status_changed_at, status_changed_by, version, deleted_at"
+
+// PostgresCarRepository stores cars in the Postgres cars table
+type PostgresCarRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresCarRepository creates a CarRepository backed by the given connection pool
+func NewPostgresCarRepository(db *sql.DB) *PostgresCarRepository {
+	return &PostgresCarRepository{db: db}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCar reads the carColumns of a row; extra receives any columns selected after them
+func scanCar(row scanner, extra ...interface{}) (models.Car, error) {
+	var c models.Car
+	var vin sql.NullString
+	var statusChangedAt, deletedAt sql.NullTime
+	var statusChangedBy sql.NullInt64
+	dest := []interface{}{&c.ID, &c.Make, &c.Model, &c.Year, &c.Price, &c.Color, &c.Mileage, &vin,
+		&c.Status, &statusChangedAt, &statusChangedBy, &c.Version, &deletedAt}
+	err := row.Scan(append(dest, extra...)...)
+	c.VIN = vin.String
+	if statusChangedAt.Valid {
+		c.StatusChangedAt = &statusChangedAt.Time
+	}
+	if statusChangedBy.Valid {
+		by := int(statusChangedBy.Int64)
+		c.StatusChangedBy = &by
+	}
+	if deletedAt.Valid {
+		c.DeletedAt = &deletedAt.Time
+	}
+	return c, err
+}
+
+// queryBuilder accumulates WHERE conditions and their positional arguments
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+// arg registers a value and returns its placeholder
+func (b *queryBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *queryBuilder) where() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+func (b *queryBuilder) addFilter(f CarFilter) {
+	if f.Trashed {
+		b.conds = append(b.conds, "deleted_at IS NOT NULL")
+	} else {
+		b.conds = append(b.conds, "deleted_at IS NULL")
+	}
+	if f.Make != "" {
+		b.conds = append(b.conds, "LOWER(make) = LOWER("+b.arg(f.Make)+")")
+	}
+	if f.Model != "" {
+		b.conds = append(b.conds, "LOWER(model) = LOWER("+b.arg(f.Model)+")")
+	}
+	if f.Color != "" {
+		b.conds = append(b.conds, "LOWER(color) = LOWER("+b.arg(f.Color)+")")
+	}
+	if f.YearMin != nil {
+		b.conds = append(b.conds, "year >= "+b.arg(*f.YearMin))
+	}
+	if f.YearMax != nil {
+		b.conds = append(b.conds, "year <= "+b.arg(*f.YearMax))
+	}
+	if f.PriceMin != nil {
+		b.conds = append(b.conds, "price >= "+b.arg(*f.PriceMin))
+	}
+	if f.PriceMax != nil {
+		b.conds = append(b.conds, "price <= "+b.arg(*f.PriceMax))
+	}
+	if f.MileageMax != nil {
+		b.conds = append(b.conds, "mileage <= "+b.arg(*f.MileageMax))
+	}
+	if len(f.Statuses) > 0 {
+		b.conds = append(b.conds, "status = ANY("+b.arg(pq.Array(f.Statuses))+")")
+	}
+	// Each term matches a word prefix in search_vector, or a word close to it in search_text
+	// (pg_trgm's <% uses word_similarity_threshold). Both are served by GIN indexes.
+	for _, term := range SearchTerms(f.Search) {
+		b.conds = append(b.conds, "(search_vector @@ to_tsquery('simple', "+b.arg(term+":*")+") OR "+b.arg(term)+" <% search_text)")
+	}
+}
+
+// rankExpr scores a searched row: full-text rank plus how closely the query matches
+func (b *queryBuilder) rankExpr(search string) string {
+	terms := SearchTerms(search)
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	return "(ts_rank(search_vector, to_tsquery('simple', " + b.arg(strings.Join(prefixes, " | ")) + ")) + " +
+		"word_similarity(" + b.arg(strings.Join(terms, " ")) + ", search_text))"
+}
+
+// addKeyset restricts rows to those strictly after (or before) the boundary row in the given order.
+// For keys k1, k2 it produces (k1 > v1) OR (k1 = v1 AND k2 > v2) OR (k1 = v1 AND k2 = v2 AND id > vid).
+func (b *queryBuilder) addKeyset(keys []SortKey, boundary models.Car, after bool) {
+	keys = append(append([]SortKey{}, keys...), SortKey{Field: "id"})
+	var ors []string
+	for i, k := range keys {
+		var ands []string
+		for _, prev := range keys[:i] {
+			ands = append(ands, sortColumns[prev.Field]+" = "+b.arg(fieldValue(boundary, prev.Field)))
+		}
+		op := ">"
+		if k.Desc == after {
+			op = "<"
+		}
+		ands = append(ands, sortColumns[k.Field]+" "+op+" "+b.arg(fieldValue(boundary, k.Field)))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	b.conds = append(b.conds, "("+strings.Join(ors, " OR ")+")")
+}
+
+// orderClause builds ORDER BY from whitelisted columns, always ending with id for stable paging.
+// reverse flips every direction, which is how pages are taken from the end of a range.
+func orderClause(keys []SortKey, reverse bool) string {
+	var parts []string
+	for _, k := range append(append([]SortKey{}, keys...), SortKey{Field: "id"}) {
+		col, ok := sortColumns[k.Field]
+		if !ok {
+			continue
+		}
+		if k.Desc != reverse {
+			col += " DESC"
+		}
+		parts = append(parts, col)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// isSearch reports whether a listing selects the search rank after carColumns
+func isSearch(opts ListOptions) bool {
+	return len(SearchTerms(opts.Filter.Search)) > 0
+}
+
+// scanListed reads a row of listQuery, attaching the search match when there is one
+func scanListed(row scanner, opts ListOptions) (models.Car, error) {
+	if !isSearch(opts) {
+		return scanCar(row)
+	}
+	var rank float64
+	c, err := scanCar(row, &rank)
+	c.Match = newSearchMatch(c, SearchTerms(opts.Filter.Search), rank)
+	return c, err
+}
+
+// listQuery builds the SELECT behind List and Each
+func listQuery(opts ListOptions) (string, []interface{}) {
+	b := &queryBuilder{}
+	b.addFilter(opts.Filter)
+	if opts.After != nil {
+		b.addKeyset(opts.Sort, *opts.After, true)
+	}
+	if opts.Before != nil {
+		b.addKeyset(opts.Sort, *opts.Before, false)
+	}
+
+	columns, order := carColumns, orderClause(opts.Sort, opts.FromEnd)
+	if isSearch(opts) {
+		rank := b.rankExpr(opts.Filter.Search)
+		columns += ", " + rank
+		if len(opts.Sort) == 0 {
+			order = " ORDER BY " + rank + " DESC, id"
+			if opts.FromEnd {
+				order = " ORDER BY " + rank + ", id DESC"
+			}
+		}
+	}
+	query := "SELECT " + columns + " FROM cars" + b.where() + order
+	if opts.Limit > 0 {
+		query += " LIMIT " + b.arg(opts.Limit)
+	}
+	if opts.Offset > 0 {
+		query += " OFFSET " + b.arg(opts.Offset)
+	}
+	return query, b.args
+}
+
+func (r *PostgresCarRepository) List(ctx context.Context, opts ListOptions) ([]models.Car, error) {
+	query, args := listQuery(opts)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cars := []models.Car{}
+	for rows.Next() {
+		c, err := scanListed(rows, opts)
+		if err != nil {
+			return nil, err
+		}
+		cars = append(cars, c)
+	}
+	if opts.FromEnd {
+		reverseCars(cars)
+	}
+	return cars, rows.Err()
+}
+
+// Each reads the rows one at a time from the cursor, so memory use does not grow with the table
+func (r *PostgresCarRepository) Each(ctx context.Context, opts ListOptions, fn func(models.Car) error) error {
+	if opts.FromEnd {
+		return errors.New("streaming a listing from its end is not supported")
+	}
+	query, args := listQuery(opts)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanListed(rows, opts)
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *PostgresCarRepository) Count(ctx context.Context, filter CarFilter) (int, error) {
+	b := &queryBuilder{}
+	b.addFilter(filter)
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM cars"+b.where(), b.args...).Scan(&count)
+	return count, err
+}
+
+func (r *PostgresCarRepository) Get(ctx context.Context, id int) (models.Car, error) {
+	c, err := scanCar(r.db.QueryRowContext(ctx, "SELECT "+carColumns+" FROM cars WHERE id=$1 AND deleted_at IS NULL", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Car{}, ErrNotFound
+	}
+	return c, err
+}
+
+// GetMany returns the cars matching ids in a single query. Missing IDs are skipped.
+func (r *PostgresCarRepository) GetMany(ctx context.Context, ids []int) ([]models.Car, error) {
+	ids64 := make([]int64, len(ids))
+	for i, id := range ids {
+		ids64[i] = int64(id)
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+carColumns+" FROM cars WHERE id = ANY($1) AND deleted_at IS NULL", pq.Array(ids64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cars := []models.Car{}
+	for rows.Next() {
+		c, err := scanCar(rows)
+		if err != nil {
+			return nil, err
+		}
+		cars = append(cars, c)
+	}
+	return cars, rows.Err()
+}
+
+func (r *PostgresCarRepository) GetByVIN(ctx context.Context, vin string) (models.Car, error) {
+	c, err := scanCar(r.db.QueryRowContext(ctx, "SELECT "+carColumns+" FROM cars WHERE vin=$1 AND deleted_at IS NULL", vin))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Car{}, ErrNotFound
+	}
+	return c, err
+}
+
+// duplicateVIN turns a violation of the cars_vin_key unique index into ErrDuplicateVIN
+func duplicateVIN(err error, vin string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "cars_vin_key" {
+		return fmt.Errorf("%w: %s", ErrDuplicateVIN, vin)
+	}
+	return err
+}
+
+// Create, Update, Delete, Restore and Purge write their audit event (and Create and Update
+// their price history) in the same transaction as the change, so the log can never miss a
+// change or record one that was rolled back.
+
+func (r *PostgresCarRepository) Create(ctx context.Context, car models.Car) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	car, err = createTx(ctx, tx, car)
+	if err != nil {
+		return models.Car{}, err
+	}
+	return car, tx.Commit()
+}
+
+func createTx(ctx context.Context, tx *sql.Tx, car models.Car) (models.Car, error) {
+	if car.Status == "" {
+		car.Status = models.StatusAvailable
+	}
+	car.StatusChangedAt, car.StatusChangedBy = nil, nil
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO cars (make, model, year, price, color, mileage, vin, status) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8) RETURNING id, version",
+		car.Make, car.Model, car.Year, car.Price, car.Color, car.Mileage, car.VIN, car.Status).Scan(&car.ID, &car.Version)
+	if err != nil {
+		return models.Car{}, duplicateVIN(err, car.VIN)
+	}
+	if err := auditTx(ctx, tx, ActionCarCreate, car.ID, nil, &car); err != nil {
+		return models.Car{}, err
+	}
+	if err := priceChangeTx(ctx, tx, nil, car); err != nil {
+		return models.Car{}, err
+	}
+	return car, nil
+}
+
+func (r *PostgresCarRepository) Update(ctx context.Context, car models.Car, expectedVersion int) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	car, err = updateTx(ctx, tx, car, expectedVersion)
+	if err != nil {
+		return models.Car{}, err
+	}
+	return car, tx.Commit()
+}
+
+func updateTx(ctx context.Context, tx *sql.Tx, car models.Car, expectedVersion int) (models.Car, error) {
+	before, err := lockCar(ctx, tx, car.ID, false)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return models.Car{}, err
+	}
+	if err := checkReserved(ctx, before, &car); err != nil {
+		return models.Car{}, err
+	}
+	car.Status, car.StatusChangedAt, car.StatusChangedBy = before.Status, before.StatusChangedAt, before.StatusChangedBy
+	err = tx.QueryRowContext(ctx,
+		"UPDATE cars SET make=$1, model=$2, year=$3, price=$4, color=$5, mileage=$6, vin=NULLIF($7, ''), version=version+1 WHERE id=$8 RETURNING version",
+		car.Make, car.Model, car.Year, car.Price, car.Color, car.Mileage, car.VIN, car.ID).Scan(&car.Version)
+	if err != nil {
+		return models.Car{}, duplicateVIN(err, car.VIN)
+	}
+	if err := auditTx(ctx, tx, ActionCarUpdate, car.ID, &before, &car); err != nil {
+		return models.Car{}, err
+	}
+	if err := priceChangeTx(ctx, tx, &before, car); err != nil {
+		return models.Car{}, err
+	}
+	return car, nil
+}
+
+func (r *PostgresCarRepository) Delete(ctx context.Context, id int, expectedVersion int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockCar(ctx, tx, id, false)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return err
+	}
+	if err := checkReserved(ctx, before, nil); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE cars SET deleted_at = NOW() WHERE id=$1", id); err != nil {
+		return err
+	}
+	if err := auditTx(ctx, tx, ActionCarDelete, id, &before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresCarRepository) SetStatus(ctx context.Context, id int, status string, expectedVersion int) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockCar(ctx, tx, id, false)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if err := checkVersion(before, expectedVersion); err != nil {
+		return models.Car{}, err
+	}
+	if err := checkTransition(before, status); err != nil {
+		return models.Car{}, err
+	}
+	if before.Status == models.StatusSold {
+		var open bool
+		if err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM orders WHERE car_id = $1 AND status = 'open')", id).Scan(&open); err != nil {
+			return models.Car{}, err
+		}
+		if open {
+			return models.Car{}, ErrOpenOrder
+		}
+	}
+	if before.Status == models.StatusReserved {
+		if _, err := releaseHoldTx(ctx, tx, id, 0, models.HoldStatusChanged); err != nil {
+			return models.Car{}, err
+		}
+	}
+	car, err := statusTx(ctx, tx, before, status, ActionCarStatus)
+	if err != nil {
+		return models.Car{}, err
+	}
+	return car, tx.Commit()
+}
+
+// statusTx moves a locked car to status and audits the change as action
+func statusTx(ctx context.Context, tx *sql.Tx, before models.Car, status, action string) (models.Car, error) {
+	car := before
+	car.Status, car.StatusChangedBy = status, actorID(ctx)
+	var changedAt time.Time
+	err := tx.QueryRowContext(ctx,
+		"UPDATE cars SET status=$1, status_changed_at=NOW(), status_changed_by=$2, version=version+1 WHERE id=$3 RETURNING version, status_changed_at",
+		status, car.StatusChangedBy, car.ID).Scan(&car.Version, &changedAt)
+	if err != nil {
+		return models.Car{}, err
+	}
+	car.StatusChangedAt = &changedAt
+	if err := auditTx(ctx, tx, action, car.ID, &before, &car); err != nil {
+		return models.Car{}, err
+	}
+	return car, nil
+}
+
+func (r *PostgresCarRepository) Restore(ctx context.Context, id int) (models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Car{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockCar(ctx, tx, id, true)
+	if err != nil {
+		return models.Car{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE cars SET deleted_at = NULL WHERE id=$1", id); err != nil {
+		return models.Car{}, duplicateVIN(err, before.VIN)
+	}
+	car := before
+	car.DeletedAt = nil
+	if err := auditTx(ctx, tx, ActionCarRestore, id, &before, &car); err != nil {
+		return models.Car{}, err
+	}
+	return car, tx.Commit()
+}
+
+func (r *PostgresCarRepository) Purge(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockCar(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM cars WHERE id=$1", id); err != nil {
+		return err
+	}
+	if err := auditTx(ctx, tx, ActionCarPurge, id, &before, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresCarRepository) PurgeTrashed(ctx context.Context, cutoff time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "DELETE FROM cars WHERE deleted_at < $1 RETURNING "+carColumns, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var purged []models.Car
+	for rows.Next() {
+		c, err := scanCar(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		purged = append(purged, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i := range purged {
+		if err := auditTx(ctx, tx, ActionCarPurge, purged[i].ID, &purged[i], nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(purged), tx.Commit()
+}
+
+func (r *PostgresCarRepository) SaveBatch(ctx context.Context, cars []models.Car) ([]models.Car, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	saved := make([]models.Car, len(cars))
+	for i, car := range cars {
+		if car.ID == 0 {
+			car, err = createTx(ctx, tx, car)
+		} else {
+			car, err = updateTx(ctx, tx, car, 0)
+		}
+		if err != nil {
+			return nil, &BatchError{Index: i, Err: err}
+		}
+		saved[i] = car
+	}
+	return saved, tx.Commit()
+}
+
+// lockCar reads the current state of a live (or, with trashed, a soft-deleted) car for the
+// audit log and locks it until the transaction ends
+func lockCar(ctx context.Context, tx *sql.Tx, id int, trashed bool) (models.Car, error) {
+	cond := "deleted_at IS NULL"
+	if trashed {
+		cond = "deleted_at IS NOT NULL"
+	}
+	c, err := scanCar(tx.QueryRowContext(ctx, "SELECT "+carColumns+" FROM cars WHERE id=$1 AND "+cond+" FOR UPDATE", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Car{}, ErrNotFound
+	}
+	return c, err
+}
+
+func auditTx(ctx context.Context, tx *sql.Tx, action string, id int, before, after *models.Car) error {
+	ev, err := newCarAuditEvent(ctx, action, id, before, after)
+	if err != nil {
+		return err
+	}
+	return InsertAudit(ctx, tx, ev)
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Every price a car is given, from either API or an import, is recorded by createTx/updateTx
+// (and their in-memory counterparts) in the same transaction as the change itself.
+
+// newPriceDrop works out the drop from previous to the car's current price, rounded to cents
+// and hundredths of a percent
+func newPriceDrop(car models.Car, previous float64, changedAt time.Time) models.PriceDrop {
+	amount := previous - car.Price
+	return models.PriceDrop{
+		Car:           car,
+		PreviousPrice: previous,
+		Amount:        math.Round(amount*100) / 100,
+		Percent:       math.Round(amount/previous*10000) / 100,
+		ChangedAt:     changedAt,
+	}
+}
+
+// priceChangeTx records the car's price when it differs from before; a nil before means the
+// car was just listed
+func priceChangeTx(ctx context.Context, tx *sql.Tx, before *models.Car, after models.Car) error {
+	var old *float64
+	if before != nil {
+		if before.Price == after.Price {
+			return nil
+		}
+		old = &before.Price
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO car_price_history (car_id, old_price, new_price, changed_by) VALUES ($1, $2, $3, $4)",
+		after.ID, old, after.Price, actorID(ctx))
+	return err
+}
+
+// PriceHistory returns the price changes of each car, oldest first, in a single query
+func (r *PostgresCarRepository) PriceHistory(ctx context.Context, carIDs []int) (map[int][]models.PriceChange, error) {
+	ids64 := make([]int64, len(carIDs))
+	for i, id := range carIDs {
+		ids64[i] = int64(id)
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, car_id, old_price, new_price, changed_at, changed_by FROM car_price_history
+		WHERE car_id = ANY($1) ORDER BY car_id, changed_at, id`, pq.Array(ids64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := map[int][]models.PriceChange{}
+	for rows.Next() {
+		var pc models.PriceChange
+		var old sql.NullFloat64
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&pc.ID, &pc.CarID, &old, &pc.NewPrice, &pc.ChangedAt, &changedBy); err != nil {
+			return nil, err
+		}
+		if old.Valid {
+			pc.OldPrice = &old.Float64
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			pc.ChangedBy = &id
+		}
+		history[pc.CarID] = append(history[pc.CarID], pc)
+	}
+	return history, rows.Err()
+}
+
+// RecentPriceDrops compares each live car's price with what it cost before its first price
+// change since the given time, and returns those that fell by at least minPercent, biggest
+// drop first
+func (r *PostgresCarRepository) RecentPriceDrops(ctx context.Context, since time.Time, minPercent float64, limit int) ([]models.PriceDrop, error) {
+	columns := "c." + strings.ReplaceAll(carColumns, ", ", ", c.")
+	rows, err := r.db.QueryContext(ctx, `SELECT `+columns+`, ref.old_price, last.changed_at
+		FROM cars c
+		JOIN LATERAL (
+			SELECT h.old_price FROM car_price_history h
+			WHERE h.car_id = c.id AND h.changed_at >= $1 AND h.old_price IS NOT NULL
+			ORDER BY h.changed_at, h.id LIMIT 1
+		) ref ON true
+		JOIN LATERAL (
+			SELECT MAX(h.changed_at) AS changed_at FROM car_price_history h WHERE h.car_id = c.id
+		) last ON true
+		WHERE c.deleted_at IS NULL AND c.price < ref.old_price
+			AND (ref.old_price - c.price) * 100 >= $2 * ref.old_price
+		ORDER BY (ref.old_price - c.price) / ref.old_price DESC, c.id
+		LIMIT $3`, since, minPercent, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drops := []models.PriceDrop{}
+	for rows.Next() {
+		var previous float64
+		var changedAt time.Time
+		c, err := scanCar(rows, &previous, &changedAt)
+		if err != nil {
+			return nil, err
+		}
+		drops = append(drops, newPriceDrop(c, previous, changedAt))
+	}
+	return drops, rows.Err()
+}
+
+// recordPrice is priceChangeTx for the in-memory repository; the caller holds r.mu
+func (r *MemoryCarRepository) recordPrice(ctx context.Context, before *models.Car, after models.Car) {
+	pc := models.PriceChange{CarID: after.ID, NewPrice: after.Price, ChangedAt: time.Now(), ChangedBy: actorID(ctx)}
+	if before != nil {
+		if before.Price == after.Price {
+			return
+		}
+		old := before.Price
+		pc.OldPrice = &old
+	}
+	r.nextPriceID++
+	pc.ID = r.nextPriceID
+	r.prices[after.ID] = append(r.prices[after.ID], pc)
+}
+
+func (r *MemoryCarRepository) PriceHistory(ctx context.Context, carIDs []int) (map[int][]models.PriceChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	history := map[int][]models.PriceChange{}
+	for _, id := range carIDs {
+		if changes := r.prices[id]; len(changes) > 0 {
+			history[id] = append([]models.PriceChange(nil), changes...)
+		}
+	}
+	return history, nil
+}
+
+func (r *MemoryCarRepository) RecentPriceDrops(ctx context.Context, since time.Time, minPercent float64, limit int) ([]models.PriceDrop, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	drops := []models.PriceDrop{}
+	for id, c := range r.cars {
+		changes := r.prices[id]
+		if c.DeletedAt != nil || len(changes) == 0 {
+			continue
+		}
+		for _, pc := range changes {
+			if pc.ChangedAt.Before(since) || pc.OldPrice == nil {
+				continue
+			}
+			if previous := *pc.OldPrice; c.Price < previous && (previous-c.Price)*100 >= minPercent*previous {
+				drops = append(drops, newPriceDrop(c, previous, changes[len(changes)-1].ChangedAt))
+			}
+			break
+		}
+	}
+	sort.Slice(drops, func(i, j int) bool {
+		if drops[i].Percent != drops[j].Percent {
+			return drops[i].Percent > drops[j].Percent
+		}
+		return drops[i].Car.ID < drops[j].Car.ID
+	})
+	if limit > 0 && len(drops) > limit {
+		drops = drops[:limit]
+	}
+	return drops, nil
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"car-service/models"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxSearchTerms bounds the work one query can cause
+	maxSearchTerms = 8
+	// minFuzzyTermLength is the shortest term matched with typos; shorter ones must be a prefix
+	minFuzzyTermLength = 3
+	// fuzzyThreshold is the trigram similarity a word needs to count as a typo of a term.
+	// It equals pg_trgm's default word_similarity_threshold used by the <% operator.
+	fuzzyThreshold = 0.6
+)
+
+// searchFields are the car fields a search looks at, in highlight order
+var searchFields = []string{"make", "model", "color", "year", "vin"}
+
+// SearchTerms splits a query into lower-case words of letters and digits. Punctuation is
+// dropped, so terms are safe to embed in a tsquery.
+func SearchTerms(q string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms
+}
+
+func searchValue(c models.Car, field string) string {
+	switch field {
+	case "make":
+		return c.Make
+	case "model":
+		return c.Model
+	case "color":
+		return c.Color
+	case "year":
+		return strconv.Itoa(c.Year)
+	case "vin":
+		return c.VIN
+	}
+	return ""
+}
+
+// termScore rates how well a word matches a term: 1 for the same word, 0.8 for a prefix and
+// the trigram similarity for a likely typo. Zero means no match.
+func termScore(term, word string) float64 {
+	word = strings.ToLower(word)
+	switch {
+	case word == term:
+		return 1
+	case strings.HasPrefix(word, term):
+		return 0.8
+	case len([]rune(term)) >= minFuzzyTermLength:
+		if sim := trigramSimilarity(term, word); sim >= fuzzyThreshold {
+			return sim
+		}
+	}
+	return 0
+}
+
+// trigrams returns the set of pg_trgm style trigrams of a word, padded with two leading
+// and one trailing space
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + word + " ")
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
+
+// trigramSimilarity is the share of the term's trigrams found in the word, which is what
+// pg_trgm's word_similarity measures when the best match is a whole word
+func trigramSimilarity(term, word string) float64 {
+	want, have := trigrams(term), trigrams(word)
+	shared := 0
+	for t := range want {
+		if have[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(want))
+}
+
+// searchWords splits a field value into the words termScore compares against
+func searchWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchSearch scores a car against the terms. Every term must match some word of a search
+// field; the rank is the average of the best score of each term.
+func matchSearch(c models.Car, terms []string) (float64, bool) {
+	if len(terms) == 0 {
+		return 0, true
+	}
+	total := 0.0
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range searchFields {
+			for _, word := range searchWords(searchValue(c, field)) {
+				if s := termScore(term, word); s > best {
+					best = s
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total / float64(len(terms)), true
+}
+
+// highlights wraps the words of each field that match a term in <mark></mark>
+func highlights(c models.Car, terms []string) []models.Highlight {
+	out := []models.Highlight{}
+	for _, field := range searchFields {
+		value := searchValue(c, field)
+		var b strings.Builder
+		marked := false
+		start := -1
+		flush := func(end int) {
+			word := value[start:end]
+			matched := false
+			for _, term := range terms {
+				if termScore(term, word) > 0 {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				marked = true
+				b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+			} else {
+				b.WriteString(html.EscapeString(word))
+			}
+			start = -1
+		}
+		for i, r := range value {
+			isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+			switch {
+			case isWord && start < 0:
+				start = i
+			case !isWord && start >= 0:
+				flush(i)
+			}
+			if !isWord {
+				b.WriteString(html.EscapeString(string(r)))
+			}
+		}
+		if start >= 0 {
+			flush(len(value))
+		}
+		if marked {
+			out = append(out, models.Highlight{Field: field, Snippet: b.String()})
+		}
+	}
+	return out
+}
+
+// newSearchMatch builds the Match of a car returned by a search
+func newSearchMatch(c models.Car, terms []string, rank float64) *models.SearchMatch {
+	return &models.SearchMatch{Rank: rank, Highlights: highlights(c, terms)}
+}
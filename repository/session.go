@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned for unknown or expired refresh tokens
+	ErrTokenInvalid = errors.New("invalid or expired refresh token")
+	// ErrTokenReused is returned when an already-rotated token is presented again;
+	// the whole token family has been revoked by the time it is returned.
+	ErrTokenReused = errors.New("refresh token reuse detected, session revoked")
+)
+
+// Session identifies the user a refresh token belongs to
+type Session struct {
+	UserID int
+	Role   string
+}
+
+// SessionRepository stores hashed, rotating refresh tokens grouped into families (one per login)
+type SessionRepository interface {
+	// Create starts a new token family for the user
+	Create(ctx context.Context, userID int, familyID, tokenHash string, expiresAt time.Time) error
+	// Rotate revokes the presented token and stores its successor in the same family
+	Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error)
+	// RevokeFamily revokes every token in the presented token's family
+	RevokeFamily(ctx context.Context, tokenHash string) error
+}
+
+// PostgresSessionRepository stores refresh tokens in the refresh_tokens table
+type PostgresSessionRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresSessionRepository creates a SessionRepository backed by the given connection pool
+func NewPostgresSessionRepository(db *sql.DB) *PostgresSessionRepository {
+	return &PostgresSessionRepository{db: db}
+}
+
+func (r *PostgresSessionRepository) Create(ctx context.Context, userID int, familyID, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, familyID, tokenHash, expiresAt)
+	return err
+}
+
+func (r *PostgresSessionRepository) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the row so two concurrent refreshes with the same token cannot both succeed
+	var id int
+	var familyID string
+	var tokenExpiry time.Time
+	var revokedAt sql.NullTime
+	var s Session
+	err = tx.QueryRowContext(ctx, `SELECT rt.id, rt.family_id, rt.expires_at, rt.revoked_at, u.id, u.role
+		FROM refresh_tokens rt JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1 FOR UPDATE OF rt`, oldHash).
+		Scan(&id, &familyID, &tokenExpiry, &revokedAt, &s.UserID, &s.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrTokenInvalid
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if revokedAt.Valid {
+		// A rotated token came back: assume it was stolen and end the whole session
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL", familyID); err != nil {
+			return Session{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Session{}, err
+		}
+		return Session{}, ErrTokenReused
+	}
+	if time.Now().After(tokenExpiry) {
+		return Session{}, ErrTokenInvalid
+	}
+
+	var newID int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		s.UserID, familyID, newHash, expiresAt).Scan(&newID)
+	if err != nil {
+		return Session{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2", newID, id); err != nil {
+		return Session{}, err
+	}
+	return s, tx.Commit()
+}
+
+func (r *PostgresSessionRepository) RevokeFamily(ctx context.Context, tokenHash string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE revoked_at IS NULL AND family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)`, tokenHash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+// MemorySessionRepository keeps refresh tokens in a map. Roles are looked up through RoleOf.
+type MemorySessionRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*memoryToken
+	RoleOf func(userID int) string
+}
+
+type memoryToken struct {
+	userID    int
+	familyID  string
+	expiresAt time.Time
+	revoked   bool
+}
+
+// NewMemorySessionRepository creates an empty in-memory SessionRepository
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{
+		tokens: map[string]*memoryToken{},
+		RoleOf: func(int) string { return "user" },
+	}
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, userID int, familyID, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[tokenHash] = &memoryToken{userID: userID, familyID: familyID, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *MemorySessionRepository) Rotate(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[oldHash]
+	if !ok {
+		return Session{}, ErrTokenInvalid
+	}
+	if t.revoked {
+		r.revokeFamily(t.familyID)
+		return Session{}, ErrTokenReused
+	}
+	if time.Now().After(t.expiresAt) {
+		return Session{}, ErrTokenInvalid
+	}
+
+	t.revoked = true
+	r.tokens[newHash] = &memoryToken{userID: t.userID, familyID: t.familyID, expiresAt: expiresAt}
+	return Session{UserID: t.userID, Role: r.RoleOf(t.userID)}, nil
+}
+
+func (r *MemorySessionRepository) RevokeFamily(ctx context.Context, tokenHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[tokenHash]
+	if !ok || !r.revokeFamily(t.familyID) {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) revokeFamily(familyID string) bool {
+	revoked := false
+	for _, t := range r.tokens {
+		if t.familyID == familyID && !t.revoked {
+			t.revoked = true
+			revoked = true
+		}
+	}
+	return revoked
+}
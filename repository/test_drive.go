@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"car-service/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrTestDriveNotFound is returned when the booking does not exist
+	ErrTestDriveNotFound = errors.New("test drive not found")
+	// ErrSlotTaken is returned when the car is already booked for part of the requested time
+	ErrSlotTaken = errors.New("the car is already booked at that time")
+	// ErrDoubleBooked is returned when the customer already has a test drive at that time
+	ErrDoubleBooked = errors.New("you already have a test drive at that time")
+	// ErrTestDriveStatus is returned when a booking cannot move to the requested status,
+	// e.g. confirming a cancelled booking
+	ErrTestDriveStatus = errors.New("test drive cannot change to that status")
+)
+
+// TestDriveFilter narrows a booking listing; zero values match everything
+type TestDriveFilter struct {
+	CarID    *int
+	UserID   *int
+	Statuses []string
+	// Bookings overlapping [From, To) are returned
+	From *time.Time
+	To   *time.Time
+}
+
+// TestDriveRepository stores test drive bookings. Overlapping live bookings of one car, or
+// of one customer, are rejected by the store itself so that concurrent requests cannot both win.
+type TestDriveRepository interface {
+	// Create books the slot; it returns ErrSlotTaken or ErrDoubleBooked on overlaps
+	Create(ctx context.Context, td models.TestDrive) (models.TestDrive, error)
+	Get(ctx context.Context, id int) (models.TestDrive, error)
+	// List returns the matching bookings by start time
+	List(ctx context.Context, filter TestDriveFilter) ([]models.TestDrive, error)
+	// SetStatus moves a booking to status, or returns ErrTestDriveStatus if its current status does not allow it
+	SetStatus(ctx context.Context, id int, status string) (models.TestDrive, error)
+}
+
+const testDriveColumns = "b.id, b.car_id, b.user_id, u.email, lower(b.slot), upper(b.slot), b.status, b.created_at, b.updated_at"
+
+func scanTestDrive(row scanner) (models.TestDrive, error) {
+	var td models.TestDrive
+	err := row.Scan(&td.ID, &td.CarID, &td.UserID, &td.UserEmail, &td.Start, &td.End, &td.Status, &td.CreatedAt, &td.UpdatedAt)
+	return td, err
+}
+
+// PostgresTestDriveRepository stores bookings in the test_drive_bookings table
+type PostgresTestDriveRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresTestDriveRepository creates a TestDriveRepository backed by the given connection pool
+func NewPostgresTestDriveRepository(db *sql.DB) *PostgresTestDriveRepository {
+	return &PostgresTestDriveRepository{db: db}
+}
+
+// overlapError turns a violation of the exclusion constraints into ErrSlotTaken or ErrDoubleBooked
+func overlapError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23P01" {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "test_drive_bookings_car_overlap":
+		return ErrSlotTaken
+	case "test_drive_bookings_user_overlap":
+		return ErrDoubleBooked
+	}
+	return err
+}
+
+func (r *PostgresTestDriveRepository) Create(ctx context.Context, td models.TestDrive) (models.TestDrive, error) {
+	row := r.db.QueryRowContext(ctx, `WITH b AS (
+			INSERT INTO test_drive_bookings (car_id, user_id, slot) VALUES ($1, $2, tstzrange($3, $4, '[)'))
+			RETURNING *
+		)
+		SELECT `+testDriveColumns+` FROM b JOIN users u ON u.id = b.user_id`,
+		td.CarID, td.UserID, td.Start, td.End)
+	created, err := scanTestDrive(row)
+	if err != nil {
+		return models.TestDrive{}, overlapError(err)
+	}
+	return created, nil
+}
+
+func (r *PostgresTestDriveRepository) Get(ctx context.Context, id int) (models.TestDrive, error) {
+	td, err := scanTestDrive(r.db.QueryRowContext(ctx,
+		"SELECT "+testDriveColumns+" FROM test_drive_bookings b JOIN users u ON u.id = b.user_id WHERE b.id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.TestDrive{}, ErrTestDriveNotFound
+	}
+	return td, err
+}
+
+func (r *PostgresTestDriveRepository) List(ctx context.Context, filter TestDriveFilter) ([]models.TestDrive, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.CarID != nil {
+		add("b.car_id = $%d", *filter.CarID)
+	}
+	if filter.UserID != nil {
+		add("b.user_id = $%d", *filter.UserID)
+	}
+	if len(filter.Statuses) > 0 {
+		add("b.status = ANY($%d)", pq.Array(filter.Statuses))
+	}
+	if filter.From != nil {
+		add("upper(b.slot) > $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("lower(b.slot) < $%d", *filter.To)
+	}
+
+	query := "SELECT " + testDriveColumns + " FROM test_drive_bookings b JOIN users u ON u.id = b.user_id"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	rows, err := r.db.QueryContext(ctx, query+" ORDER BY lower(b.slot), b.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drives := []models.TestDrive{}
+	for rows.Next() {
+		td, err := scanTestDrive(rows)
+		if err != nil {
+			return nil, err
+		}
+		drives = append(drives, td)
+	}
+	return drives, rows.Err()
+}
+
+func (r *PostgresTestDriveRepository) SetStatus(ctx context.Context, id int, status string) (models.TestDrive, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE test_drive_bookings SET status = $2, updated_at = NOW() WHERE id = $1 AND status = ANY($3)",
+		id, status, pq.Array(models.TestDriveSources(status)))
+	if err != nil {
+		return models.TestDrive{}, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Either the booking is missing or its status does not allow the change
+		if _, err := r.Get(ctx, id); err != nil {
+			return models.TestDrive{}, err
+		}
+		return models.TestDrive{}, ErrTestDriveStatus
+	}
+	return r.Get(ctx, id)
+}
+
+// MemoryTestDriveRepository keeps bookings in a map. It is meant for tests and local runs without Postgres.
+type MemoryTestDriveRepository struct {
+	mu     sync.Mutex
+	drives map[int]models.TestDrive
+	nextID int
+	// Emails stands in for the users table when filling in TestDrive.UserEmail
+	Emails map[int]string
+}
+
+// NewMemoryTestDriveRepository creates an empty in-memory TestDriveRepository
+func NewMemoryTestDriveRepository() *MemoryTestDriveRepository {
+	return &MemoryTestDriveRepository{drives: make(map[int]models.TestDrive), nextID: 1, Emails: make(map[int]string)}
+}
+
+func (r *MemoryTestDriveRepository) Create(ctx context.Context, td models.TestDrive) (models.TestDrive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.drives {
+		if other.Status == models.TestDriveCancelled || !other.Start.Before(td.End) || !td.Start.Before(other.End) {
+			continue
+		}
+		if other.CarID == td.CarID {
+			return models.TestDrive{}, ErrSlotTaken
+		}
+		if other.UserID == td.UserID {
+			return models.TestDrive{}, ErrDoubleBooked
+		}
+	}
+
+	now := time.Now()
+	td.ID = r.nextID
+	td.Status = models.TestDrivePending
+	td.CreatedAt, td.UpdatedAt = now, now
+	r.nextID++
+	r.drives[td.ID] = td
+	return r.withEmail(td), nil
+}
+
+func (r *MemoryTestDriveRepository) withEmail(td models.TestDrive) models.TestDrive {
+	td.UserEmail = r.Emails[td.UserID]
+	return td
+}
+
+func (r *MemoryTestDriveRepository) Get(ctx context.Context, id int) (models.TestDrive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	td, ok := r.drives[id]
+	if !ok {
+		return models.TestDrive{}, ErrTestDriveNotFound
+	}
+	return r.withEmail(td), nil
+}
+
+func (r *MemoryTestDriveRepository) List(ctx context.Context, filter TestDriveFilter) ([]models.TestDrive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	drives := []models.TestDrive{}
+	for _, td := range r.drives {
+		switch {
+		case filter.CarID != nil && td.CarID != *filter.CarID,
+			filter.UserID != nil && td.UserID != *filter.UserID,
+			len(filter.Statuses) > 0 && !containsString(filter.Statuses, td.Status),
+			filter.From != nil && !td.End.After(*filter.From),
+			filter.To != nil && !td.Start.Before(*filter.To):
+			continue
+		}
+		drives = append(drives, r.withEmail(td))
+	}
+	sort.Slice(drives, func(i, j int) bool {
+		if !drives[i].Start.Equal(drives[j].Start) {
+			return drives[i].Start.Before(drives[j].Start)
+		}
+		return drives[i].ID < drives[j].ID
+	})
+	return drives, nil
+}
+
+func (r *MemoryTestDriveRepository) SetStatus(ctx context.Context, id int, status string) (models.TestDrive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	td, ok := r.drives[id]
+	if !ok {
+		return models.TestDrive{}, ErrTestDriveNotFound
+	}
+	if !containsString(models.TestDriveSources(status), td.Status) {
+		return models.TestDrive{}, ErrTestDriveStatus
+	}
+	td.Status = status
+	td.UpdatedAt = time.Now()
+	r.drives[id] = td
+	return r.withEmail(td), nil
+}
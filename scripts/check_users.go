@@ -1,13 +1,21 @@
+//go:build ignore
+
 package main
 
 import (
+	"car-service/config"
 	"car-service/db"
 	"fmt"
 	"log"
 )
 
 func main() {
-	_, err := db.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	_, err = db.InitDB(cfg.DB)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -1,7 +1,14 @@
+//go:build ignore
+
 package main
 
 import (
+	"car-service/config"
 	"car-service/db"
+	"car-service/repository"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,21 +23,55 @@ func main() {
 	email := os.Args[1]
 
 	// Initialize DB connection
-	_, err := db.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	_, err = db.InitDB(cfg.DB)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	// Update user role to admin
-	res, err := db.DB.Exec("UPDATE users SET role='admin' WHERE email=$1", email)
+	// Update user role to admin, recording the change in the audit log in the same transaction
+	ctx := context.Background()
+	tx, err := db.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Fatalf("Failed to update user role: %v", err)
+		log.Fatalf("Failed to start transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
+	var userID int
+	var role string
+	err = tx.QueryRowContext(ctx, "SELECT id, role FROM users WHERE email=$1 FOR UPDATE", email).Scan(&userID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
 		fmt.Printf("User with email '%s' not found.\n", email)
-	} else {
-		fmt.Printf("Successfully promoted '%s' to ADMIN.\n", email)
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to look up user: %v", err)
+	}
+	if role == "admin" {
+		fmt.Printf("'%s' is already an ADMIN.\n", email)
+		return
 	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET role='admin' WHERE id=$1", userID); err != nil {
+		log.Fatalf("Failed to update user role: %v", err)
+	}
+
+	ev, err := repository.NewAuditEvent(ctx, repository.ActionRoleChange, repository.EntityUser, userID,
+		map[string]string{"role": role}, map[string]string{"role": "admin"})
+	if err != nil {
+		log.Fatalf("Failed to build audit event: %v", err)
+	}
+	ev.RequestID = "script:make_admin" // No HTTP request or actor: the change came from the CLI
+	if err := repository.InsertAudit(ctx, tx, ev); err != nil {
+		log.Fatalf("Failed to write audit event: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to update user role: %v", err)
+	}
+
+	fmt.Printf("Successfully promoted '%s' to ADMIN.\n", email)
 }
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"car-service/models"
+	"car-service/repository"
+	"car-service/utils"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registered for image.DecodeConfig
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+)
+
+var (
+	// ErrUnsupportedImage is returned for uploads that are not JPEG, PNG or GIF
+	ErrUnsupportedImage = errors.New("unsupported image type, use JPEG, PNG or GIF")
+	// ErrImageTooLarge is returned for uploads over the configured size limit
+	ErrImageTooLarge = errors.New("image is too large")
+	// ErrInvalidImage is returned when the file claims to be an image but cannot be decoded
+	ErrInvalidImage = errors.New("image could not be decoded")
+)
+
+// imageExtensions lists the accepted content types, detected from the file itself
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageService validates car photos, stores the files in a BlobStore and their metadata in a
+// CarImageRepository. Both the REST handlers and the GraphQL resolvers go through it.
+type ImageService struct {
+	Store   BlobStore
+	Images  repository.CarImageRepository
+	Cars    repository.CarRepository
+	MaxSize int64
+}
+
+// NewImageService creates an ImageService accepting images of up to maxSize bytes
+func NewImageService(store BlobStore, images repository.CarImageRepository, cars repository.CarRepository, maxSize int64) *ImageService {
+	return &ImageService{Store: store, Images: images, Cars: cars, MaxSize: maxSize}
+}
+
+// Upload validates and stores a photo of a live car
+func (s *ImageService) Upload(ctx context.Context, carID int, r io.Reader, primary bool) (models.CarImage, error) {
+	// 1. The car must exist (and not be trashed)
+	if _, err := s.Cars.Get(ctx, carID); err != nil {
+		return models.CarImage{}, err
+	}
+
+	// 2. Read at most one byte past the limit to detect oversized files
+	data, err := io.ReadAll(io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return models.CarImage{}, fmt.Errorf("failed to read upload: %v", err)
+	}
+	if int64(len(data)) > s.MaxSize {
+		return models.CarImage{}, ErrImageTooLarge
+	}
+
+	// 3. Trust the bytes, not the client's Content-Type
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return models.CarImage{}, ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return models.CarImage{}, ErrInvalidImage
+	}
+
+	// 4. Store the file under an unguessable name, then record it
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return models.CarImage{}, err
+	}
+	img := models.CarImage{
+		CarID:       carID,
+		Key:         fmt.Sprintf("cars/%d/%s%s", carID, name, ext),
+		ContentType: contentType,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		Size:        int64(len(data)),
+	}
+	if err := s.Store.Put(ctx, img.Key, bytes.NewReader(data), contentType); err != nil {
+		return models.CarImage{}, fmt.Errorf("failed to store image: %v", err)
+	}
+	saved, err := s.Images.Add(ctx, img, primary)
+	if err != nil {
+		s.removeBlob(img.Key)
+		return models.CarImage{}, err
+	}
+	saved.URL = s.Store.URL(saved.Key)
+	return saved, nil
+}
+
+// List returns the photos of a car in display order
+func (s *ImageService) List(ctx context.Context, carID int) ([]models.CarImage, error) {
+	byCar, err := s.ListByCars(ctx, []int{carID})
+	if err != nil {
+		return nil, err
+	}
+	if byCar[carID] == nil {
+		return []models.CarImage{}, nil
+	}
+	return byCar[carID], nil
+}
+
+// ListByCars is CarImageRepository.ListByCars with public URLs filled in
+func (s *ImageService) ListByCars(ctx context.Context, carIDs []int) (map[int][]models.CarImage, error) {
+	byCar, err := s.Images.ListByCars(ctx, carIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, imgs := range byCar {
+		for i := range imgs {
+			imgs[i].URL = s.Store.URL(imgs[i].Key)
+		}
+	}
+	return byCar, nil
+}
+
+// Delete removes a photo and its file
+func (s *ImageService) Delete(ctx context.Context, carID, imageID int) error {
+	img, err := s.Images.Delete(ctx, carID, imageID)
+	if err != nil {
+		return err
+	}
+	s.removeBlob(img.Key)
+	return nil
+}
+
+func (s *ImageService) SetPrimary(ctx context.Context, carID, imageID int) error {
+	return s.Images.SetPrimary(ctx, carID, imageID)
+}
+
+func (s *ImageService) Reorder(ctx context.Context, carID int, imageIDs []int) error {
+	return s.Images.Reorder(ctx, carID, imageIDs)
+}
+
+// RemoveOrphans deletes the photos (rows and files) of cars that have been purged
+func (s *ImageService) RemoveOrphans(ctx context.Context) (int, error) {
+	keys, err := s.Images.DeleteOrphans(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		s.removeBlob(key)
+	}
+	return len(keys), nil
+}
+
+// removeBlob deletes a file whose metadata is gone; a failure only leaves an orphaned file
+func (s *ImageService) removeBlob(key string) {
+	if err := s.Store.Delete(context.Background(), key); err != nil {
+		log.Printf("Failed to delete image file %s: %v", key, err)
+	}
+}
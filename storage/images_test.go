@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"car-service/models"
+	"car-service/repository"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestService(t *testing.T, maxSize int64) (*ImageService, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := NewLocalBlobStore(dir, "/media")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	cars := repository.NewMemoryCarRepository()
+	cars.Create(context.Background(), models.Car{Make: "Honda", Model: "Civic", Year: 2020, Price: 20000, Color: "Red"})
+	return NewImageService(store, repository.NewMemoryCarImageRepository(), cars, maxSize), dir
+}
+
+func TestUploadImage(t *testing.T) {
+	ctx := context.Background()
+	svc, dir := newTestService(t, 1<<20)
+
+	first, err := svc.Upload(ctx, 1, bytes.NewReader(pngBytes(t, 40, 30)), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Width != 40 || first.Height != 30 || first.ContentType != "image/png" || !first.Primary {
+		t.Errorf("Unexpected image metadata: %+v", first)
+	}
+	if !strings.HasPrefix(first.URL, "/media/cars/1/") {
+		t.Errorf("Unexpected URL %q", first.URL)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(first.Key))); err != nil {
+		t.Errorf("Expected the file on disk: %v", err)
+	}
+
+	second, err := svc.Upload(ctx, 1, bytes.NewReader(pngBytes(t, 10, 10)), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	images, _ := svc.List(ctx, 1)
+	if len(images) != 2 || images[0].Primary || !images[1].Primary || second.Position != 2 {
+		t.Errorf("Expected the second image to be primary and last, got %+v", images)
+	}
+
+	if err := svc.Delete(ctx, 1, second.ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(second.Key))); !os.IsNotExist(err) {
+		t.Errorf("Expected the file to be removed, got %v", err)
+	}
+	if images, _ := svc.List(ctx, 1); len(images) != 1 || !images[0].Primary {
+		t.Errorf("Expected the remaining image to become primary, got %+v", images)
+	}
+}
+
+func TestUploadImageValidation(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestService(t, 100)
+
+	cases := []struct {
+		name  string
+		carID int
+		data  []byte
+		want  error
+	}{
+		{"too large", 1, pngBytes(t, 200, 200), ErrImageTooLarge},
+		{"not an image", 1, []byte("plain text"), ErrUnsupportedImage},
+		{"truncated", 1, []byte("\x89PNG\r\n\x1a\n"), ErrInvalidImage},
+		{"missing car", 99, pngBytes(t, 1, 1), repository.ErrNotFound},
+	}
+	for _, tc := range cases {
+		if _, err := svc.Upload(ctx, tc.carID, bytes.NewReader(tc.data), false); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestLocalBlobStoreRejectsEscapingKeys(t *testing.T) {
+	store, _ := NewLocalBlobStore(t.TempDir(), "/media")
+	for _, key := range []string{"../secret", "/etc/passwd", "cars//x", "cars/./x"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
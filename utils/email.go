@@ -1,43 +1,70 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"mime"
+	"net/mail"
 	"net/smtp"
-	"os"
 	"strings"
+
+	"car-service/config"
 )
 
+// ErrHeaderInjection is returned by Send when the recipient or subject contains a line break,
+// which would let it add headers of its own
+var ErrHeaderInjection = errors.New("email recipient and subject must not contain line breaks")
+
+// Mailer sends emails through the configured SMTP server
+type Mailer struct {
+	cfg config.SMTPConfig
+}
+
+// NewMailer creates a Mailer from the SMTP configuration
+func NewMailer(cfg config.SMTPConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
 // SendOTP sends the verification code via email using SMTP
 // If SMTP credentials are not set, it logs the code to the console (Dev Mode)
-func SendOTP(email, code string) error {
-	smtpHost := strings.TrimSpace(os.Getenv("SMTP_HOST"))
-	smtpPort := strings.TrimSpace(os.Getenv("SMTP_PORT"))
-	smtpEmail := strings.TrimSpace(os.Getenv("SMTP_EMAIL"))
-	smtpPassword := strings.TrimSpace(os.Getenv("SMTP_PASSWORD"))
+func (m *Mailer) SendOTP(email, code string) error {
+	return m.Send(email, "Your Login Code", "Your verification code is: "+code)
+}
+
+// Send emails a plain-text message. Like SendOTP, it logs the message to the console
+// instead when SMTP is not configured.
+func (m *Mailer) Send(to, subject, body string) error {
+	// The recipient comes from requestLogin and the subject may hold car names; neither is trusted
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return ErrHeaderInjection
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid email address %q: %v", to, err)
+	}
 
 	// Console Mode (Dev)
-	if smtpHost == "" || smtpPort == "" || smtpEmail == "" || smtpPassword == "" {
+	if !m.cfg.Enabled() {
 		log.Printf("--------------------------------------------------")
-		log.Printf("[DEV MODE] Email Service Skipped (Missing .env vars)")
-		log.Printf("To: %s", email)
-		log.Printf("Subject: Your Login Code")
-		log.Printf("Body: Your verification code is: %s", code)
+		log.Printf("[DEV MODE] Email Service Skipped (Missing SMTP config)")
+		log.Printf("To: %s", to)
+		log.Printf("Subject: %s", subject)
+		log.Printf("Body: %s", body)
 		log.Printf("--------------------------------------------------")
 		return nil
 	}
 
 	// Real Email Sending
-	auth := smtp.PlainAuth("", smtpEmail, smtpPassword, smtpHost)
-	to := []string{email}
-	msg := []byte("To: " + email + "\r\n" +
-		"Subject: Your Login Code\r\n" +
+	auth := smtp.PlainAuth("", m.cfg.Email, m.cfg.Password, m.cfg.Host)
+	msg := []byte("To: " + rcpt.String() + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
 		"\r\n" +
-		"Your verification code is: " + code + "\r\n")
+		strings.ReplaceAll(body, "\n", "\r\n") + "\r\n")
 
-	addr := fmt.Sprintf("%s:%s", smtpHost, smtpPort)
-	err := smtp.SendMail(addr, auth, smtpEmail, to, msg)
-	if err != nil {
+	addr := fmt.Sprintf("%s:%s", m.cfg.Host, m.cfg.Port)
+	if err := smtp.SendMail(addr, auth, m.cfg.Email, []string{rcpt.Address}, msg); err != nil {
 		return fmt.Errorf("failed to send email: %v", err)
 	}
 
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"car-service/config"
+	"testing"
+)
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := NewMailer(config.SMTPConfig{})
+	for _, tc := range []struct{ to, subject string }{
+		{"a@example.com\r\nBcc: victim@example.com", "Test drive confirmed"},
+		{"a@example.com", "Test drive confirmed: 2020 Honda\nBcc: victim@example.com"},
+	} {
+		if err := m.Send(tc.to, tc.subject, "body"); err != ErrHeaderInjection {
+			t.Errorf("Expected ErrHeaderInjection for %q / %q, got %v", tc.to, tc.subject, err)
+		}
+	}
+	if err := m.Send("not an address", "Subject", "body"); err == nil {
+		t.Error("Expected an invalid recipient to be refused")
+	}
+	if err := m.Send("a@example.com", "Test drive confirmed: 2020 Škoda Octavia", "body"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
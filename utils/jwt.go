@@ -1,39 +1,77 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"os"
 	"time"
 
+	"car-service/config"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// TokenManager issues and validates the HS256 access tokens and mints refresh tokens
+type TokenManager struct {
+	secret     []byte
+	ttl        time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokenManager creates a TokenManager from the auth configuration
+func NewTokenManager(cfg config.AuthConfig) *TokenManager {
+	return &TokenManager{secret: []byte(cfg.JWTSecret), ttl: cfg.AccessTokenTTL, refreshTTL: cfg.RefreshTokenTTL}
+}
+
+// AccessTokenTTL is the lifetime of tokens from GenerateToken
+func (m *TokenManager) AccessTokenTTL() time.Duration {
+	return m.ttl
+}
+
+// NewRefreshToken returns a random opaque refresh token, the hash to store instead of it, and its expiry
+func (m *TokenManager) NewRefreshToken() (token, hash string, expiresAt time.Time, err error) {
+	token, err = RandomToken(32)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return token, HashRefreshToken(token), time.Now().Add(m.refreshTTL), nil
+}
+
+// HashRefreshToken is the at-rest form of a refresh token
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-func init() {
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("default-secret-key-change-me") // Fallback for development
+// RandomToken returns n bytes from crypto/rand, base64url encoded
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
 // GenerateToken creates a new JWT for the user ID and role
-func GenerateToken(userID int, role string) (string, error) {
+func (m *TokenManager) GenerateToken(userID int, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(time.Minute * 15).Unix(), // 15 minutes expiration
+		"exp":     time.Now().Add(m.ttl).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString(m.secret)
 }
 
 // ValidateToken parses and validates the JWT string
-func ValidateToken(tokenString string) (*jwt.Token, error) {
+func (m *TokenManager) ValidateToken(tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return jwtSecret, nil
+		return m.secret, nil
 	})
 }
@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestGenerateOTP(t *testing.T) {
+	for _, length := range []int{4, 6, 8} {
+		code, err := GenerateOTP(length)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(code) != length {
+			t.Errorf("Expected %d digits, got %q", length, code)
+		}
+		for _, c := range code {
+			if c < '0' || c > '9' {
+				t.Errorf("Expected only digits, got %q", code)
+			}
+		}
+	}
+}
+
+func TestVerifyOTP(t *testing.T) {
+	hash := HashOTP("pepper", 1, "123456")
+
+	if !VerifyOTP("pepper", 1, "123456", hash) {
+		t.Error("Expected matching code to verify")
+	}
+	if VerifyOTP("pepper", 1, "654321", hash) {
+		t.Error("Expected wrong code to fail")
+	}
+	if VerifyOTP("pepper", 2, "123456", hash) {
+		t.Error("Expected code of another user to fail")
+	}
+	if VerifyOTP("other-pepper", 1, "123456", hash) {
+		t.Error("Expected code hashed with another pepper to fail")
+	}
+}
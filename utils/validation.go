@@ -3,6 +3,8 @@ package utils
 import (
 	"car-service/models"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 func ValidateCar(car models.Car) error {
@@ -12,5 +14,40 @@ func ValidateCar(car models.Car) error {
 	if car.Year <= 1886 {
 		return errors.New("year must be greater than 1886")
 	}
+	if car.Status != "" && !models.IsCarStatus(car.Status) {
+		return fmt.Errorf("status must be one of %s", strings.Join(models.CarStatuses, ", "))
+	}
+	// VIN is optional for existing inventory; callers pass it through NormalizeVIN first
+	if car.VIN != "" {
+		if err := ValidateVIN(car.VIN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateOrder checks the agreed price and line items of a new order. Fees need a positive
+// amount; taxes a rate between 0 and 100 percent.
+func ValidateOrder(order models.Order) error {
+	if order.Price <= 0 {
+		return errors.New("price must be greater than 0")
+	}
+	for i, item := range order.LineItems {
+		if strings.TrimSpace(item.Description) == "" {
+			return fmt.Errorf("line item %d needs a description", i+1)
+		}
+		switch item.Kind {
+		case models.LineItemFee:
+			if item.Amount <= 0 || item.Rate != nil {
+				return fmt.Errorf("fee %q needs an amount greater than 0 and no rate", item.Description)
+			}
+		case models.LineItemTax:
+			if item.Rate == nil || *item.Rate <= 0 || *item.Rate > 100 {
+				return fmt.Errorf("tax %q needs a rate between 0 and 100", item.Description)
+			}
+		default:
+			return fmt.Errorf("line item %d must be a %s or a %s", i+1, models.LineItemFee, models.LineItemTax)
+		}
+	}
 	return nil
 }
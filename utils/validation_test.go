@@ -23,4 +23,34 @@ func TestValidateCar(t *testing.T) {
 	if err := ValidateCar(invalidYearCar); err == nil {
 		t.Error("Expected error for year 1800, got nil")
 	}
+
+	// Test Unknown Status
+	if err := ValidateCar(models.Car{Price: 100, Year: 2020, Status: "lost"}); err == nil {
+		t.Error("Expected error for status lost, got nil")
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	rate, tooHigh := 8.25, 120.0
+	valid := models.Order{Price: 20000, LineItems: []models.LineItem{
+		{Kind: models.LineItemFee, Description: "Documentation fee", Amount: 199},
+		{Kind: models.LineItemTax, Description: "Sales tax", Rate: &rate},
+	}}
+	if err := ValidateOrder(valid); err != nil {
+		t.Errorf("Expected valid order, got error: %v", err)
+	}
+
+	invalid := []models.Order{
+		{Price: 0},
+		{Price: 100, LineItems: []models.LineItem{{Kind: models.LineItemFee, Description: "Fee", Amount: -5}}},
+		{Price: 100, LineItems: []models.LineItem{{Kind: models.LineItemTax, Description: "Tax"}}},
+		{Price: 100, LineItems: []models.LineItem{{Kind: models.LineItemTax, Description: "Tax", Rate: &tooHigh}}},
+		{Price: 100, LineItems: []models.LineItem{{Kind: models.LineItemFee, Description: " ", Amount: 5}}},
+		{Price: 100, LineItems: []models.LineItem{{Kind: "discount", Description: "Promo", Amount: 5}}},
+	}
+	for _, order := range invalid {
+		if err := ValidateOrder(order); err == nil {
+			t.Errorf("Expected error for %+v, got nil", order)
+		}
+	}
 }
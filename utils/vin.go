@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// vinWeights are the ISO 3779 / 49 CFR 565 position weights; position 9 holds the check digit
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// vinValue transliterates a VIN character for the check digit. I, O and Q are not allowed
+// because they are too easily confused with 1 and 0.
+func vinValue(c byte) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'A' && c <= 'H':
+		return int(c-'A') + 1, true
+	case c >= 'J' && c <= 'N':
+		return int(c-'J') + 1, true
+	case c == 'P':
+		return 7, true
+	case c == 'R':
+		return 9, true
+	case c >= 'S' && c <= 'Z':
+		return int(c-'S') + 2, true
+	}
+	return 0, false
+}
+
+// NormalizeVIN trims and upper-cases a VIN as typed by a user
+func NormalizeVIN(vin string) string {
+	return strings.ToUpper(strings.TrimSpace(vin))
+}
+
+// VINCheckDigit computes the North American check digit ('0'-'9' or 'X') of a 17 character VIN
+func VINCheckDigit(vin string) (byte, error) {
+	if len(vin) != 17 {
+		return 0, errors.New("vin must be exactly 17 characters")
+	}
+	sum := 0
+	for i := 0; i < len(vin); i++ {
+		v, ok := vinValue(vin[i])
+		if !ok {
+			return 0, fmt.Errorf("vin contains invalid character %q at position %d (letters I, O and Q are not used)", vin[i], i+1)
+		}
+		sum += v * vinWeights[i]
+	}
+	if rem := sum % 11; rem != 10 {
+		return byte('0' + rem), nil
+	}
+	return 'X', nil
+}
+
+// ValidateVIN checks the character set, length and check digit of a normalized VIN
+func ValidateVIN(vin string) error {
+	check, err := VINCheckDigit(vin)
+	if err != nil {
+		return err
+	}
+	if vin[8] != check {
+		return fmt.Errorf("vin check digit (position 9) is %q but should be %q; check for a typo", vin[8], check)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"car-service/models"
+	"testing"
+)
+
+func TestValidateVIN(t *testing.T) {
+	valid := []string{
+		"1HGCM82633A004352",
+		"1M8GDM9AXKP042788", // Check digit X
+		"JH4KA7561PC008269",
+	}
+	for _, vin := range valid {
+		if err := ValidateVIN(vin); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", vin, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"1HGCM82633A00435":   "too short",
+		"1HGCM82633A0043521": "too long",
+		"1HGCM82633A00435O":  "contains O",
+		"IHGCM82633A004352":  "contains I",
+		"1HGCM82643A004352":  "wrong check digit",
+		"1HGCM82633A004353":  "typo after the check digit",
+		"1hgcm82633a004352":  "not normalized",
+	}
+	for vin, why := range invalid {
+		if err := ValidateVIN(vin); err == nil {
+			t.Errorf("Expected %s to be rejected (%s)", vin, why)
+		}
+	}
+}
+
+func TestValidateCarVIN(t *testing.T) {
+	car := models.Car{Price: 100, Year: 2020, VIN: NormalizeVIN(" 1hgcm82633a004352 ")}
+	if err := ValidateCar(car); err != nil {
+		t.Errorf("Expected a normalized VIN to be valid, got %v", err)
+	}
+
+	car.VIN = "1HGCM82633A004353"
+	if err := ValidateCar(car); err == nil {
+		t.Error("Expected an error for a bad check digit")
+	}
+}
@@ -0,0 +1,221 @@
+// Package vin decodes Vehicle Identification Numbers offline: the manufacturer from the
+// bundled WMI table (wmi.csv), the country from the ISO 3780 code ranges and the model year
+// from position 10. It does not know model names; those are only in manufacturer databases.
+package vin
+
+import (
+	"car-service/models"
+	"car-service/utils"
+	_ "embed" // wmi.csv
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Decoded is what can be read from a VIN without a network lookup. Manufacturer and Make are
+// empty when the WMI is not in the bundled table.
+type Decoded struct {
+	VIN          string `json:"vin"`
+	WMI          string `json:"wmi"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Make         string `json:"make,omitempty"`
+	Country      string `json:"country,omitempty"`
+	Region       string `json:"region"`
+	ModelYear    int    `json:"model_year"`
+}
+
+//go:embed wmi.csv
+var wmiCSV string
+
+type manufacturer struct {
+	name string
+	make string
+}
+
+// wmis maps world manufacturer identifiers (the first three characters) to manufacturers
+var wmis = loadWMIs()
+
+func loadWMIs() map[string]manufacturer {
+	records, err := csv.NewReader(strings.NewReader(wmiCSV)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("vin: invalid wmi.csv: %v", err))
+	}
+	table := make(map[string]manufacturer, len(records))
+	for _, rec := range records[1:] {
+		table[rec[0]] = manufacturer{name: rec[1], make: rec[2]}
+	}
+	return table
+}
+
+// vinChars is the ISO 3780 ordering of the second character within a country range
+const vinChars = "ABCDEFGHJKLMNPRSTUVWXYZ1234567890"
+
+// countries assigns ranges of the first two characters to countries (ISO 3780).
+// from/to are inclusive positions of the second character in vinChars.
+var countries = []struct {
+	first    byte
+	from, to byte
+	country  string
+}{
+	{'A', 'A', 'H', "South Africa"},
+	{'J', 'A', '0', "Japan"},
+	{'K', 'L', 'R', "South Korea"},
+	{'L', 'A', '0', "China"},
+	{'M', 'A', 'E', "India"},
+	{'M', 'F', 'K', "Indonesia"},
+	{'M', 'L', 'R', "Thailand"},
+	{'N', 'L', 'R', "Turkey"},
+	{'P', 'L', 'R', "Malaysia"},
+	{'S', 'A', 'M', "United Kingdom"},
+	{'S', 'N', 'T', "Germany"},
+	{'S', 'U', 'Z', "Poland"},
+	{'T', 'A', 'H', "Switzerland"},
+	{'T', 'J', 'P', "Czech Republic"},
+	{'T', 'R', 'V', "Hungary"},
+	{'V', 'A', 'E', "Austria"},
+	{'V', 'F', 'R', "France"},
+	{'V', 'S', 'W', "Spain"},
+	{'W', 'A', '0', "Germany"},
+	{'X', 'L', 'R', "Netherlands"},
+	{'X', 'S', 'W', "Russia"},
+	{'Y', 'A', 'E', "Belgium"},
+	{'Y', 'F', 'K', "Finland"},
+	{'Y', 'S', 'W', "Sweden"},
+	{'Z', 'A', 'R', "Italy"},
+	{'1', 'A', '0', "United States"},
+	{'2', 'A', '0', "Canada"},
+	{'3', 'A', 'W', "Mexico"},
+	{'4', 'A', '0', "United States"},
+	{'5', 'A', '0', "United States"},
+	{'6', 'A', 'W', "Australia"},
+	{'7', 'A', 'E', "New Zealand"},
+	{'7', 'F', '0', "United States"},
+	{'8', 'A', 'E', "Argentina"},
+	{'9', 'A', 'E', "Brazil"},
+	{'9', '3', '9', "Brazil"},
+}
+
+func country(vin string) string {
+	second := strings.IndexByte(vinChars, vin[1])
+	for _, c := range countries {
+		if c.first == vin[0] && second >= strings.IndexByte(vinChars, c.from) && second <= strings.IndexByte(vinChars, c.to) {
+			return c.country
+		}
+	}
+	return ""
+}
+
+func region(first byte) string {
+	switch {
+	case first >= 'A' && first <= 'H':
+		return "Africa"
+	case first >= 'J' && first <= 'R':
+		return "Asia"
+	case first >= 'S' && first <= 'Z':
+		return "Europe"
+	case first >= '1' && first <= '5':
+		return "North America"
+	case first == '6' || first == '7':
+		return "Oceania"
+	}
+	return "South America"
+}
+
+// yearCodes are the position 10 codes of 1980-2009; the cycle repeats every 30 years
+const yearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+// modelYear reads position 10. The code repeats every 30 years; for North American vehicles
+// a letter in position 7 means 2010 or later, otherwise the latest year no more than one
+// year in the future is chosen.
+func modelYear(vin string, now time.Time) (int, error) {
+	i := strings.IndexByte(yearCodes, vin[9])
+	if i < 0 {
+		return 0, fmt.Errorf("position 10 (%q) is not a model year code", vin[9])
+	}
+	year := 1980 + i
+	if vin[0] >= '1' && vin[0] <= '5' {
+		if vin[6] < '0' || vin[6] > '9' {
+			year += 30
+		}
+		return year, nil
+	}
+	for year+30 <= now.Year()+1 {
+		year += 30
+	}
+	return year, nil
+}
+
+// Decode validates a VIN (after normalizing it) and decodes it
+func Decode(vin string) (Decoded, error) {
+	return decode(vin, time.Now())
+}
+
+func decode(vin string, now time.Time) (Decoded, error) {
+	vin = utils.NormalizeVIN(vin)
+	if err := utils.ValidateVIN(vin); err != nil {
+		return Decoded{}, err
+	}
+	year, err := modelYear(vin, now)
+	if err != nil {
+		return Decoded{}, err
+	}
+
+	d := Decoded{VIN: vin, WMI: vin[:3], Country: country(vin), Region: region(vin[0]), ModelYear: year}
+	if m, ok := wmis[d.WMI]; ok {
+		d.Manufacturer, d.Make = m.name, m.make
+	}
+	return d, nil
+}
+
+// Conflict is a supplied car field that disagrees with the VIN
+type Conflict struct {
+	Field    string `json:"field"`
+	Supplied string `json:"supplied"`
+	Decoded  string `json:"decoded"`
+}
+
+// MismatchError is returned by Autofill when supplied fields disagree with the VIN
+type MismatchError struct {
+	Conflicts []Conflict
+}
+
+func (e *MismatchError) Error() string {
+	parts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		parts[i] = fmt.Sprintf("%s is %q but the VIN decodes to %q", c.Field, c.Supplied, c.Decoded)
+	}
+	return "vin does not match the car: " + strings.Join(parts, "; ")
+}
+
+// Autofill decodes car.VIN and fills in a blank make and year. Non-blank fields that disagree
+// with the VIN are returned as a *MismatchError and leave the car unchanged.
+func Autofill(car *models.Car) error {
+	if car.VIN == "" {
+		return fmt.Errorf("autofill requires a vin")
+	}
+	d, err := Decode(car.VIN)
+	if err != nil {
+		return err
+	}
+
+	var conflicts []Conflict
+	if car.Make != "" && d.Make != "" && !strings.EqualFold(car.Make, d.Make) {
+		conflicts = append(conflicts, Conflict{Field: "make", Supplied: car.Make, Decoded: d.Make})
+	}
+	if car.Year != 0 && car.Year != d.ModelYear {
+		conflicts = append(conflicts, Conflict{Field: "year", Supplied: fmt.Sprint(car.Year), Decoded: fmt.Sprint(d.ModelYear)})
+	}
+	if len(conflicts) > 0 {
+		return &MismatchError{Conflicts: conflicts}
+	}
+
+	car.VIN = d.VIN
+	if car.Make == "" {
+		car.Make = d.Make
+	}
+	if car.Year == 0 {
+		car.Year = d.ModelYear
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package vin
+
+import (
+	"car-service/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		vin  string
+		want Decoded
+	}{
+		{"1hgcm82633a004352", Decoded{VIN: "1HGCM82633A004352", WMI: "1HG", Manufacturer: "Honda of America Mfg.", Make: "Honda", Country: "United States", Region: "North America", ModelYear: 2003}},
+		// Position 7 is a letter, so the K in position 10 means 2019 rather than 1989
+		{"5YJ3E1EA2KF317000", Decoded{VIN: "5YJ3E1EA2KF317000", WMI: "5YJ", Manufacturer: "Tesla Inc.", Make: "Tesla", Country: "United States", Region: "North America", ModelYear: 2019}},
+		// Outside North America the latest year not after next year is chosen
+		{"WP0AB2A9XKS114120", Decoded{VIN: "WP0AB2A9XKS114120", WMI: "WP0", Manufacturer: "Dr. Ing. h.c. F. Porsche AG", Make: "Porsche", Country: "Germany", Region: "Europe", ModelYear: 2019}},
+		// Unknown WMI: country and year only
+		{"SUU11111411111111", Decoded{VIN: "SUU11111411111111", WMI: "SUU", Country: "Poland", Region: "Europe", ModelYear: 2001}},
+	}
+	for _, c := range cases {
+		got, err := decode(c.vin, now)
+		if err != nil {
+			t.Errorf("decode(%s) failed: %v", c.vin, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("decode(%s) = %+v, want %+v", c.vin, got, c.want)
+		}
+	}
+
+	if _, err := Decode("1HGCM82633A004353"); err == nil {
+		t.Error("Expected an invalid check digit to be rejected")
+	}
+}
+
+func TestAutofill(t *testing.T) {
+	car := models.Car{Model: "Accord", Price: 4000, VIN: "1HGCM82633A004352"}
+	if err := Autofill(&car); err != nil {
+		t.Fatalf("Autofill failed: %v", err)
+	}
+	if car.Make != "Honda" || car.Year != 2003 {
+		t.Errorf("Expected Honda 2003, got %s %d", car.Make, car.Year)
+	}
+
+	// Matching values are fine, whatever their case
+	car = models.Car{Make: "HONDA", Year: 2003, VIN: "1HGCM82633A004352"}
+	if err := Autofill(&car); err != nil || car.Make != "HONDA" {
+		t.Errorf("Expected supplied values to be kept, got %q, %v", car.Make, err)
+	}
+
+	car = models.Car{Make: "Toyota", Year: 2005, VIN: "1HGCM82633A004352"}
+	var mismatch *MismatchError
+	if err := Autofill(&car); !errors.As(err, &mismatch) || len(mismatch.Conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %v", err)
+	}
+	if c := mismatch.Conflicts[0]; c.Field != "make" || c.Supplied != "Toyota" || c.Decoded != "Honda" {
+		t.Errorf("Unexpected conflict %+v", c)
+	}
+
+	if err := Autofill(&models.Car{Make: "Honda"}); err == nil {
+		t.Error("Expected autofill without a VIN to fail")
+	}
+}